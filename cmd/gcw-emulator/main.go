@@ -2,17 +2,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/api"
 	grpcapi "github.com/lemonberrylabs/gcw-emulator/pkg/api/grpc"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runner"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runtime"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
 	"github.com/lemonberrylabs/gcw-emulator/web"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Set via -ldflags at build time.
@@ -38,6 +47,24 @@ func init() {
 	rootCmd.Flags().String("project", "", "GCP project ID for API paths (default my-project, env PROJECT)")
 	rootCmd.Flags().String("location", "", "GCP location for API paths (default us-central1, env LOCATION)")
 	rootCmd.Flags().String("workflows-dir", "", "Directory of workflow YAML/JSON files to watch (env WORKFLOWS_DIR)")
+	rootCmd.Flags().Duration("watch-debounce", 0, "Coalescing window for workflow file changes, 0 to disable (default 150ms, env WATCH_DEBOUNCE)")
+	rootCmd.Flags().Int("max-concurrent-executions", 0, "Executions allowed to run at once before queueing (default 100, env MAX_CONCURRENT_EXECUTIONS)")
+	rootCmd.Flags().Duration("execution-timeout", 0, "Wall-clock limit per execution (default 30m, env EXECUTION_TIMEOUT)")
+	rootCmd.Flags().Int("max-steps", 0, "Steps allowed per execution (default 100000, env MAX_STEPS)")
+	rootCmd.Flags().Int("max-call-stack-depth", 0, "Nested subworkflow calls allowed (default 20, env MAX_CALL_STACK_DEPTH)")
+	rootCmd.Flags().Int("max-parallel-nesting-depth", 0, "Nested parallel steps allowed (default 2, env MAX_PARALLEL_NESTING_DEPTH)")
+	rootCmd.Flags().Int("max-definition-steps", 0, "Steps allowed in a deployed workflow definition (default 5000, env MAX_DEFINITION_STEPS)")
+	rootCmd.Flags().Int("max-subworkflows", 0, "Subworkflows allowed in a deployed workflow definition (default 500, env MAX_SUBWORKFLOWS)")
+	rootCmd.Flags().Float64("retry-jitter", 0, "Randomize retry backoff delays by up to this fraction, e.g. 0.1 for ±10% (default 0, env RETRY_JITTER)")
+	rootCmd.Flags().Bool("deterministic", false, "Virtualize sys.now/sys.sleep/sys.sleep_until so sleeps finish instantly (env DETERMINISTIC)")
+	rootCmd.Flags().Bool("strict", false, "Reject workflows that use emulator-only extensions such as finally (env STRICT)")
+	rootCmd.Flags().String("otel-endpoint", "", "OTLP/HTTP collector to send execution and step trace spans to, e.g. http://localhost:4318 (env OTEL_ENDPOINT)")
+	rootCmd.Flags().String("log-format", "", "Execution log format: text or json (default text, env LOG_FORMAT)")
+	rootCmd.Flags().String("default-base-url", "", "Base URL for relative http.* request URLs (env DEFAULT_BASE_URL)")
+	rootCmd.Flags().String("http-mock", "", "YAML file of canned responses for http.* requests (env HTTP_MOCK)")
+	rootCmd.Flags().String("http-record", "", "Directory to record http.* responses to (env HTTP_RECORD)")
+	rootCmd.Flags().String("http-replay", "", "Directory of recorded http.* responses to serve instead of the network (env HTTP_REPLAY)")
+	rootCmd.Flags().String("connector-mock", "", "JSON file mapping googleapis.* connector methods to canned responses (env CONNECTOR_MOCK)")
 }
 
 func main() {
@@ -77,15 +104,214 @@ func run(cmd *cobra.Command, args []string) error {
 		workflowsDir = v
 	}
 
+	watchDebounce := api.DefaultWatchDebounce
+	if v := os.Getenv("WATCH_DEBOUNCE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WATCH_DEBOUNCE %q: %w", v, err)
+		}
+		watchDebounce = d
+	}
+	// 0 is a valid window that turns debouncing off, so only an explicit
+	// flag overrides the environment
+	if cmd.Flags().Changed("watch-debounce") {
+		watchDebounce, _ = cmd.Flags().GetDuration("watch-debounce")
+	}
+
+	maxConcurrent := runtime.DefaultMaxConcurrentExecutions
+	if v := os.Getenv("MAX_CONCURRENT_EXECUTIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_CONCURRENT_EXECUTIONS %q: %w", v, err)
+		}
+		maxConcurrent = n
+	}
+	if v, _ := cmd.Flags().GetInt("max-concurrent-executions"); v != 0 {
+		maxConcurrent = v
+	}
+
+	execTimeout := runtime.DefaultExecutionTimeout
+	if v := os.Getenv("EXECUTION_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid EXECUTION_TIMEOUT %q: %w", v, err)
+		}
+		execTimeout = d
+	}
+	if v, _ := cmd.Flags().GetDuration("execution-timeout"); v != 0 {
+		execTimeout = v
+	}
+
+	var limits runtime.Limits
+	for _, l := range []struct {
+		flag, env string
+		dst       *int
+	}{
+		{"max-steps", "MAX_STEPS", &limits.MaxSteps},
+		{"max-call-stack-depth", "MAX_CALL_STACK_DEPTH", &limits.MaxCallStackDepth},
+		{"max-parallel-nesting-depth", "MAX_PARALLEL_NESTING_DEPTH", &limits.MaxParallelNestingDepth},
+		{"max-definition-steps", "MAX_DEFINITION_STEPS", &limits.MaxDefinitionSteps},
+		{"max-subworkflows", "MAX_SUBWORKFLOWS", &limits.MaxSubworkflows},
+	} {
+		if v := os.Getenv(l.env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", l.env, v, err)
+			}
+			*l.dst = n
+		}
+		if v, _ := cmd.Flags().GetInt(l.flag); v != 0 {
+			*l.dst = v
+		}
+		if *l.dst < 0 {
+			return fmt.Errorf("--%s must not be negative, got %d", l.flag, *l.dst)
+		}
+	}
+
+	var retryJitter float64
+	if v := os.Getenv("RETRY_JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid RETRY_JITTER %q: %w", v, err)
+		}
+		retryJitter = f
+	}
+	if v, _ := cmd.Flags().GetFloat64("retry-jitter"); v != 0 {
+		retryJitter = v
+	}
+	if retryJitter < 0 || retryJitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %g", retryJitter)
+	}
+
+	var deterministic bool
+	if v := os.Getenv("DETERMINISTIC"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid DETERMINISTIC %q: %w", v, err)
+		}
+		deterministic = b
+	}
+	if v, _ := cmd.Flags().GetBool("deterministic"); v {
+		deterministic = v
+	}
+
+	var strict bool
+	if v := os.Getenv("STRICT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid STRICT %q: %w", v, err)
+		}
+		strict = b
+	}
+	if v, _ := cmd.Flags().GetBool("strict"); v {
+		strict = v
+	}
+
+	otelEndpoint := os.Getenv("OTEL_ENDPOINT")
+	if v, _ := cmd.Flags().GetString("otel-endpoint"); v != "" {
+		otelEndpoint = v
+	}
+	var tracer trace.Tracer
+	if otelEndpoint != "" {
+		tp, err := newTracerProvider(otelEndpoint)
+		if err != nil {
+			return err
+		}
+		defer tp.Shutdown(context.Background())
+		tracer = tp.Tracer("github.com/lemonberrylabs/gcw-emulator")
+	}
+
+	logFormat := envOrDefault("LOG_FORMAT", logging.FormatText)
+	if v, _ := cmd.Flags().GetString("log-format"); v != "" {
+		logFormat = v
+	}
+	logger, err := logging.New(logFormat, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	defaultBaseURL := os.Getenv("DEFAULT_BASE_URL")
+	if v, _ := cmd.Flags().GetString("default-base-url"); v != "" {
+		defaultBaseURL = v
+	}
+
+	var connectorMocks stdlib.ConnectorMocks
+	connectorMockFile := os.Getenv("CONNECTOR_MOCK")
+	if v, _ := cmd.Flags().GetString("connector-mock"); v != "" {
+		connectorMockFile = v
+	}
+	if connectorMockFile != "" {
+		connectorMocks, err = stdlib.LoadConnectorMocks(connectorMockFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	httpRecordDir := os.Getenv("HTTP_RECORD")
+	if v, _ := cmd.Flags().GetString("http-record"); v != "" {
+		httpRecordDir = v
+	}
+	httpReplayDir := os.Getenv("HTTP_REPLAY")
+	if v, _ := cmd.Flags().GetString("http-replay"); v != "" {
+		httpReplayDir = v
+	}
+	if httpRecordDir != "" && httpReplayDir != "" {
+		return fmt.Errorf("--http-record and --http-replay cannot be used together")
+	}
+
+	// Mocks take precedence, then recordings, then the network
+	var httpTransport http.RoundTripper
+	switch {
+	case httpRecordDir != "":
+		httpTransport = stdlib.RecordingTransport(httpRecordDir, http.DefaultTransport)
+	case httpReplayDir != "":
+		httpTransport = stdlib.ReplayTransport(httpReplayDir)
+	}
+
+	var httpMocks stdlib.HTTPMocks
+	httpMockFile := os.Getenv("HTTP_MOCK")
+	if v, _ := cmd.Flags().GetString("http-mock"); v != "" {
+		httpMockFile = v
+	}
+	if httpMockFile != "" {
+		httpMocks, err = stdlib.LoadHTTPMocks(httpMockFile)
+		if err != nil {
+			return err
+		}
+		if httpTransport == nil {
+			httpTransport = http.DefaultTransport
+		}
+		httpTransport = httpMocks.Transport(httpTransport)
+	}
+
 	addr := fmt.Sprintf("%s:%s", host, port)
 	grpcAddr := fmt.Sprintf("%s:%s", host, grpcPort)
 
+	// One runner serves both APIs, so the execution limit, the parse cache
+	// and cancellation span executions created through either
 	s := store.New()
+	r := runner.New(s)
+	r.SetExecutionLimiter(runtime.NewExecutionLimiter(maxConcurrent))
+	r.SetExecutionTimeout(execTimeout)
+	r.SetRetryJitter(retryJitter)
+	r.SetLimits(limits)
+	r.SetDeterministic(deterministic)
+	r.SetStrict(strict)
+	r.SetLogger(logger)
+	r.SetTracer(tracer)
+	r.SetDefaultBaseURL(defaultBaseURL)
+	r.SetHTTPTransport(httpTransport)
+	r.SetConnectorMocks(connectorMocks)
+
 	server := api.New(s)
+	server.SetRunner(r)
 
-	// Load workflows from directory if specified
+	// Load workflows from directory if specified. The load runs in the
+	// background, so the server listens at once and /readyz reports 503 until
+	// it completes
 	if workflowsDir != "" {
 		log.Printf("Watching workflows directory: %s", workflowsDir)
+		server.SetWatchDebounce(watchDebounce)
 		if err := server.WatchDir(workflowsDir, project, location); err != nil {
 			log.Printf("Warning: failed to watch workflows directory: %v", err)
 		}
@@ -99,11 +325,14 @@ func run(cmd *cobra.Command, args []string) error {
 			}
 		}()
 		ui := web.New(s, project, location)
+		ui.SetExecutionStarter(server.StartExecution)
 		ui.Register(server.App())
 	}()
 
 	// Start gRPC server
 	grpcServer := grpcapi.New(s)
+	grpcServer.SetRunner(r)
+	grpcServer.SetLogger(logger)
 	go func() {
 		log.Printf("gRPC server listening on %s", grpcAddr)
 		if err := grpcServer.Serve(grpcAddr); err != nil {
@@ -124,6 +353,27 @@ func run(cmd *cobra.Command, args []string) error {
 	}()
 
 	log.Printf("GCW Emulator listening on %s (project=%s, location=%s)", addr, project, location)
+	if defaultBaseURL != "" {
+		log.Printf("Relative http.* URLs resolve against %s", defaultBaseURL)
+	}
+	if deterministic {
+		log.Printf("Deterministic mode: sleeps advance a virtual clock")
+	}
+	if otelEndpoint != "" {
+		log.Printf("Sending trace spans to %s", otelEndpoint)
+	}
+	if httpRecordDir != "" {
+		log.Printf("Recording http.* responses to %s", httpRecordDir)
+	}
+	if httpReplayDir != "" {
+		log.Printf("Replaying http.* responses from %s", httpReplayDir)
+	}
+	if len(httpMocks) > 0 {
+		log.Printf("Serving %d HTTP mock(s) from %s", len(httpMocks), httpMockFile)
+	}
+	if len(connectorMocks) > 0 {
+		log.Printf("Mocking %d connector method(s) from %s", len(connectorMocks), connectorMockFile)
+	}
 	if workflowsDir != "" {
 		log.Printf("Workflows directory: %s", workflowsDir)
 	} else {
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:          "validate <file-or-dir>...",
+	Short:        "Validate workflow definitions without starting the server",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runValidate,
+}
+
+func init() {
+	validateCmd.Flags().Bool("strict", false, "Also reject emulator-only extensions such as finally")
+	rootCmd.AddCommand(validateCmd)
+}
+
+// runValidate parses each workflow file (directories are expanded to their
+// .yaml/.yml/.json entries) and reports OK or ERROR per file. It returns an
+// error, and so exits non-zero, if any file fails to parse.
+func runValidate(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+
+	parse := parser.Parse
+	if strict, _ := cmd.Flags().GetBool("strict"); strict {
+		parse = parser.ParseStrict
+	}
+
+	var files []string
+	for _, arg := range args {
+		expanded, err := workflowFiles(arg)
+		if err != nil {
+			return err
+		}
+		files = append(files, expanded...)
+	}
+
+	failed := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			_, err = parse(data)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "ERROR %s: %v\n", file, err)
+			continue
+		}
+		fmt.Fprintf(out, "OK    %s\n", file)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d workflow file(s) failed validation", failed, len(files))
+	}
+	return nil
+}
+
+// workflowFiles returns path itself if it is a file, or the workflow files
+// directly inside it if it is a directory.
+func workflowFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading workflows directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	good := "main:\n  steps:\n    - done:\n        return: 1\n"
+	bad := "main:\n  steps:\n    - broken:\n        bogus: 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "good.yaml"), []byte(good), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Non-workflow files are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs([]string{"validate", dir})
+	defer rootCmd.SetArgs(nil)
+
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatal("expected non-nil error (non-zero exit) when a file fails validation")
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "OK    "+filepath.Join(dir, "good.yaml")) {
+		t.Errorf("expected OK line for good.yaml, got:\n%s", output)
+	}
+	if !strings.Contains(output, "ERROR "+filepath.Join(dir, "bad.yaml")) {
+		t.Errorf("expected ERROR line for bad.yaml, got:\n%s", output)
+	}
+	if !strings.Contains(output, "step 'broken' in main") {
+		t.Errorf("expected parse error location in output, got:\n%s", output)
+	}
+	if strings.Contains(output, "README.md") {
+		t.Errorf("expected README.md to be skipped, got:\n%s", output)
+	}
+}
+
+func TestValidateCommandAllValid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ok.yaml")
+	if err := os.WriteFile(path, []byte("main:\n  steps:\n    - done:\n        return: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs([]string{"validate", path})
+	defer rootCmd.SetArgs(nil)
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("expected success, got %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "OK    "+path) {
+		t.Errorf("expected OK line, got:\n%s", out.String())
+	}
+}
@@ -3,22 +3,17 @@
 package api
 
 import (
-	"context"
-	"encoding/json"
+	"bufio"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gofiber/fiber/v2"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/runtime"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runner"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
@@ -27,16 +22,20 @@ import (
 type Server struct {
 	app    *fiber.App
 	store  *store.Store
-	parsed map[string]*ast.Workflow // cached parsed workflows
-	engines map[string]*runtime.Engine // running execution engines (for cancel)
+	runner *runner.Runner // parses, runs and cancels executions
+
+	watcher       *fsnotify.Watcher // workflows directory watcher, if any
+	watchDebounce time.Duration     // per-file event coalescing window
+
+	loading atomic.Bool // workflows directory initial load in progress
 }
 
 // New creates a new API server.
 func New(s *store.Store) *Server {
 	srv := &Server{
-		store:   s,
-		parsed:  make(map[string]*ast.Workflow),
-		engines: make(map[string]*runtime.Engine),
+		store:         s,
+		runner:        runner.New(s),
+		watchDebounce: DefaultWatchDebounce,
 	}
 
 	app := fiber.New(fiber.Config{
@@ -45,8 +44,15 @@ func New(s *store.Store) *Server {
 		WriteTimeout:          30 * time.Second,
 	})
 
+	// Health checks
+	app.Get("/healthz", srv.healthz)
+	app.Get("/readyz", srv.readyz)
+
 	// Workflows API
+	app.Post("/v1/projects/:project/locations/:location/workflows\\:validate", srv.validateWorkflow)
 	app.Post("/v1/projects/:project/locations/:location/workflows", srv.createWorkflow)
+	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow\\:analyze", srv.analyzeWorkflow)
+	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow\\:ast", srv.getWorkflowAST)
 	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow", srv.getWorkflow)
 	app.Get("/v1/projects/:project/locations/:location/workflows", srv.listWorkflows)
 	app.Patch("/v1/projects/:project/locations/:location/workflows/:workflow", srv.updateWorkflow)
@@ -54,12 +60,15 @@ func New(s *store.Store) *Server {
 
 	// Executions API
 	app.Post("/v1/projects/:project/locations/:location/workflows/:workflow/executions", srv.createExecution)
+	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions\\:latest", srv.getLatestExecution)
 	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions/:execution", srv.getExecution)
 	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions", srv.listExecutions)
+	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions/:execution/result", srv.getExecutionResult)
 	app.Post("/v1/projects/:project/locations/:location/workflows/:workflow/executions/:execution\\:cancel", srv.cancelExecution)
 
 	// Callbacks API
 	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions/:execution/callbacks", srv.listCallbacks)
+	app.Get("/v1/projects/:project/locations/:location/workflows/:workflow/executions/:execution/steps", srv.listExecutionSteps)
 	app.Post("/callbacks/:id", srv.sendCallback)
 
 	srv.app = app
@@ -73,9 +82,38 @@ func (s *Server) Listen(addr string) error {
 
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown() error {
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
 	return s.app.Shutdown()
 }
 
+// healthz reports that the server is up. It succeeds as soon as the server is
+// listening.
+func (s *Server) healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// readyz reports whether the server is ready to serve workflows: it fails
+// with 503 while the workflows directory, if any, is still being loaded.
+func (s *Server) readyz(c *fiber.Ctx) error {
+	if s.loading.Load() {
+		return c.Status(503).JSON(fiber.Map{"status": "loading"})
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// SetRunner replaces the runner that executes workflows, e.g. to share one
+// between the REST and gRPC servers.
+func (s *Server) SetRunner(r *runner.Runner) {
+	s.runner = r
+}
+
+// Runner returns the runner that executes workflows.
+func (s *Server) Runner() *runner.Runner {
+	return s.runner
+}
+
 // App returns the underlying Fiber app (useful for testing).
 func (s *Server) App() *fiber.App {
 	return s.app
@@ -101,6 +139,15 @@ func (s *Server) createWorkflow(c *fiber.Ctx) error {
 			},
 		})
 	}
+	if err := store.ValidateWorkflowID(workflowID); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": err.Error(),
+				"status":  "INVALID_ARGUMENT",
+			},
+		})
+	}
 
 	var req createWorkflowRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -124,7 +171,7 @@ func (s *Server) createWorkflow(c *fiber.Ctx) error {
 	}
 
 	// Validate by parsing the workflow
-	wfAST, err := parser.Parse([]byte(req.SourceContents))
+	wfAST, err := s.runner.ParseDefinition([]byte(req.SourceContents))
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -156,13 +203,62 @@ func (s *Server) createWorkflow(c *fiber.Ctx) error {
 	}
 
 	// Cache the parsed workflow
-	s.parsed[wf.Name] = wfAST
+	s.runner.SetParsed(wf.Name, wfAST)
 
 	// Return the workflow resource directly (emulator simplification -
 	// real GCP returns a long-running operation, but we complete immediately)
 	return c.Status(200).JSON(workflowToJSON(wf))
 }
 
+// validateWorkflow parses a workflow source without deploying it, so CI
+// pipelines can lint definitions. Nothing is written to the store.
+func (s *Server) validateWorkflow(c *fiber.Ctx) error {
+	var req createWorkflowRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": fmt.Sprintf("invalid request body: %v", err),
+				"status":  "INVALID_ARGUMENT",
+			},
+		})
+	}
+
+	if req.SourceContents == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": "sourceContents is required",
+				"status":  "INVALID_ARGUMENT",
+			},
+		})
+	}
+
+	if _, err := s.runner.ParseDefinition([]byte(req.SourceContents)); err != nil {
+		detail := fiber.Map{"message": err.Error()}
+		var pe *parser.ParseError
+		if errors.As(err, &pe) {
+			detail = fiber.Map{
+				"message":  pe.Message,
+				"location": pe.Location,
+			}
+		}
+		return c.Status(400).JSON(fiber.Map{
+			"valid": false,
+			"error": fiber.Map{
+				"code":    400,
+				"message": fmt.Sprintf("invalid workflow definition: %v", err),
+				"status":  "INVALID_ARGUMENT",
+				"details": []fiber.Map{detail},
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"valid": true,
+	})
+}
+
 func (s *Server) getWorkflow(c *fiber.Ctx) error {
 	name := buildWorkflowName(c)
 
@@ -177,7 +273,109 @@ func (s *Server) getWorkflow(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(workflowToJSON(wf))
+	view, err := store.ParseWorkflowView(c.Query("view"))
+	if err == nil && c.Query("format") != "" && c.Query("format") != "json" {
+		err = fmt.Errorf("invalid format %q: must be json", c.Query("format"))
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": err.Error(),
+				"status":  "INVALID_ARGUMENT",
+			},
+		})
+	}
+
+	resp := workflowToJSON(wf)
+	switch {
+	case view == store.WorkflowViewBasic:
+		delete(resp, "sourceContents")
+	case c.Query("format") == "json":
+		// Normalized source for tooling that cannot read YAML
+		src, err := parser.CanonicalJSON([]byte(wf.SourceCode))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    500,
+					"message": err.Error(),
+					"status":  "INTERNAL",
+				},
+			})
+		}
+		resp["sourceContents"] = string(src)
+	}
+
+	return c.JSON(resp)
+}
+
+// analyzeWorkflow reports structural metrics for a deployed workflow, to help
+// judge its complexity against GCW limits before deploying it for real.
+func (s *Server) analyzeWorkflow(c *fiber.Ctx) error {
+	name := buildWorkflowName(c)
+
+	wf, err := s.store.GetWorkflow(name)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
+	}
+
+	wfAST, err := s.runner.Parse([]byte(wf.SourceCode))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    500,
+				"message": fmt.Sprintf("failed to parse workflow: %v", err),
+				"status":  "INTERNAL",
+			},
+		})
+	}
+
+	st := wfAST.Stats()
+	return c.JSON(fiber.Map{
+		"name":             wf.Name,
+		"revisionId":       wf.RevisionID,
+		"stepCount":        st.Steps,
+		"maxNestingDepth":  st.MaxNestingDepth,
+		"httpCallCount":    st.HTTPCalls,
+		"subworkflowCount": st.Subworkflows,
+		"usesParallel":     st.UsesParallel,
+	})
+}
+
+// getWorkflowAST returns the parsed form of a deployed workflow as JSON, to
+// show how its source maps to steps.
+func (s *Server) getWorkflowAST(c *fiber.Ctx) error {
+	name := buildWorkflowName(c)
+
+	wf, err := s.store.GetWorkflow(name)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
+	}
+
+	wfAST, err := s.runner.Parse([]byte(wf.SourceCode))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    500,
+				"message": fmt.Sprintf("failed to parse workflow: %v", err),
+				"status":  "INTERNAL",
+			},
+		})
+	}
+
+	return c.JSON(wfAST)
 }
 
 func (s *Server) listWorkflows(c *fiber.Ctx) error {
@@ -210,7 +408,7 @@ func (s *Server) updateWorkflow(c *fiber.Ctx) error {
 
 	if req.SourceContents != "" {
 		// Validate by parsing
-		wfAST, err := parser.Parse([]byte(req.SourceContents))
+		wfAST, err := s.runner.ParseDefinition([]byte(req.SourceContents))
 		if err != nil {
 			return c.Status(400).JSON(fiber.Map{
 				"error": fiber.Map{
@@ -220,7 +418,7 @@ func (s *Server) updateWorkflow(c *fiber.Ctx) error {
 				},
 			})
 		}
-		s.parsed[name] = wfAST
+		s.runner.SetParsed(name, wfAST)
 	}
 
 	wf, err := s.store.UpdateWorkflow(name, req.SourceContents, req.Description)
@@ -255,7 +453,7 @@ func (s *Server) deleteWorkflow(c *fiber.Ctx) error {
 		})
 	}
 
-	delete(s.parsed, name)
+	s.runner.SetParsed(name, nil)
 
 	return c.JSON(fiber.Map{
 		"name": fmt.Sprintf("projects/-/locations/-/operations/delete-%s", c.Params("workflow")),
@@ -286,8 +484,8 @@ func (s *Server) createExecution(c *fiber.Ctx) error {
 	// Parse the argument JSON
 	var args types.Value = types.Null
 	if req.Argument != "" {
-		var raw interface{}
-		if err := json.Unmarshal([]byte(req.Argument), &raw); err != nil {
+		parsed, err := types.ParseJSON([]byte(req.Argument))
+		if err != nil {
 			return c.Status(400).JSON(fiber.Map{
 				"error": fiber.Map{
 					"code":    400,
@@ -296,38 +494,33 @@ func (s *Server) createExecution(c *fiber.Ctx) error {
 				},
 			})
 		}
-		args = types.ValueFromJSON(raw)
+		args = parsed
 	}
 
-	// Get parsed workflow
-	wfAST, ok := s.parsed[workflowName]
-	if !ok {
-		// Try to parse from stored source
-		wf, err := s.store.GetWorkflow(workflowName)
-		if err != nil {
-			return c.Status(404).JSON(fiber.Map{
+	execID := c.Query("executionId")
+	if execID != "" {
+		if err := store.ValidateExecutionID(execID); err != nil {
+			return c.Status(400).JSON(fiber.Map{
 				"error": fiber.Map{
-					"code":    404,
+					"code":    400,
 					"message": err.Error(),
-					"status":  "NOT_FOUND",
-				},
-			})
-		}
-		parsed, err := parser.Parse([]byte(wf.SourceCode))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": fiber.Map{
-					"code":    500,
-					"message": fmt.Sprintf("failed to parse workflow: %v", err),
-					"status":  "INTERNAL",
+					"status":  "INVALID_ARGUMENT",
 				},
 			})
 		}
-		wfAST = parsed
-		s.parsed[workflowName] = wfAST
 	}
 
-	exec, err := s.store.CreateExecution(workflowName, args)
+	if _, err := s.store.GetWorkflow(workflowName); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
+	}
+
+	exec, err := s.runner.Start(workflowName, execID, args)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -338,68 +531,58 @@ func (s *Server) createExecution(c *fiber.Ctx) error {
 		})
 	}
 
-	// Execute the workflow asynchronously
-	go s.runExecution(exec.Name, wfAST, args)
-
 	return c.Status(200).JSON(executionToJSON(exec))
 }
 
-func (s *Server) runExecution(execName string, wfAST *ast.Workflow, args types.Value) {
-	log.Printf("[DEBUG] Starting execution: %s", execName)
-
-	funcs := stdlib.NewRegistry()
-	funcs.RegisterHTTP(&http.Client{Timeout: 30 * time.Second})
-	funcs.RegisterWorkflowExecution(&storeAdapter{s.store}, s.parsed, s.childExecutor())
-
-	engine := runtime.NewEngine(wfAST, funcs)
-
-	// Store engine reference for cancellation
-	s.engines[execName] = engine
-
-	ctx := context.Background()
-	result, err := engine.Execute(ctx, args)
-
-	delete(s.engines, execName)
-
-	if err != nil {
-		log.Printf("[ERROR] Execution %s failed: %v", execName, err)
-		_ = s.store.FailExecution(execName, err)
-	} else {
-		log.Printf("[DEBUG] Execution %s completed successfully", execName)
-		_ = s.store.CompleteExecution(execName, result)
-	}
+// StartExecution creates an execution of the named workflow and runs it in the
+// background, exactly as the Create Execution endpoint does. It lets other
+// front ends, such as the web UI, trigger executions.
+func (s *Server) StartExecution(workflowName string, args types.Value) (*store.Execution, error) {
+	return s.runner.Start(workflowName, "", args)
 }
 
-// childExecutor returns a ChildExecutor that creates a fresh engine for each
-// child workflow execution, with all stdlib functions registered.
-func (s *Server) childExecutor() stdlib.ChildExecutor {
-	return func(wfAST *ast.Workflow, args types.Value) (types.Value, error) {
-		funcs := stdlib.NewRegistry()
-		funcs.RegisterHTTP(&http.Client{Timeout: 30 * time.Second})
-		funcs.RegisterWorkflowExecution(&storeAdapter{s.store}, s.parsed, s.childExecutor())
+func (s *Server) getExecution(c *fiber.Ctx) error {
+	name := buildExecutionName(c)
 
-		engine := runtime.NewEngine(wfAST, funcs)
-		return engine.Execute(context.Background(), args)
+	exec, err := s.store.GetExecution(name)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
 	}
-}
 
-// storeAdapter adapts *store.Store to the stdlib.WorkflowStore interface.
-type storeAdapter struct {
-	s *store.Store
+	return c.JSON(executionToJSON(exec))
 }
 
-func (a *storeAdapter) FindWorkflowByID(workflowID string) (stdlib.WorkflowInfo, error) {
-	wf, err := a.s.FindWorkflowByID(workflowID)
+// getLatestExecution returns the workflow's most recently created execution,
+// sparing a local debugging session from listing executions to find it.
+func (s *Server) getLatestExecution(c *fiber.Ctx) error {
+	exec, err := s.store.LatestExecution(buildWorkflowName(c))
 	if err != nil {
-		return stdlib.WorkflowInfo{}, err
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
 	}
-	return stdlib.WorkflowInfo{
-		Name:       wf.Name,
-		SourceCode: wf.SourceCode,
-	}, nil
+
+	return c.JSON(executionToJSON(exec))
 }
 
-func (s *Server) getExecution(c *fiber.Ctx) error {
+// resultChunkSize is the size of the chunks getExecutionResult writes.
+const resultChunkSize = 64 * 1024
+
+// getExecutionResult streams the JSON result of a succeeded execution as the
+// raw response body, using chunked transfer encoding. Unlike getExecution it
+// does not re-encode the result as a JSON string, so multi-megabyte results
+// are neither escaped nor copied into a second buffer.
+func (s *Server) getExecutionResult(c *fiber.Ctx) error {
 	name := buildExecutionName(c)
 
 	exec, err := s.store.GetExecution(name)
@@ -412,34 +595,65 @@ func (s *Server) getExecution(c *fiber.Ctx) error {
 			},
 		})
 	}
+	if exec.State != store.ExecutionSucceeded {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": fmt.Sprintf("execution %s has no result: state is %s", name, exec.State),
+				"status":  "FAILED_PRECONDITION",
+			},
+		})
+	}
 
-	return c.JSON(executionToJSON(exec))
+	result := exec.Result
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for len(result) > 0 {
+			n := min(resultChunkSize, len(result))
+			if _, err := w.WriteString(result[:n]); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			result = result[n:]
+		}
+	})
+	return nil
 }
 
 func (s *Server) listExecutions(c *fiber.Ctx) error {
 	workflowName := buildWorkflowName(c)
-	executions := s.store.ListExecutions(workflowName)
+	executions, nextPageToken, err := s.store.ListExecutionsPage(
+		workflowName, c.QueryInt("pageSize", 0), c.Query("pageToken"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    400,
+				"message": err.Error(),
+				"status":  "INVALID_ARGUMENT",
+			},
+		})
+	}
 
 	items := make([]fiber.Map, len(executions))
 	for i, exec := range executions {
 		items[i] = executionToJSON(exec)
 	}
 
-	return c.JSON(fiber.Map{
+	resp := fiber.Map{
 		"executions": items,
-	})
+	}
+	if nextPageToken != "" {
+		resp["nextPageToken"] = nextPageToken
+	}
+	return c.JSON(resp)
 }
 
 func (s *Server) cancelExecution(c *fiber.Ctx) error {
 	name := buildExecutionName(c)
 
-	// Cancel the engine if running
-	if engine, ok := s.engines[name]; ok {
-		engine.Cancel()
-	}
-
-	err := s.store.CancelExecution(name)
-	if err != nil {
+	if err := s.runner.Cancel(name); err != nil {
 		status := 404
 		errStatus := "NOT_FOUND"
 		if strings.Contains(err.Error(), "not active") {
@@ -480,75 +694,48 @@ func (s *Server) listCallbacks(c *fiber.Ctx) error {
 	})
 }
 
-func (s *Server) sendCallback(c *fiber.Ctx) error {
-	// Placeholder for callback handling
-	return c.JSON(fiber.Map{
-		"status": "ok",
-	})
-}
-
-// --- Directory Loading ---
-
-var validWorkflowID = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
-
-// WatchDir loads all .yaml and .json workflow files from the given directory
-// and deploys them as workflows. File name (sans extension) becomes the workflow ID.
-func (s *Server) WatchDir(dir, project, location string) error {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return fmt.Errorf("reading workflows directory: %w", err)
+// listExecutionSteps returns the steps an execution has run so far, in the
+// order they started, with their state and timing. It is an emulator
+// extension for progress views; GCW has no equivalent.
+func (s *Server) listExecutionSteps(c *fiber.Ctx) error {
+	execName := buildExecutionName(c)
+	if _, err := s.store.GetExecution(execName); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    404,
+				"message": err.Error(),
+				"status":  "NOT_FOUND",
+			},
+		})
 	}
 
-	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
-	loaded := 0
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		ext := filepath.Ext(name)
-		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
-			continue
-		}
-
-		base := strings.TrimSuffix(name, ext)
-		workflowID := strings.ToLower(base)
-
-		if workflowID != base {
-			log.Printf("Warning: lowercased workflow ID %q (from file %q)", workflowID, name)
+	events := s.store.ListSteps(execName)
+	items := make([]fiber.Map, len(events))
+	for i, ev := range events {
+		item := fiber.Map{
+			"name":      ev.Name,
+			"state":     ev.State,
+			"startTime": ev.StartTime.Format(time.RFC3339Nano),
 		}
-
-		if !validWorkflowID.MatchString(workflowID) || len(workflowID) > 128 {
-			log.Printf("Warning: skipping file %q — invalid workflow ID %q", name, workflowID)
-			continue
+		if !ev.EndTime.IsZero() {
+			item["endTime"] = ev.EndTime.Format(time.RFC3339Nano)
 		}
-
-		data, err := os.ReadFile(filepath.Join(dir, name))
-		if err != nil {
-			log.Printf("Warning: could not read %q: %v", name, err)
-			continue
+		if ev.Error != "" {
+			item["error"] = ev.Error
 		}
-
-		wfAST, err := parser.Parse(data)
-		if err != nil {
-			log.Printf("Warning: could not parse %q: %v", name, err)
-			continue
-		}
-
-		wf, err := s.store.CreateWorkflow(parent, workflowID, string(data), "")
-		if err != nil {
-			log.Printf("Warning: could not deploy %q: %v", name, err)
-			continue
-		}
-
-		s.parsed[wf.Name] = wfAST
-		loaded++
-		log.Printf("Loaded workflow %q from %s", workflowID, name)
+		items[i] = item
 	}
 
-	log.Printf("Loaded %d workflow(s) from %s", loaded, dir)
-	return nil
+	return c.JSON(fiber.Map{
+		"steps": items,
+	})
+}
+
+func (s *Server) sendCallback(c *fiber.Ctx) error {
+	// Placeholder for callback handling
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
 }
 
 // --- Helpers ---
@@ -0,0 +1,1074 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runtime"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+)
+
+func TestMaxConcurrentExecutionsQueues(t *testing.T) {
+	const limit = 2
+	const total = 5
+
+	s := store.New()
+	srv := New(s)
+	limiter := runtime.NewExecutionLimiter(limit)
+	srv.Runner().SetExecutionLimiter(limiter)
+
+	wf, err := s.CreateWorkflow(testParent, "slow",
+		"main:\n  steps:\n    - wait:\n        call: sys.sleep\n        args:\n          seconds: 0.2\n    - done:\n        return: 1\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	for i := 0; i < total; i++ {
+		req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := srv.App().Test(req, -1)
+		if err != nil {
+			t.Fatalf("create execution: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("create execution: status %d", resp.StatusCode)
+		}
+	}
+
+	sawQueued := false
+	waitFor(t, "all executions to finish", func() bool {
+		counts := make(map[store.ExecutionState]int)
+		for _, e := range s.ListExecutions(wf.Name) {
+			counts[e.State]++
+		}
+		if counts[store.ExecutionActive] > limit {
+			t.Fatalf("%d executions running, limit is %d", counts[store.ExecutionActive], limit)
+		}
+		if n := limiter.Running(); n > limit {
+			t.Fatalf("%d execution slots taken, limit is %d", n, limit)
+		}
+		if counts[store.ExecutionQueued] > 0 {
+			sawQueued = true
+		}
+		time.Sleep(5 * time.Millisecond)
+		return counts[store.ExecutionSucceeded] == total
+	})
+
+	if !sawQueued {
+		t.Errorf("expected some of %d executions to be QUEUED with limit %d", total, limit)
+	}
+}
+
+func TestQueuedExecutionsStartInOrder(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	srv.Runner().SetExecutionLimiter(runtime.NewExecutionLimiter(1))
+
+	wf, err := s.CreateWorkflow(testParent, "in-order",
+		"main:\n  steps:\n    - wait:\n        call: sys.sleep\n        args:\n          seconds: 0.02\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	var names []string
+	for i := 0; i < 6; i++ {
+		exec, err := srv.StartExecution(wf.Name, types.Null)
+		if err != nil {
+			t.Fatalf("start execution: %v", err)
+		}
+		names = append(names, exec.Name)
+	}
+	waitFor(t, "all executions to finish", func() bool {
+		for _, e := range s.ListExecutions(wf.Name) {
+			if e.State != store.ExecutionSucceeded {
+				return false
+			}
+		}
+		return true
+	})
+
+	// With one slot, each execution's step starts after the previous one's
+	var prev time.Time
+	for i, name := range names {
+		steps := s.ListSteps(name)
+		if len(steps) == 0 {
+			t.Fatalf("execution %d recorded no steps", i)
+		}
+		if steps[0].StartTime.Before(prev) {
+			t.Errorf("execution %d started before execution %d", i, i-1)
+		}
+		prev = steps[0].StartTime
+	}
+}
+
+func TestExecutionTimeoutFailsExecution(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	srv.Runner().SetExecutionTimeout(200 * time.Millisecond)
+
+	wf, err := s.CreateWorkflow(testParent, "sleepy",
+		"main:\n  steps:\n    - loop:\n        for:\n          value: i\n          range: [1, 30]\n          steps:\n            - wait:\n                call: sys.sleep\n                args:\n                  seconds: 1\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := srv.App().Test(req, -1); err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+
+	var exec *store.Execution
+	waitFor(t, "execution to fail", func() bool {
+		execs := s.ListExecutions(wf.Name)
+		if len(execs) != 1 || execs[0].State == store.ExecutionActive {
+			return false
+		}
+		exec = execs[0]
+		return true
+	})
+
+	if exec.State != store.ExecutionFailed {
+		t.Fatalf("expected FAILED, got %s", exec.State)
+	}
+	if !strings.Contains(exec.Error.Payload, "TimeoutError") {
+		t.Errorf("expected TimeoutError in payload, got %s", exec.Error.Payload)
+	}
+}
+
+func TestChildExecutionEndsWithItsParent(t *testing.T) {
+	const sleeper = "main:\n  steps:\n    - loop:\n        for:\n          value: i\n          range: [1, 30]\n          steps:\n            - wait:\n                call: sys.sleep\n                args:\n                  seconds: 1\n"
+	const parent = "main:\n  steps:\n    - run_child:\n        call: googleapis.workflowexecutions.v1.projects.locations.workflows.executions.run\n        args:\n          workflow_id: sleeper\n        result: r\n"
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		want    store.ExecutionState
+	}{
+		{"parent times out", 200 * time.Millisecond, false, store.ExecutionFailed},
+		{"parent is cancelled", 0, true, store.ExecutionCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.New()
+			srv := New(s)
+			quiet, _ := logging.New(logging.FormatText, io.Discard)
+			srv.Runner().SetLogger(quiet)
+			srv.Runner().SetExecutionTimeout(tt.timeout)
+
+			if _, err := s.CreateWorkflow(testParent, "sleeper", sleeper, ""); err != nil {
+				t.Fatalf("create child workflow: %v", err)
+			}
+			wf, err := s.CreateWorkflow(testParent, "parent", parent, "")
+			if err != nil {
+				t.Fatalf("create parent workflow: %v", err)
+			}
+			exec, err := srv.StartExecution(wf.Name, types.Null)
+			if err != nil {
+				t.Fatalf("start execution: %v", err)
+			}
+			waitFor(t, "child to start", func() bool { return len(s.ListSteps(exec.Name)) > 0 })
+			if tt.cancel {
+				if err := srv.Runner().Cancel(exec.Name); err != nil {
+					t.Fatalf("cancel: %v", err)
+				}
+			}
+
+			// The parent waits for its child, which would sleep for 30s
+			// if it kept running
+			waitFor(t, "parent to stop", func() bool { return !srv.Runner().Running(exec.Name) })
+			got, _ := s.GetExecution(exec.Name)
+			if got.State != tt.want {
+				t.Fatalf("state = %s, want %s (error %+v)", got.State, tt.want, got.Error)
+			}
+			if !tt.cancel && !strings.Contains(got.Error.Payload, "TimeoutError") {
+				t.Errorf("expected TimeoutError in payload, got %s", got.Error.Payload)
+			}
+		})
+	}
+}
+
+func TestLimitsLowerStepLimit(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	srv.Runner().SetLimits(runtime.Limits{MaxSteps: 10})
+
+	// 20 loop iterations fit the default limit but not a limit of 10
+	wf, err := s.CreateWorkflow(testParent, "loop",
+		"main:\n  steps:\n    - loop:\n        for:\n          value: i\n          range: [1, 20]\n          steps:\n            - noop:\n                assign:\n                  - x: ${i}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := srv.App().Test(req, -1); err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+
+	var exec *store.Execution
+	waitFor(t, "execution to finish", func() bool {
+		execs := s.ListExecutions(wf.Name)
+		if len(execs) != 1 || execs[0].State == store.ExecutionActive {
+			return false
+		}
+		exec = execs[0]
+		return true
+	})
+
+	if exec.State != store.ExecutionFailed {
+		t.Fatalf("expected FAILED, got %s", exec.State)
+	}
+	if !strings.Contains(exec.Error.Payload, "step limit of 10") {
+		t.Errorf("expected the lowered step limit in payload, got %s", exec.Error.Payload)
+	}
+}
+
+func TestDeployRejectsOversizedWorkflow(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	deploy := func(method, path, source string) (int, string) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"sourceContents": source})
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := srv.App().Test(req, -1)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		msg, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(msg)
+	}
+
+	var huge strings.Builder
+	// Compact flow-style steps keep the source under the 128 KB size limit
+	huge.WriteString("main:\n steps:\n")
+	for i := 0; i <= runtime.MaxDefinitionSteps; i++ {
+		fmt.Fprintf(&huge, " - s%d: {return: 1}\n", i)
+	}
+	code, msg := deploy("POST", "/v1/"+testParent+"/workflows?workflowId=huge", huge.String())
+	if code != 400 {
+		t.Fatalf("deploy huge workflow: status %d, want 400", code)
+	}
+	if !strings.Contains(msg, "INVALID_ARGUMENT") || !strings.Contains(msg, "5001 steps, exceeding the limit of 5000") {
+		t.Errorf("deploy huge workflow: unexpected error %s", msg)
+	}
+	if _, err := s.GetWorkflow(testParent + "/workflows/huge"); err == nil {
+		t.Error("oversized workflow was stored")
+	}
+
+	// Updates are checked against the configured limits too
+	srv.Runner().SetLimits(runtime.Limits{MaxSubworkflows: 1})
+	small := "main:\n  steps:\n    - done:\n        return: 1\n"
+	if code, msg := deploy("POST", "/v1/"+testParent+"/workflows?workflowId=small", small); code != 200 {
+		t.Fatalf("deploy small workflow: status %d: %s", code, msg)
+	}
+	twoSubs := small + "a:\n  steps:\n    - r:\n        return: 1\nb:\n  steps:\n    - r:\n        return: 2\n"
+	code, msg = deploy("PATCH", "/v1/"+testParent+"/workflows/small", twoSubs)
+	if code != 400 || !strings.Contains(msg, "2 subworkflows, exceeding the limit of 1") {
+		t.Errorf("update with two subworkflows: status %d: %s", code, msg)
+	}
+}
+
+func TestDeterministicSleepIsVirtual(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	srv.Runner().SetDeterministic(true)
+
+	wf, err := s.CreateWorkflow(testParent, "sleeper",
+		"main:\n  steps:\n    - start:\n        assign:\n          - t0: ${sys.now()}\n    - wait:\n        call: sys.sleep\n        args:\n          seconds: 10\n    - done:\n        return: ${sys.now() - t0}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	started := time.Now()
+	req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := srv.App().Test(req, -1); err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+
+	var exec *store.Execution
+	waitFor(t, "execution to finish", func() bool {
+		execs := s.ListExecutions(wf.Name)
+		if len(execs) != 1 || execs[0].State == store.ExecutionActive {
+			return false
+		}
+		exec = execs[0]
+		return true
+	})
+	elapsed := time.Since(started)
+
+	if exec.State != store.ExecutionSucceeded {
+		t.Fatalf("expected SUCCEEDED, got %s", exec.State)
+	}
+	if exec.Result != "10.0" {
+		t.Errorf("logical duration = %s, want 10.0", exec.Result)
+	}
+	// The default clock would still pause for a second
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("execution took %v of wall-clock time", elapsed)
+	}
+}
+
+func TestDeterministicParallelTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string
+		want  string
+	}{
+		{"branches overlap", `
+    - work:
+        parallel:
+          branches:
+            - short:
+                steps:
+                  - wait:
+                      call: sys.sleep
+                      args:
+                        seconds: 10
+            - long:
+                steps:
+                  - wait:
+                      call: sys.sleep
+                      args:
+                        seconds: 20`, "20.0"},
+		{"concurrency limit runs iterations in turn", `
+    - work:
+        parallel:
+          concurrency_limit: 1
+          for:
+            value: s
+            in: [10, 20]
+            steps:
+              - wait:
+                  call: sys.sleep
+                  args:
+                    seconds: ${s}`, "30.0"},
+		{"retry backoff", `
+    - work:
+        try:
+          raise: "boom"
+        retry:
+          max_retries: 2
+          backoff:
+            initial_delay: 5
+            max_delay: 60
+            multiplier: 2
+        except:
+          as: e
+          steps:
+            - swallow:
+                assign:
+                  - caught: ${e}`, "15.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.New()
+			srv := New(s)
+			srv.Runner().SetDeterministic(true)
+
+			wf, err := s.CreateWorkflow(testParent, "timed",
+				"main:\n  steps:\n    - start:\n        assign:\n          - t0: ${sys.now()}"+
+					tt.steps+"\n    - done:\n        return: ${sys.now() - t0}\n", "")
+			if err != nil {
+				t.Fatalf("create workflow: %v", err)
+			}
+			exec, err := srv.StartExecution(wf.Name, types.Null)
+			if err != nil {
+				t.Fatalf("start execution: %v", err)
+			}
+			waitFor(t, "execution to finish", func() bool {
+				e, err := s.GetExecution(exec.Name)
+				if err != nil || e.State == store.ExecutionActive {
+					return false
+				}
+				exec = e
+				return true
+			})
+
+			if exec.State != store.ExecutionSucceeded {
+				t.Fatalf("expected SUCCEEDED, got %s (%v)", exec.State, exec.Error)
+			}
+			if exec.Result != tt.want {
+				t.Errorf("logical duration = %s, want %s", exec.Result, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	srv := New(store.New())
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := srv.App().Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("/healthz"); got != 200 {
+		t.Errorf("/healthz = %d, want 200", got)
+	}
+	if got := status("/readyz"); got != 200 {
+		t.Errorf("/readyz without a watched dir = %d, want 200", got)
+	}
+
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes from executions.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestJSONLogsCarryExecutionName(t *testing.T) {
+	var out syncBuffer
+	logger, err := logging.New(logging.FormatJSON, &out)
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+
+	s := store.New()
+	srv := New(s)
+	srv.Runner().SetLogger(logger)
+
+	wf, err := s.CreateWorkflow(testParent, "logged",
+		"main:\n  steps:\n    - done:\n        return: 1\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	exec, err := srv.StartExecution(wf.Name, types.Null)
+	if err != nil {
+		t.Fatalf("start execution: %v", err)
+	}
+
+	var completion map[string]any
+	waitFor(t, "completion log record", func() bool {
+		for _, line := range strings.Split(out.String(), "\n") {
+			var rec map[string]any
+			if json.Unmarshal([]byte(line), &rec) == nil && rec["msg"] == "execution succeeded" {
+				completion = rec
+				return true
+			}
+		}
+		return false
+	})
+
+	if got := completion[logging.KeyExecution]; got != exec.Name {
+		t.Errorf("execution field = %v, want %q", got, exec.Name)
+	}
+	if got := completion[logging.KeyWorkflow]; got != wf.Name {
+		t.Errorf("workflow field = %v, want %q", got, wf.Name)
+	}
+}
+
+func TestGetWorkflowView(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	source := "main:\n  steps:\n    - done:\n        return: 1\n"
+	wf, err := s.CreateWorkflow(testParent, "viewed", source, "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	get := func(query string) (int, map[string]any) {
+		t.Helper()
+		resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+wf.Name+query, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode %s: %v", query, err)
+		}
+		return resp.StatusCode, body
+	}
+
+	if _, body := get("?view=BASIC"); body["sourceContents"] != nil {
+		t.Errorf("BASIC view returned sourceContents %q", body["sourceContents"])
+	}
+	for _, query := range []string{"", "?view=FULL", "?view=WORKFLOW_VIEW_FULL"} {
+		if _, body := get(query); body["sourceContents"] != source {
+			t.Errorf("GET %q: sourceContents = %q, want the stored source", query, body["sourceContents"])
+		}
+	}
+
+	want := `{"main":{"steps":[{"done":{"return":1}}]}}`
+	if _, body := get("?format=json"); body["sourceContents"] != want {
+		t.Errorf("format=json: sourceContents = %v, want %s", body["sourceContents"], want)
+	}
+
+	for _, query := range []string{"?view=SHORT", "?format=xml"} {
+		if code, _ := get(query); code != 400 {
+			t.Errorf("GET %q: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestAnalyzeWorkflow(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	source := `
+main:
+  steps:
+    - fetch:
+        call: http.get
+        args:
+          url: http://example.com
+        result: resp
+    - fan_out:
+        parallel:
+          branches:
+            - a:
+                steps:
+                  - post:
+                      call: http.post
+                      args:
+                        url: http://example.com
+            - b:
+                steps:
+                  - loop:
+                      for:
+                        value: i
+                        range: [1, 3]
+                        steps:
+                          - add:
+                              assign:
+                                - x: ${i}
+    - done:
+        call: helper
+        result: out
+helper:
+  steps:
+    - ret:
+        return: 1
+`
+	wf, err := s.CreateWorkflow(testParent, "analyzed", source, "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+wf.Name+":analyze", nil), -1)
+	if err != nil {
+		t.Fatalf("GET :analyze: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := map[string]any{
+		"stepCount":        float64(7),
+		"maxNestingDepth":  float64(3),
+		"httpCallCount":    float64(2),
+		"subworkflowCount": float64(1),
+		"usesParallel":     true,
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %v", k, body[k], v)
+		}
+	}
+
+	resp, err = srv.App().Test(httptest.NewRequest("GET", "/v1/"+testParent+"/workflows/missing:analyze", nil), -1)
+	if err != nil {
+		t.Fatalf("GET missing:analyze: %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("missing workflow: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestGetWorkflowAST(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	source := `
+main:
+  params: [args]
+  steps:
+    - check:
+        switch:
+          - condition: ${args.n > 10}
+            next: big
+          - condition: true
+            steps:
+              - small:
+                  return: "small"
+    - big:
+        for:
+          value: i
+          range: [1, 2]
+          steps:
+            - noop:
+                assign:
+                  - x: ${i}
+`
+	wf, err := s.CreateWorkflow(testParent, "ast", source, "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+wf.Name+":ast", nil), -1)
+	if err != nil {
+		t.Fatalf("GET :ast: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	var got struct {
+		Main struct {
+			Params []struct {
+				Name string `json:"name"`
+			} `json:"params"`
+			Steps []map[string]any `json:"steps"`
+		} `json:"main"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(got.Main.Params) != 1 || got.Main.Params[0].Name != "args" {
+		t.Errorf("params = %v, want [args]", got.Main.Params)
+	}
+	if len(got.Main.Steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(got.Main.Steps))
+	}
+	conds, _ := got.Main.Steps[0]["switch"].([]any)
+	if len(conds) != 2 {
+		t.Fatalf("switch = %v, want 2 conditions", got.Main.Steps[0]["switch"])
+	}
+	first := conds[0].(map[string]any)
+	if first["condition"] != "${args.n > 10}" || first["next"] != "big" {
+		t.Errorf("first condition = %v", first)
+	}
+	second := conds[1].(map[string]any)
+	if second["condition"] != true || second["steps"] == nil {
+		t.Errorf("second condition = %v", second)
+	}
+	loop, _ := got.Main.Steps[1]["for"].(map[string]any)
+	if loop["value"] != "i" || loop["range"] == nil {
+		t.Errorf("for = %v, want value i with a range", loop)
+	}
+}
+
+func TestExecutionArgumentKeepsKeyOrder(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	wf, err := s.CreateWorkflow(testParent, "ordered",
+		"main:\n  params: [args]\n  steps:\n    - done:\n        return: ${keys(args)}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions",
+		strings.NewReader(`{"argument": "{\"b\": 1, \"a\": 2}"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.App().Test(req, -1)
+	if err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+	var created struct{ Name string }
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode execution: %v", err)
+	}
+
+	var exec *store.Execution
+	waitFor(t, "execution to finish", func() bool {
+		exec, err = s.GetExecution(created.Name)
+		return err == nil && exec.State != store.ExecutionActive && exec.State != store.ExecutionQueued
+	})
+	if exec.State != store.ExecutionSucceeded {
+		t.Fatalf("execution %s: %+v", exec.State, exec.Error)
+	}
+	if want := `["b","a"]`; exec.Result != want {
+		t.Errorf("keys(args) = %s, want %s", exec.Result, want)
+	}
+}
+
+func TestExecutionKeepsDoubleResults(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	wf, err := s.CreateWorkflow(testParent, "doubles",
+		"main:\n  params: [args]\n  steps:\n    - done:\n        return: ${[10.0 / 2, type(10.0 / 2), args.d, type(args.d), args.i, type(args.i)]}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/"+wf.Name+"/executions",
+		strings.NewReader(`{"argument": "{\"d\": 5.0, \"i\": 5}"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.App().Test(req, -1)
+	if err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+	var created struct{ Name string }
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode execution: %v", err)
+	}
+
+	var exec *store.Execution
+	waitFor(t, "execution to finish", func() bool {
+		exec, err = s.GetExecution(created.Name)
+		return err == nil && exec.State != store.ExecutionActive && exec.State != store.ExecutionQueued
+	})
+	if exec.State != store.ExecutionSucceeded {
+		t.Fatalf("execution %s: %+v", exec.State, exec.Error)
+	}
+	if want := `[5.0,"double",5.0,"double",5,"int"]`; exec.Result != want {
+		t.Errorf("result = %s, want %s", exec.Result, want)
+	}
+}
+
+func TestExecutionResultIsStreamed(t *testing.T) {
+	const size = 5000
+
+	s := store.New()
+	srv := New(s)
+	quiet, _ := logging.New(logging.FormatText, io.Discard)
+	srv.Runner().SetLogger(quiet)
+
+	wf, err := s.CreateWorkflow(testParent, "big-result",
+		"main:\n  steps:\n    - build:\n        assign:\n          - items: []\n    - loop:\n        for:\n          value: i\n          range: [1, 5000]\n          steps:\n            - add:\n                assign:\n                  - items: ${list.concat(items, \"item-\" + string(i))}\n    - done:\n        return: ${items}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	exec, err := srv.StartExecution(wf.Name, types.Null)
+	if err != nil {
+		t.Fatalf("start execution: %v", err)
+	}
+	waitFor(t, "execution to finish", func() bool {
+		e, err := s.GetExecution(exec.Name)
+		return err == nil && e.State != store.ExecutionActive
+	})
+
+	resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+exec.Name+"/result", nil), -1)
+	if err != nil {
+		t.Fatalf("GET result: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET result: status %d", resp.StatusCode)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("transfer encoding = %v, want chunked", resp.TransferEncoding)
+	}
+
+	var items []string
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if len(items) != size {
+		t.Fatalf("got %d items, want %d", len(items), size)
+	}
+	if items[size-1] != "item-5000" {
+		t.Errorf("last item = %q, want item-5000", items[size-1])
+	}
+}
+
+func TestExecutionsShareOneParse(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	// Created directly in the store, so the server has not parsed it yet
+	wf, err := s.CreateWorkflow(testParent, "parsed-once",
+		"main:\n  steps:\n    - done:\n        return: 1\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := srv.StartExecution(wf.Name, types.Null); err != nil {
+			t.Fatalf("start execution %d: %v", i, err)
+		}
+		// Even with the per-workflow entry evicted, the source is not re-parsed
+		srv.runner.SetParsed(wf.Name, nil)
+	}
+
+	if n := srv.runner.Parses(); n != 1 {
+		t.Errorf("workflow source parsed %d times, want 1", n)
+	}
+}
+
+func TestGetWorkflowReturnsOriginalSource(t *testing.T) {
+	srv := New(store.New())
+
+	source := "# Builds a greeting\nmain:\n  steps:\n    - init:\n        assign:\n          # map literal, rewritten before YAML parsing\n          - m: ${{\"greeting\": \"hi\"}}   # trailing comment\n    - done:\n        return: ${m.greeting}\n"
+	body, _ := json.Marshal(map[string]string{"sourceContents": source})
+
+	req := httptest.NewRequest("POST", "/v1/"+testParent+"/workflows?workflowId=commented", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.App().Test(req, -1)
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("create workflow: status %d", resp.StatusCode)
+	}
+
+	resp, err = srv.App().Test(httptest.NewRequest("GET", "/v1/"+testParent+"/workflows/commented", nil), -1)
+	if err != nil {
+		t.Fatalf("get workflow: %v", err)
+	}
+	var wf struct {
+		SourceContents string `json:"sourceContents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&wf); err != nil {
+		t.Fatalf("decode workflow: %v", err)
+	}
+	if wf.SourceContents != source {
+		t.Errorf("sourceContents changed on round trip:\ngot:  %q\nwant: %q", wf.SourceContents, source)
+	}
+}
+
+func TestSysGetEnvDescribesExecution(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	wf, err := s.CreateWorkflow(testParent, "whoami",
+		`main:
+  steps:
+    - done:
+        return:
+          - ${sys.get_env("GOOGLE_CLOUD_PROJECT_ID")}
+          - ${sys.get_env("GOOGLE_CLOUD_LOCATION")}
+          - ${sys.get_env("GOOGLE_CLOUD_WORKFLOW_ID")}
+          - ${sys.get_env("GOOGLE_CLOUD_WORKFLOW_REVISION_ID")}
+          - ${sys.get_env("GOOGLE_CLOUD_WORKFLOW_EXECUTION_ID")}
+`, "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	exec, err := srv.StartExecution(wf.Name, types.Null)
+	if err != nil {
+		t.Fatalf("start execution: %v", err)
+	}
+	waitFor(t, "execution to finish", func() bool {
+		exec, err = s.GetExecution(exec.Name)
+		return err == nil && exec.State != store.ExecutionActive
+	})
+	if exec.State != store.ExecutionSucceeded {
+		t.Fatalf("execution %s: %+v", exec.State, exec.Error)
+	}
+
+	execID := exec.Name[strings.LastIndex(exec.Name, "/")+1:]
+	want, _ := json.Marshal([]string{"test-project", "us-central1", "whoami", wf.RevisionID, execID})
+	if exec.Result != string(want) {
+		t.Errorf("result = %s, want %s", exec.Result, want)
+	}
+}
+
+func TestListExecutionSteps(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	wf, err := s.CreateWorkflow(testParent, "three-steps",
+		"main:\n  steps:\n    - first:\n        assign:\n          - x: 1\n    - second:\n        call: sys.sleep\n        args:\n          seconds: 0.01\n    - third:\n        return: ${x}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	exec, err := srv.StartExecution(wf.Name, types.Null)
+	if err != nil {
+		t.Fatalf("start execution: %v", err)
+	}
+	waitFor(t, "execution to finish", func() bool {
+		e, err := s.GetExecution(exec.Name)
+		return err == nil && e.State != store.ExecutionActive
+	})
+
+	resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+exec.Name+"/steps", nil), -1)
+	if err != nil {
+		t.Fatalf("GET steps: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET steps: status %d", resp.StatusCode)
+	}
+	var body struct {
+		Steps []struct {
+			Name      string
+			State     string
+			StartTime time.Time
+			EndTime   time.Time
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode steps: %v", err)
+	}
+
+	want := []string{"first", "second", "third"}
+	if len(body.Steps) != len(want) {
+		t.Fatalf("got %d steps, want %d: %+v", len(body.Steps), len(want), body.Steps)
+	}
+	var prevEnd time.Time
+	for i, step := range body.Steps {
+		if step.Name != want[i] || step.State != "SUCCEEDED" {
+			t.Errorf("step %d = %s %s, want %s SUCCEEDED", i, step.Name, step.State, want[i])
+		}
+		if step.StartTime.IsZero() || step.EndTime.Before(step.StartTime) {
+			t.Errorf("step %s: start %v, end %v", step.Name, step.StartTime, step.EndTime)
+		}
+		if step.StartTime.Before(prevEnd) {
+			t.Errorf("step %s started at %v, before the previous step ended at %v", step.Name, step.StartTime, prevEnd)
+		}
+		prevEnd = step.EndTime
+	}
+	if d := body.Steps[1].EndTime.Sub(body.Steps[1].StartTime); d < 10*time.Millisecond {
+		t.Errorf("sleep step took %v, want at least 10ms", d)
+	}
+
+	resp, err = srv.App().Test(httptest.NewRequest("GET", "/v1/"+wf.Name+"/executions/missing/steps", nil), -1)
+	if err != nil {
+		t.Fatalf("GET steps: %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("GET steps of missing execution: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestCancelledExecutionEndsCancelled(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	quiet, _ := logging.New(logging.FormatText, io.Discard)
+	srv.Runner().SetLogger(quiet)
+
+	// The loop keeps the execution busy, and its try block would turn a
+	// catchable cancellation into a failure
+	wf, err := s.CreateWorkflow(testParent, "cancel-me",
+		"main:\n  steps:\n    - guarded:\n        try:\n          steps:\n            - loop:\n                for:\n                  value: i\n                  range: [1, 100000]\n                  steps:\n                    - tick:\n                        assign:\n                          - x: ${i}\n        except:\n          as: e\n          steps:\n            - fail:\n                raise: ${e}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	for run := 0; run < 50; run++ {
+		exec, err := srv.StartExecution(wf.Name, types.Null)
+		if err != nil {
+			t.Fatalf("start execution: %v", err)
+		}
+		waitFor(t, "execution to start running steps", func() bool {
+			return len(s.ListSteps(exec.Name)) > 0
+		})
+
+		resp, err := srv.App().Test(httptest.NewRequest("POST", "/v1/"+exec.Name+":cancel", nil), -1)
+		if err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("run %d: cancel: status %d", run, resp.StatusCode)
+		}
+
+		// Once the engine is gone, the runner has recorded its outcome
+		waitFor(t, "engine to stop", func() bool {
+			return !srv.runner.Running(exec.Name)
+		})
+		got, _ := s.GetExecution(exec.Name)
+		if got.State != store.ExecutionCancelled {
+			t.Fatalf("run %d: state = %s, want CANCELLED (error %+v)", run, got.State, got.Error)
+		}
+	}
+}
+
+func TestCancelRightAfterCreateRunsNoSteps(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+	limiter := runtime.NewExecutionLimiter(0)
+	srv.Runner().SetExecutionLimiter(limiter)
+
+	wf, err := s.CreateWorkflow(testParent, "cancel-early",
+		"main:\n  steps:\n    - first:\n        assign:\n          - x: 1\n    - done:\n        return: ${x}\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+
+	for run := 0; run < 50; run++ {
+		exec, err := srv.StartExecution(wf.Name, types.Null)
+		if err != nil {
+			t.Fatalf("start execution: %v", err)
+		}
+		if err := srv.Runner().Cancel(exec.Name); err != nil {
+			t.Fatalf("run %d: cancel: %v", run, err)
+		}
+
+		// The run goroutine holds a slot until it has recorded its outcome
+		waitFor(t, "execution to finish", func() bool {
+			return limiter.Running() == 0
+		})
+		got, _ := s.GetExecution(exec.Name)
+		if got.State != store.ExecutionCancelled {
+			t.Fatalf("run %d: state = %s, want CANCELLED", run, got.State)
+		}
+		if steps := s.ListSteps(exec.Name); len(steps) > 0 {
+			t.Fatalf("run %d: %d steps ran after the execution was cancelled", run, len(steps))
+		}
+	}
+}
+
+func TestGetLatestExecution(t *testing.T) {
+	s := store.New()
+	srv := New(s)
+
+	wf, err := s.CreateWorkflow(testParent, "latest", "main:\n  steps:\n    - done:\n        return: 1\n", "")
+	if err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	latest := func() (int, string) {
+		t.Helper()
+		resp, err := srv.App().Test(httptest.NewRequest("GET", "/v1/"+wf.Name+"/executions:latest", nil), -1)
+		if err != nil {
+			t.Fatalf("GET latest: %v", err)
+		}
+		var body struct{ Name string }
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Name
+	}
+
+	if status, _ := latest(); status != 404 {
+		t.Errorf("latest with no executions: status %d, want 404", status)
+	}
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		exec, err := srv.StartExecution(wf.Name, types.Null)
+		if err != nil {
+			t.Fatalf("start execution: %v", err)
+		}
+		names = append(names, exec.Name)
+	}
+
+	status, name := latest()
+	if status != 200 || name != names[1] {
+		t.Errorf("latest = %d %s, want 200 %s", status, name, names[1])
+	}
+}
@@ -4,16 +4,15 @@ package grpcapi
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
-	"net/http"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
@@ -24,10 +23,8 @@ import (
 	executionspb "cloud.google.com/go/workflows/executions/apiv1/executionspb"
 	workflowspb "cloud.google.com/go/workflows/apiv1/workflowspb"
 
-	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/runtime"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runner"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
@@ -38,29 +35,59 @@ type Server struct {
 	executionspb.UnimplementedExecutionsServer
 	longrunningpb.UnimplementedOperationsServer
 
-	store   *store.Store
-	parsed  map[string]*ast.Workflow
-	engines map[string]*runtime.Engine
-	grpc    *grpc.Server
+	store  *store.Store
+	runner *runner.Runner // parses, runs and cancels executions
+	grpc   *grpc.Server
+	logger *slog.Logger // RPC logger
 }
 
 // New creates a new gRPC server wrapping the given store.
 func New(s *store.Store) *Server {
 	srv := &Server{
-		store:   s,
-		parsed:  make(map[string]*ast.Workflow),
-		engines: make(map[string]*runtime.Engine),
+		store:  s,
+		runner: runner.New(s),
+		logger: logging.Default(),
 	}
 
-	gs := grpc.NewServer()
+	gs := grpc.NewServer(grpc.UnaryInterceptor(srv.logUnary))
 	workflowspb.RegisterWorkflowsServer(gs, srv)
 	executionspb.RegisterExecutionsServer(gs, srv)
 	longrunningpb.RegisterOperationsServer(gs, srv)
+	// Lets grpcurl and similar tools discover the services
+	reflection.Register(gs)
 	srv.grpc = gs
 
 	return srv
 }
 
+// logUnary logs the method, duration, and status code of every unary RPC.
+func (s *Server) logUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.logger.Info("grpc call",
+		"method", info.FullMethod,
+		"duration", time.Since(start),
+		"code", status.Code(err).String())
+	return resp, err
+}
+
+// SetRunner replaces the runner that executes workflows, e.g. to share one
+// between the REST and gRPC servers.
+func (s *Server) SetRunner(r *runner.Runner) {
+	s.runner = r
+}
+
+// Runner returns the runner that executes workflows.
+func (s *Server) Runner() *runner.Runner {
+	return s.runner
+}
+
+// SetLogger sets the logger for RPCs. Execution events go to the runner's
+// logger.
+func (s *Server) SetLogger(l *slog.Logger) {
+	s.logger = l
+}
+
 // Serve starts listening on the given address and serves gRPC requests.
 func (s *Server) Serve(addr string) error {
 	lis, err := net.Listen("tcp", addr)
@@ -81,6 +108,9 @@ func (s *Server) CreateWorkflow(ctx context.Context, req *workflowspb.CreateWork
 	if req.GetWorkflowId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "workflow_id is required")
 	}
+	if err := store.ValidateWorkflowID(req.GetWorkflowId()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	wfProto := req.GetWorkflow()
 	if wfProto == nil {
 		return nil, status.Error(codes.InvalidArgument, "workflow is required")
@@ -91,7 +121,7 @@ func (s *Server) CreateWorkflow(ctx context.Context, req *workflowspb.CreateWork
 	}
 
 	// Validate by parsing
-	wfAST, err := parser.Parse([]byte(src))
+	wfAST, err := s.runner.ParseDefinition([]byte(src))
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid workflow definition: %v", err)
 	}
@@ -104,7 +134,7 @@ func (s *Server) CreateWorkflow(ctx context.Context, req *workflowspb.CreateWork
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	s.parsed[wf.Name] = wfAST
+	s.runner.SetParsed(wf.Name, wfAST)
 
 	return doneOperation("create-"+req.GetWorkflowId(), storeWorkflowToProto(wf))
 }
@@ -140,11 +170,11 @@ func (s *Server) UpdateWorkflow(ctx context.Context, req *workflowspb.UpdateWork
 	src := wfProto.GetSourceContents()
 
 	if src != "" {
-		wfAST, err := parser.Parse([]byte(src))
+		wfAST, err := s.runner.ParseDefinition([]byte(src))
 		if err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "invalid workflow definition: %v", err)
 		}
-		s.parsed[name] = wfAST
+		s.runner.SetParsed(name, wfAST)
 	}
 
 	wf, err := s.store.UpdateWorkflow(name, src, wfProto.GetDescription())
@@ -165,7 +195,7 @@ func (s *Server) DeleteWorkflow(ctx context.Context, req *workflowspb.DeleteWork
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
 
-	delete(s.parsed, name)
+	s.runner.SetParsed(name, nil)
 
 	parts := strings.Split(name, "/")
 	wfID := parts[len(parts)-1]
@@ -182,36 +212,36 @@ func (s *Server) CreateExecution(ctx context.Context, req *executionspb.CreateEx
 
 	var args types.Value = types.Null
 	if execProto != nil && execProto.GetArgument() != "" {
-		var raw interface{}
-		if err := json.Unmarshal([]byte(execProto.GetArgument()), &raw); err != nil {
+		parsed, err := types.ParseJSON([]byte(execProto.GetArgument()))
+		if err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "invalid argument JSON: %v", err)
 		}
-		args = types.ValueFromJSON(raw)
+		args = parsed
 	}
 
-	// Get parsed workflow
-	wfAST, ok := s.parsed[workflowName]
-	if !ok {
-		wf, err := s.store.GetWorkflow(workflowName)
-		if err != nil {
-			return nil, status.Error(codes.NotFound, err.Error())
-		}
-		parsed, err := parser.Parse([]byte(wf.SourceCode))
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "failed to parse workflow: %v", err)
+	if _, err := s.store.GetWorkflow(workflowName); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	// A client-chosen execution ID, given as execution.name either bare or as
+	// a full name under the workflow, makes the create idempotent
+	execID := strings.TrimPrefix(execProto.GetName(), workflowName+"/executions/")
+	if execID != "" {
+		if err := store.ValidateExecutionID(execID); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
-		wfAST = parsed
-		s.parsed[workflowName] = wfAST
 	}
 
-	exec, err := s.store.CreateExecution(workflowName, args)
+	// The RPC deadline bounds only the create call itself. Once the execution
+	// is recorded it runs to completion even if the caller stops waiting.
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	exec, err := s.runner.Start(workflowName, execID, args)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-
-	// Execute asynchronously
-	go s.runExecution(exec.Name, wfAST, args)
-
 	return storeExecutionToProto(exec), nil
 }
 
@@ -220,31 +250,31 @@ func (s *Server) GetExecution(ctx context.Context, req *executionspb.GetExecutio
 	if err != nil {
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
-	return storeExecutionToProto(exec), nil
+	return applyExecutionView(storeExecutionToProto(exec), req.GetView()), nil
 }
 
 func (s *Server) ListExecutions(ctx context.Context, req *executionspb.ListExecutionsRequest) (*executionspb.ListExecutionsResponse, error) {
-	executions := s.store.ListExecutions(req.GetParent())
+	executions, nextPageToken, err := s.store.ListExecutionsPage(
+		req.GetParent(), int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	pbExecs := make([]*executionspb.Execution, len(executions))
 	for i, exec := range executions {
-		pbExecs[i] = storeExecutionToProto(exec)
+		pbExecs[i] = applyExecutionView(storeExecutionToProto(exec), req.GetView())
 	}
 
 	return &executionspb.ListExecutionsResponse{
-		Executions: pbExecs,
+		Executions:    pbExecs,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
 func (s *Server) CancelExecution(ctx context.Context, req *executionspb.CancelExecutionRequest) (*executionspb.Execution, error) {
 	name := req.GetName()
 
-	if engine, ok := s.engines[name]; ok {
-		engine.Cancel()
-	}
-
-	err := s.store.CancelExecution(name)
-	if err != nil {
+	if err := s.runner.Cancel(name); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
@@ -257,59 +287,6 @@ func (s *Server) CancelExecution(ctx context.Context, req *executionspb.CancelEx
 
 // --- Internal helpers ---
 
-func (s *Server) runExecution(execName string, wfAST *ast.Workflow, args types.Value) {
-	log.Printf("[DEBUG] Starting execution: %s", execName)
-
-	funcs := stdlib.NewRegistry()
-	funcs.RegisterHTTP(&http.Client{Timeout: 30 * time.Second})
-	funcs.RegisterWorkflowExecution(&grpcStoreAdapter{s.store}, s.parsed, s.childExecutor())
-
-	engine := runtime.NewEngine(wfAST, funcs)
-	s.engines[execName] = engine
-
-	ctx := context.Background()
-	result, err := engine.Execute(ctx, args)
-
-	delete(s.engines, execName)
-
-	if err != nil {
-		log.Printf("[ERROR] Execution %s failed: %v", execName, err)
-		_ = s.store.FailExecution(execName, err)
-	} else {
-		log.Printf("[DEBUG] Execution %s completed successfully", execName)
-		_ = s.store.CompleteExecution(execName, result)
-	}
-}
-
-// childExecutor returns a ChildExecutor that creates a fresh engine for each
-// child workflow execution, with all stdlib functions registered.
-func (s *Server) childExecutor() stdlib.ChildExecutor {
-	return func(wfAST *ast.Workflow, args types.Value) (types.Value, error) {
-		funcs := stdlib.NewRegistry()
-		funcs.RegisterHTTP(&http.Client{Timeout: 30 * time.Second})
-		funcs.RegisterWorkflowExecution(&grpcStoreAdapter{s.store}, s.parsed, s.childExecutor())
-
-		engine := runtime.NewEngine(wfAST, funcs)
-		return engine.Execute(context.Background(), args)
-	}
-}
-
-// grpcStoreAdapter adapts *store.Store to the stdlib.WorkflowStore interface.
-type grpcStoreAdapter struct {
-	s *store.Store
-}
-
-func (a *grpcStoreAdapter) FindWorkflowByID(workflowID string) (stdlib.WorkflowInfo, error) {
-	wf, err := a.s.FindWorkflowByID(workflowID)
-	if err != nil {
-		return stdlib.WorkflowInfo{}, err
-	}
-	return stdlib.WorkflowInfo{
-		Name:       wf.Name,
-		SourceCode: wf.SourceCode,
-	}, nil
-}
-
 func storeWorkflowToProto(wf *store.Workflow) *workflowspb.Workflow {
 	pb := &workflowspb.Workflow{
 		Name:        wf.Name,
@@ -345,6 +322,8 @@ func storeExecutionToProto(exec *store.Execution) *executionspb.Execution {
 	}
 
 	switch exec.State {
+	case store.ExecutionQueued:
+		pb.State = executionspb.Execution_QUEUED
 	case store.ExecutionActive:
 		pb.State = executionspb.Execution_ACTIVE
 	case store.ExecutionSucceeded:
@@ -371,6 +350,17 @@ func storeExecutionToProto(exec *store.Execution) *executionspb.Execution {
 	return pb
 }
 
+// applyExecutionView trims pb to the fields included in view. BASIC omits
+// the argument and result, which can be large; FULL and an unspecified view
+// keep every field.
+func applyExecutionView(pb *executionspb.Execution, view executionspb.ExecutionView) *executionspb.Execution {
+	if view == executionspb.ExecutionView_BASIC {
+		pb.Argument = ""
+		pb.Result = ""
+	}
+	return pb
+}
+
 // --- Operations Service (for official client LRO support) ---
 
 // GetOperation returns a completed operation. Since the emulator completes all
@@ -1,17 +1,24 @@
 package grpcapi
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
 
 	executionspb "cloud.google.com/go/workflows/executions/apiv1/executionspb"
 	workflowspb "cloud.google.com/go/workflows/apiv1/workflowspb"
 
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
 )
 
@@ -275,6 +282,126 @@ func TestCreateAndGetExecution(t *testing.T) {
 	}
 }
 
+func TestGetExecutionView(t *testing.T) {
+	addr, cleanup := startTestServer(t)
+	defer cleanup()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	wfClient := workflowspb.NewWorkflowsClient(conn)
+	exClient := executionspb.NewExecutionsClient(conn)
+	ctx := context.Background()
+
+	_, err := wfClient.CreateWorkflow(ctx, &workflowspb.CreateWorkflowRequest{
+		Parent:     "projects/my-project/locations/us-central1",
+		WorkflowId: "view-test",
+		Workflow: &workflowspb.Workflow{
+			SourceCode: &workflowspb.Workflow_SourceContents{
+				SourceContents: "main:\n  params: [args]\n  steps:\n    - ret:\n        return: ${args.x}",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+
+	exec, err := exClient.CreateExecution(ctx, &executionspb.CreateExecutionRequest{
+		Parent:    "projects/my-project/locations/us-central1/workflows/view-test",
+		Execution: &executionspb.Execution{Argument: `{"x": "big"}`},
+	})
+	if err != nil {
+		t.Fatalf("CreateExecution: %v", err)
+	}
+
+	get := func(view executionspb.ExecutionView) *executionspb.Execution {
+		t.Helper()
+		got, err := exClient.GetExecution(ctx, &executionspb.GetExecutionRequest{
+			Name: exec.GetName(),
+			View: view,
+		})
+		if err != nil {
+			t.Fatalf("GetExecution(%v): %v", view, err)
+		}
+		return got
+	}
+
+	for i := 0; i < 50 && get(executionspb.ExecutionView_FULL).GetState() == executionspb.Execution_ACTIVE; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	full := get(executionspb.ExecutionView_FULL)
+	if full.GetState() != executionspb.Execution_SUCCEEDED {
+		t.Fatalf("expected SUCCEEDED, got %v (error: %v)", full.GetState(), full.GetError())
+	}
+	if full.GetResult() != `"big"` || full.GetArgument() == "" {
+		t.Errorf("FULL view: result %q, argument %q; want both set", full.GetResult(), full.GetArgument())
+	}
+
+	basic := get(executionspb.ExecutionView_BASIC)
+	if basic.GetResult() != "" || basic.GetArgument() != "" {
+		t.Errorf("BASIC view: result %q, argument %q; want both empty", basic.GetResult(), basic.GetArgument())
+	}
+	if basic.GetState() != executionspb.Execution_SUCCEEDED || basic.GetName() != exec.GetName() {
+		t.Errorf("BASIC view: got name %q state %v, want the execution's name and state", basic.GetName(), basic.GetState())
+	}
+}
+
+func TestCreateExecutionOutlivesClientDeadline(t *testing.T) {
+	addr, cleanup := startTestServer(t)
+	defer cleanup()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	wfClient := workflowspb.NewWorkflowsClient(conn)
+	exClient := executionspb.NewExecutionsClient(conn)
+
+	_, err := wfClient.CreateWorkflow(context.Background(), &workflowspb.CreateWorkflowRequest{
+		Parent:     "projects/my-project/locations/us-central1",
+		WorkflowId: "deadline-test",
+		Workflow: &workflowspb.Workflow{
+			SourceCode: &workflowspb.Workflow_SourceContents{
+				SourceContents: "main:\n  steps:\n    - wait:\n        call: sys.sleep\n        args:\n          seconds: 0.3\n    - ret:\n        return: \"done\"",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	exec, err := exClient.CreateExecution(ctx, &executionspb.CreateExecutionRequest{
+		Parent:    "projects/my-project/locations/us-central1/workflows/deadline-test",
+		Execution: &executionspb.Execution{},
+	})
+	cancel()
+	if err != nil {
+		t.Fatalf("CreateExecution: %v", err)
+	}
+	if exec.GetState() != executionspb.Execution_ACTIVE {
+		t.Fatalf("expected ACTIVE, got %v", exec.GetState())
+	}
+
+	// The execution keeps running well past the client's deadline
+	var got *executionspb.Execution
+	for i := 0; i < 50; i++ {
+		got, err = exClient.GetExecution(context.Background(), &executionspb.GetExecutionRequest{
+			Name: exec.GetName(),
+		})
+		if err != nil {
+			t.Fatalf("GetExecution: %v", err)
+		}
+		if got.GetState() != executionspb.Execution_ACTIVE {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got.GetState() != executionspb.Execution_SUCCEEDED {
+		t.Fatalf("expected SUCCEEDED, got %v (error: %v)", got.GetState(), got.GetError())
+	}
+}
+
 func TestListExecutions(t *testing.T) {
 	addr, cleanup := startTestServer(t)
 	defer cleanup()
@@ -362,6 +489,32 @@ func TestCreateWorkflowErrors(t *testing.T) {
 	}
 }
 
+func TestCreateWorkflowInvalidID(t *testing.T) {
+	addr, cleanup := startTestServer(t)
+	defer cleanup()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	client := workflowspb.NewWorkflowsClient(conn)
+	ctx := context.Background()
+
+	for _, id := range []string{"MyWorkflow", "1-workflow", "a" + strings.Repeat("b", 128)} {
+		_, err := client.CreateWorkflow(ctx, &workflowspb.CreateWorkflowRequest{
+			Parent:     "projects/my-project/locations/us-central1",
+			WorkflowId: id,
+			Workflow: &workflowspb.Workflow{
+				SourceCode: &workflowspb.Workflow_SourceContents{
+					SourceContents: "main:\n  steps:\n    - ret:\n        return: 1",
+				},
+			},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("workflow_id %q: expected InvalidArgument, got %v", id, err)
+		}
+	}
+}
+
 func TestExecutionWithArguments(t *testing.T) {
 	addr, cleanup := startTestServer(t)
 	defer cleanup()
@@ -420,3 +573,87 @@ func TestExecutionWithArguments(t *testing.T) {
 		t.Fatalf("unexpected result: got %s, want %q", got.GetResult(), "hello world")
 	}
 }
+
+func TestReflectionListsServices(t *testing.T) {
+	addr, cleanup := startTestServer(t)
+	defer cleanup()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+	defer stream.CloseSend()
+
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("send list services: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("recv list services: %v", err)
+	}
+
+	services := make(map[string]bool)
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services[svc.GetName()] = true
+	}
+	for _, want := range []string{
+		"google.cloud.workflows.v1.Workflows",
+		"google.cloud.workflows.executions.v1.Executions",
+	} {
+		if !services[want] {
+			t.Errorf("service %s not listed by reflection; got %v", want, services)
+		}
+	}
+}
+
+func TestUnaryCallsAreLogged(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := logging.New(logging.FormatJSON, &out)
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+
+	srv := New(store.New())
+	srv.SetLogger(logger)
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go srv.grpc.Serve(lis)
+
+	conn := dial(t, lis.Addr().String())
+	_, err = workflowspb.NewWorkflowsClient(conn).CreateWorkflow(context.Background(), &workflowspb.CreateWorkflowRequest{
+		Parent:     "projects/my-project/locations/us-central1",
+		WorkflowId: "logged",
+		Workflow: &workflowspb.Workflow{
+			SourceCode: &workflowspb.Workflow_SourceContents{
+				SourceContents: "main:\n  steps:\n    - ret:\n        return: 1",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	conn.Close()
+	// Stop waits for the handler, and so the log write, to finish
+	srv.grpc.Stop()
+
+	var rec map[string]any
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("expected one JSON log record, got %q: %v", out.String(), err)
+	}
+	if got := rec["method"]; got != "/google.cloud.workflows.v1.Workflows/CreateWorkflow" {
+		t.Errorf("method = %v, want the CreateWorkflow method", got)
+	}
+	if got := rec["code"]; got != "OK" {
+		t.Errorf("code = %v, want OK", got)
+	}
+	if _, ok := rec["duration"]; !ok {
+		t.Error("log record has no duration")
+	}
+}
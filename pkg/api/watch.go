@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+)
+
+// --- Directory Loading ---
+
+// DefaultWatchDebounce is how long the watcher waits after the last event for
+// a file before re-reading it, so that multi-step editor writes (truncate, then
+// write) are parsed once with their final content.
+const DefaultWatchDebounce = 150 * time.Millisecond
+
+// SetWatchDebounce sets the per-file debounce window used by WatchDir. It must
+// be called before WatchDir.
+func (s *Server) SetWatchDebounce(d time.Duration) {
+	s.watchDebounce = d
+}
+
+// WatchDir deploys all .yaml and .json workflow files in the given directory
+// as workflows, and keeps them in sync with it. File name (sans extension)
+// becomes the workflow ID.
+// The initial load runs in the background so the server can start listening
+// at once; /readyz reports 503 until it completes. The directory is then
+// watched: added files are deployed, modified files are redeployed as a new
+// revision, and removed files delete their workflow.
+func (s *Server) WatchDir(dir, project, location string) error {
+	// Watch before listing, so files added during the initial load are not
+	// missed
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating directory watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watching workflows directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("reading workflows directory: %w", err)
+	}
+	s.watcher = watcher
+
+	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
+
+	// Not ready until the initial load completes
+	s.loading.Store(true)
+	go func() {
+		loaded := 0
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if s.syncWorkflowFile(dir, entry.Name(), parent) {
+				loaded++
+			}
+		}
+		log.Printf("Loaded %d workflow(s) from %s", loaded, dir)
+		s.loading.Store(false)
+
+		s.watchLoop(watcher, dir, parent)
+	}()
+	return nil
+}
+
+// watchLoop consumes watcher events until the watcher is closed. Events are
+// coalesced per file name: each event restarts that file's debounce timer, and
+// the file is re-synced with the store only once the timer fires.
+func (s *Server) watchLoop(watcher *fsnotify.Watcher, dir, parent string) {
+	var mu sync.Mutex
+	pending := make(map[string]*time.Timer)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(event.Name)
+			if !isWorkflowFile(name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			mu.Lock()
+			if t, ok := pending[name]; ok {
+				t.Stop()
+			}
+			pending[name] = time.AfterFunc(s.watchDebounce, func() {
+				mu.Lock()
+				delete(pending, name)
+				mu.Unlock()
+				s.syncWorkflowFile(dir, name, parent)
+			})
+			mu.Unlock()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Warning: workflows directory watcher error: %v", err)
+		}
+	}
+}
+
+// syncWorkflowFile brings the store in line with the current state of a single
+// file in the watched directory. A missing file deletes its workflow; an
+// existing one is deployed or updated. Invalid files are logged and skipped,
+// leaving any previously deployed revision in place. It reports whether the
+// file is deployed after the call.
+func (s *Server) syncWorkflowFile(dir, name, parent string) bool {
+	if !isWorkflowFile(name) {
+		return false
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	workflowID := strings.ToLower(base)
+
+	if store.ValidateWorkflowID(workflowID) != nil {
+		log.Printf("Warning: skipping file %q — invalid workflow ID %q", name, workflowID)
+		return false
+	}
+
+	wfName := fmt.Sprintf("%s/workflows/%s", parent, workflowID)
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		if s.store.DeleteWorkflow(wfName) == nil {
+			s.runner.SetParsed(wfName, nil)
+			log.Printf("Removed workflow %q (file %s deleted)", workflowID, name)
+		}
+		return false
+	}
+	if err != nil {
+		log.Printf("Warning: could not read %q: %v", name, err)
+		return false
+	}
+
+	if workflowID != base {
+		log.Printf("Warning: lowercased workflow ID %q (from file %q)", workflowID, name)
+	}
+
+	wfAST, err := s.runner.ParseDefinition(data)
+	if err != nil {
+		log.Printf("Warning: could not parse %q: %v", name, err)
+		return false
+	}
+
+	if existing, err := s.store.GetWorkflow(wfName); err == nil {
+		if existing.SourceCode == string(data) {
+			return true
+		}
+		// Executions already running hold their own AST pointer, so swapping
+		// the cached entry only affects executions started from now on.
+		wf, err := s.store.UpdateWorkflow(wfName, string(data), "")
+		if err != nil {
+			log.Printf("Warning: could not update %q: %v", name, err)
+			return false
+		}
+		s.runner.SetParsed(wf.Name, wfAST)
+		log.Printf("Reloaded workflow %q from %s (revision %s)", workflowID, name, wf.RevisionID)
+		return true
+	}
+
+	wf, err := s.store.CreateWorkflow(parent, workflowID, string(data), "")
+	if err != nil {
+		log.Printf("Warning: could not deploy %q: %v", name, err)
+		return false
+	}
+
+	s.runner.SetParsed(wf.Name, wfAST)
+	log.Printf("Loaded workflow %q from %s", workflowID, name)
+	return true
+}
+
+// isWorkflowFile reports whether a file name has a workflow source extension.
+func isWorkflowFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
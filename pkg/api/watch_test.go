@@ -0,0 +1,143 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+)
+
+const testParent = "projects/test-project/locations/us-central1"
+
+func startWatchedServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	return startWatchedServerWithDebounce(t, DefaultWatchDebounce)
+}
+
+func startWatchedServerWithDebounce(t *testing.T, debounce time.Duration) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	srv := New(store.New())
+	srv.SetWatchDebounce(debounce)
+	if err := srv.WatchDir(dir, "test-project", "us-central1"); err != nil {
+		t.Fatalf("WatchDir: %v", err)
+	}
+	t.Cleanup(func() { srv.watcher.Close() })
+	waitFor(t, "initial load", func() bool { return !srv.loading.Load() })
+	return srv, dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// waitFor polls cond until it returns true or the timeout expires.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchDirHotReload(t *testing.T) {
+	srv, dir := startWatchedServer(t)
+	path := filepath.Join(dir, "greeter.yaml")
+	name := testParent + "/workflows/greeter"
+
+	v1 := "main:\n  steps:\n    - done:\n        return: \"v1\"\n"
+	writeFile(t, path, v1)
+	waitFor(t, "deploy", func() bool {
+		wf, err := srv.store.GetWorkflow(name)
+		return err == nil && wf.SourceCode == v1 && srv.runner.Parsed(name) != nil
+	})
+	wf, _ := srv.store.GetWorkflow(name)
+	rev1 := wf.RevisionID
+	ast1 := srv.runner.Parsed(name)
+
+	v2 := "main:\n  steps:\n    - done:\n        return: \"v2\"\n"
+	writeFile(t, path, v2)
+	waitFor(t, "update", func() bool {
+		wf, err := srv.store.GetWorkflow(name)
+		return err == nil && wf.SourceCode == v2 && srv.runner.Parsed(name) != ast1
+	})
+	wf, _ = srv.store.GetWorkflow(name)
+	if wf.RevisionID == rev1 {
+		t.Errorf("expected revision to change on update, still %s", rev1)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	waitFor(t, "delete", func() bool {
+		_, err := srv.store.GetWorkflow(name)
+		cached := srv.runner.Parsed(name) != nil
+		return err != nil && !cached
+	})
+}
+
+func TestWatchDirInvalidFileKeepsPreviousRevision(t *testing.T) {
+	srv, dir := startWatchedServer(t)
+	path := filepath.Join(dir, "stable.yaml")
+	name := testParent + "/workflows/stable"
+
+	valid := "main:\n  steps:\n    - done:\n        return: 1\n"
+	writeFile(t, path, valid)
+	waitFor(t, "deploy", func() bool {
+		_, err := srv.store.GetWorkflow(name)
+		return err == nil
+	})
+
+	writeFile(t, filepath.Join(dir, "broken.yaml"), "this is not valid workflow YAML\n  - broken: {{{\n")
+	writeFile(t, path, "main: [")
+	time.Sleep(4 * srv.watchDebounce)
+
+	wf, err := srv.store.GetWorkflow(name)
+	if err != nil {
+		t.Fatalf("workflow disappeared after invalid write: %v", err)
+	}
+	if wf.SourceCode != valid {
+		t.Errorf("expected previous source to be kept, got %q", wf.SourceCode)
+	}
+	if _, err := srv.store.GetWorkflow(testParent + "/workflows/broken"); err == nil {
+		t.Error("expected invalid file not to be deployed")
+	}
+}
+
+func TestWatchDirCoalescesWritesWithinDebounce(t *testing.T) {
+	srv, dir := startWatchedServerWithDebounce(t, 300*time.Millisecond)
+	path := filepath.Join(dir, "staged.yaml")
+	name := testParent + "/workflows/staged"
+
+	// Simulate an editor that writes the file in two stages; each stage is
+	// valid on its own, so an uncoalesced watcher would deploy twice.
+	writeFile(t, path, "main:\n  steps:\n    - done:\n        return: \"partial\"\n")
+	time.Sleep(50 * time.Millisecond)
+	final := "main:\n  steps:\n    - done:\n        return: \"final\"\n"
+	writeFile(t, path, final)
+
+	waitFor(t, "deploy", func() bool {
+		_, err := srv.store.GetWorkflow(name)
+		return err == nil
+	})
+	time.Sleep(2 * srv.watchDebounce)
+
+	wf, err := srv.store.GetWorkflow(name)
+	if err != nil {
+		t.Fatalf("get workflow: %v", err)
+	}
+	if wf.SourceCode != final {
+		t.Errorf("expected final content, got %q", wf.SourceCode)
+	}
+	if wf.RevisionID != "000001-000" {
+		t.Errorf("expected a single deploy (revision 000001-000), got %s", wf.RevisionID)
+	}
+}
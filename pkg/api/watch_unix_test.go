@@ -0,0 +1,71 @@
+//go:build unix
+
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+)
+
+func TestReadyzDuringInitialLoad(t *testing.T) {
+	srv := New(store.New())
+	status := func(path string) int {
+		t.Helper()
+		resp, err := srv.App().Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return resp.StatusCode
+	}
+
+	// Reading a FIFO blocks until something writes to it, which holds the
+	// initial load open for as long as the test needs
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "hello.yaml")
+	if err := syscall.Mkfifo(fifo, 0o644); err != nil {
+		t.Fatalf("mkfifo: %v", err)
+	}
+
+	if err := srv.WatchDir(dir, "test-project", "us-central1"); err != nil {
+		t.Fatalf("WatchDir: %v", err)
+	}
+	t.Cleanup(func() { srv.watcher.Close() })
+
+	// While the watched directory is loading, only readiness fails
+	if got := status("/readyz"); got != 503 {
+		t.Errorf("/readyz while loading = %d, want 503", got)
+	}
+	if got := status("/healthz"); got != 200 {
+		t.Errorf("/healthz while loading = %d, want 200", got)
+	}
+
+	// Opening the FIFO for writing blocks until the load opens it to read
+	w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open fifo: %v", err)
+	}
+	if _, err := w.WriteString("main:\n  steps:\n    - done:\n        return: 1\n"); err != nil {
+		t.Fatalf("write fifo: %v", err)
+	}
+	w.Close()
+
+	waitFor(t, "/readyz to report ready", func() bool { return status("/readyz") == 200 })
+	if _, err := srv.store.GetWorkflow(testParent + "/workflows/hello"); err != nil {
+		t.Errorf("workflow not deployed by the initial load: %v", err)
+	}
+
+	// Remove the FIFO so the watcher's re-sync of our write does not block
+	// reading it
+	if err := os.Remove(fifo); err != nil {
+		t.Fatalf("remove fifo: %v", err)
+	}
+	waitFor(t, "delete", func() bool {
+		_, err := srv.store.GetWorkflow(testParent + "/workflows/hello")
+		return err != nil
+	})
+}
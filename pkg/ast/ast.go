@@ -3,220 +3,269 @@
 // and before execution.
 package ast
 
+import "encoding/json"
+
 // Workflow represents a complete parsed workflow with its subworkflows.
 type Workflow struct {
 	// Main is the entry-point workflow (always named "main").
-	Main *Subworkflow
+	Main *Subworkflow `json:"main,omitempty"`
 
 	// Subworkflows maps subworkflow names to their definitions.
 	// Does not include "main".
-	Subworkflows map[string]*Subworkflow
+	Subworkflows map[string]*Subworkflow `json:"subworkflows,omitempty"`
 }
 
 // Subworkflow represents a single workflow or subworkflow definition.
 type Subworkflow struct {
 	// Name is the workflow/subworkflow identifier.
-	Name string
+	Name string `json:"name"`
 
 	// Params defines the parameter list.
 	// For "main", this is either empty or a single parameter name (receives a map).
 	// For subworkflows, these are named params that may have defaults.
-	Params []Param
+	Params []Param `json:"params,omitempty"`
 
 	// Steps is the ordered list of steps in this workflow.
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
 }
 
 // Param represents a workflow/subworkflow parameter.
 type Param struct {
 	// Name is the parameter name.
-	Name string
+	Name string `json:"name"`
 
 	// Default is the default value expression (nil if required).
-	Default interface{}
+	Default interface{} `json:"default,omitempty"`
 
 	// HasDefault indicates whether a default was specified.
-	HasDefault bool
+	HasDefault bool `json:"hasDefault,omitempty"`
 }
 
 // Step represents a single workflow step.
 type Step struct {
 	// Name is the step identifier, unique within its containing step list.
-	Name string
+	Name string `json:"name"`
 
 	// Assign holds assignment operations (non-nil for assign steps).
-	Assign []Assignment
+	Assign []Assignment `json:"assign,omitempty"`
 
 	// Call holds a function/subworkflow call (non-nil for call steps).
-	Call *CallExpr
+	Call *CallExpr `json:"call,omitempty"`
 
 	// Switch holds conditional branches (non-nil for switch steps).
-	Switch []SwitchCondition
+	Switch []SwitchCondition `json:"switch,omitempty"`
 
 	// For holds a for-loop definition (non-nil for for steps).
-	For *ForExpr
+	For *ForExpr `json:"for,omitempty"`
 
 	// Parallel holds parallel execution (non-nil for parallel steps).
-	Parallel *ParallelExpr
+	Parallel *ParallelExpr `json:"parallel,omitempty"`
 
 	// Try holds try/except/retry (non-nil for try steps).
-	Try *TryExpr
+	Try *TryExpr `json:"try,omitempty"`
 
 	// Raise holds a raise expression (non-nil for raise steps).
-	Raise interface{} // string expression or map
+	Raise interface{} `json:"raise,omitempty"` // string expression or map
 
 	// Return holds a return expression (non-nil for return steps).
-	Return interface{} // any expression
+	Return interface{} `json:"return,omitempty"` // any expression
 
 	// HasReturn distinguishes return:null from no return.
-	HasReturn bool
+	HasReturn bool `json:"hasReturn,omitempty"`
 
 	// Next is the next step name ("end", "break", "continue", or step name).
-	Next string
+	Next string `json:"next,omitempty"`
 
 	// Steps holds nested step grouping (non-nil for steps steps).
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
+
+	// Result is the variable name to store call results. It is only set on
+	// call steps, where it mirrors Call.Result.
+	Result string `json:"-"`
+}
 
-	// Result is the variable name to store call results.
-	Result string
+// Type names the kind of step: the first of its clauses in execution order,
+// one of "steps", "assign", "call", "switch", "for", "try", "parallel",
+// "raise", "return" or "next". A step with no clauses has type "".
+func (s *Step) Type() string {
+	switch {
+	case s.Steps != nil:
+		return "steps"
+	case s.Assign != nil:
+		return "assign"
+	case s.Call != nil:
+		return "call"
+	case s.Switch != nil:
+		return "switch"
+	case s.For != nil:
+		return "for"
+	case s.Try != nil:
+		return "try"
+	case s.Parallel != nil:
+		return "parallel"
+	case s.Raise != nil:
+		return "raise"
+	case s.HasReturn:
+		return "return"
+	case s.Next != "":
+		return "next"
+	}
+	return ""
 }
 
 // Assignment represents a single variable assignment within an assign step.
 type Assignment struct {
 	// Target is the assignment target (variable name, possibly with property/index paths).
 	// Examples: "x", "my_map.key", "my_list[0]"
-	Target string
+	Target string `json:"target"`
 
 	// Value is the expression to evaluate and assign.
-	Value interface{}
+	Value interface{} `json:"value"`
 }
 
 // CallExpr represents a call step: HTTP call, stdlib call, or subworkflow call.
 type CallExpr struct {
 	// Function is the fully qualified function name (e.g., "http.get", "sys.log", "my_subworkflow").
-	Function string
+	Function string `json:"function"`
 
 	// Args maps argument names to their values/expressions.
-	Args map[string]interface{}
+	Args map[string]interface{} `json:"args,omitempty"`
 
 	// Result is the variable name to store the return value.
-	Result string
+	Result string `json:"result,omitempty"`
 }
 
 // SwitchCondition represents a single condition branch in a switch step.
 type SwitchCondition struct {
 	// Condition is the expression to evaluate (must be truthy to match).
-	Condition interface{}
+	Condition interface{} `json:"condition,omitempty"`
 
 	// Next is the step to jump to if this condition matches.
-	Next string
+	Next string `json:"next,omitempty"`
 
 	// Steps are inline steps to execute if this condition matches.
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
 
 	// Assign holds inline assignments if condition matches.
-	Assign []Assignment
+	Assign []Assignment `json:"assign,omitempty"`
 
 	// Return holds an inline return value if condition matches.
-	Return interface{}
+	Return interface{} `json:"return,omitempty"`
 
 	// HasReturn distinguishes return:null from no return.
-	HasReturn bool
+	HasReturn bool `json:"hasReturn,omitempty"`
 
 	// Raise holds an inline raise if condition matches.
-	Raise interface{}
+	Raise interface{} `json:"raise,omitempty"`
 }
 
 // ForExpr represents a for-loop step.
 type ForExpr struct {
 	// Value is the loop variable name for the current element.
-	Value string
+	Value string `json:"value,omitempty"`
 
 	// Index is the optional loop variable name for the current index.
-	Index string
+	Index string `json:"index,omitempty"`
 
 	// In is the expression producing the list/map to iterate over.
-	In interface{}
+	In interface{} `json:"in,omitempty"`
 
 	// Range specifies [start, end] inclusive range for numeric iteration.
-	Range [2]interface{} // [start_expr, end_expr]
+	Range [2]interface{} `json:"-"` // [start_expr, end_expr]
 
 	// HasRange indicates whether Range (not In) should be used.
-	HasRange bool
+	HasRange bool `json:"-"`
 
 	// Steps is the loop body.
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
+}
+
+// MarshalJSON encodes the loop with a "range" field only for range loops.
+func (f *ForExpr) MarshalJSON() ([]byte, error) {
+	type plain ForExpr
+	out := struct {
+		*plain
+		Range []interface{} `json:"range,omitempty"`
+	}{plain: (*plain)(f)}
+	if f.HasRange {
+		out.Range = f.Range[:]
+	}
+	return json.Marshal(out)
 }
 
 // ParallelExpr represents a parallel execution step.
 type ParallelExpr struct {
 	// Shared lists variable names accessible across branches.
-	Shared []string
+	Shared []string `json:"shared,omitempty"`
 
 	// Branches holds named parallel branches (nil if using for-loop).
-	Branches []*ParallelBranch
+	Branches []*ParallelBranch `json:"branches,omitempty"`
 
 	// For holds a parallel for-loop (nil if using branches).
-	For *ForExpr
+	For *ForExpr `json:"for,omitempty"`
 
 	// ConcurrencyLimit is the max concurrent goroutines (0 = use default of 20).
-	ConcurrencyLimit int
+	ConcurrencyLimit int `json:"concurrencyLimit,omitempty"`
 
 	// ExceptionPolicy is "unhandled" (default) or "continueAll".
-	ExceptionPolicy string
+	ExceptionPolicy string `json:"exceptionPolicy,omitempty"`
 }
 
 // ParallelBranch represents a single named branch within a parallel step.
 type ParallelBranch struct {
 	// Name is the branch identifier.
-	Name string
+	Name string `json:"name"`
 
 	// Steps is the branch body.
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
 }
 
 // TryExpr represents a try/except/retry step.
 type TryExpr struct {
 	// Try is the steps to attempt.
-	Try []*Step
+	Try []*Step `json:"try,omitempty"`
 
 	// Except handles errors from the try block.
-	Except *ExceptExpr
+	Except *ExceptExpr `json:"except,omitempty"`
 
 	// Retry configures automatic retry behavior.
-	Retry *RetryExpr
+	Retry *RetryExpr `json:"retry,omitempty"`
+
+	// Finally runs after the try block and any except block, whether they
+	// succeeded or failed. Emulator extension; GCW has no finally clause.
+	Finally []*Step `json:"finally,omitempty"`
 }
 
 // ExceptExpr represents the except clause of a try step.
 type ExceptExpr struct {
 	// As is the variable name to bind the caught error to.
-	As string
+	As string `json:"as,omitempty"`
 
 	// Steps is the error handling body.
-	Steps []*Step
+	Steps []*Step `json:"steps,omitempty"`
 }
 
 // RetryExpr represents the retry clause of a try step.
 type RetryExpr struct {
 	// Predicate is the retry predicate expression
 	// (e.g., "${http.default_retry}" or a subworkflow name).
-	Predicate interface{}
+	Predicate interface{} `json:"predicate"`
 
 	// MaxRetries is the maximum number of retry attempts.
-	MaxRetries int
+	MaxRetries int `json:"maxRetries"`
 
 	// Backoff configures exponential backoff.
-	Backoff *BackoffExpr
+	Backoff *BackoffExpr `json:"backoff,omitempty"`
 }
 
 // BackoffExpr defines exponential backoff parameters for retry.
 type BackoffExpr struct {
 	// InitialDelay in seconds.
-	InitialDelay float64
+	InitialDelay float64 `json:"initialDelay"`
 
 	// MaxDelay in seconds.
-	MaxDelay float64
+	MaxDelay float64 `json:"maxDelay"`
 
 	// Multiplier for exponential growth.
-	Multiplier float64
+	Multiplier float64 `json:"multiplier"`
 }
@@ -0,0 +1,70 @@
+package ast
+
+import "strings"
+
+// Stats summarizes the size and shape of a workflow definition.
+type Stats struct {
+	// Steps is the total number of steps in main and all subworkflows,
+	// including steps nested in switch, for, parallel, and try blocks.
+	Steps int
+
+	// MaxNestingDepth is the deepest step nesting level. A top-level step
+	// has depth 1; each nested block adds one level.
+	MaxNestingDepth int
+
+	// HTTPCalls is the number of call steps that call an http.* function.
+	HTTPCalls int
+
+	// Subworkflows is the number of subworkflows, not counting main.
+	Subworkflows int
+
+	// UsesParallel reports whether any step is a parallel step.
+	UsesParallel bool
+}
+
+// Stats walks the workflow and returns its structural metrics.
+func (w *Workflow) Stats() Stats {
+	st := Stats{Subworkflows: len(w.Subworkflows)}
+	if w.Main != nil {
+		st.addSteps(w.Main.Steps, 1)
+	}
+	for _, sub := range w.Subworkflows {
+		st.addSteps(sub.Steps, 1)
+	}
+	return st
+}
+
+func (st *Stats) addSteps(steps []*Step, depth int) {
+	if len(steps) > 0 && depth > st.MaxNestingDepth {
+		st.MaxNestingDepth = depth
+	}
+	for _, step := range steps {
+		st.Steps++
+		if step.Call != nil && strings.HasPrefix(step.Call.Function, "http.") {
+			st.HTTPCalls++
+		}
+		st.addSteps(step.Steps, depth+1)
+		for _, cond := range step.Switch {
+			st.addSteps(cond.Steps, depth+1)
+		}
+		if step.For != nil {
+			st.addSteps(step.For.Steps, depth+1)
+		}
+		if step.Try != nil {
+			st.addSteps(step.Try.Try, depth+1)
+			if step.Try.Except != nil {
+				st.addSteps(step.Try.Except.Steps, depth+1)
+			}
+			st.addSteps(step.Try.Finally, depth+1)
+		}
+		if p := step.Parallel; p != nil {
+			st.UsesParallel = true
+			for _, b := range p.Branches {
+				st.addSteps(b.Steps, depth+1)
+			}
+			if p.For != nil {
+				st.addSteps(p.For.Steps, depth+1)
+			}
+		}
+	}
+}
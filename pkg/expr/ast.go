@@ -64,6 +64,10 @@ type CallNode struct {
 
 func (n *CallNode) nodeType() string { return "Call" }
 
+// Name returns the dotted name of the called function, e.g. "http.get", or ""
+// if the callee is not a name.
+func (n *CallNode) Name() string { return functionName(n.Function) }
+
 // ListNode represents a list literal (e.g., [1, 2, 3]).
 type ListNode struct {
 	Elements []Node
@@ -95,3 +99,45 @@ type StringInterpolation struct {
 }
 
 func (n *StringInterpolation) nodeType() string { return "StringInterpolation" }
+
+// Inspect traverses the expression tree rooted at n in depth-first order,
+// calling fn for each node. If fn returns false, the node's children are
+// skipped.
+func Inspect(n Node, fn func(Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *BinaryNode:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+	case *UnaryNode:
+		Inspect(n.Operand, fn)
+	case *PropertyNode:
+		Inspect(n.Object, fn)
+	case *IndexNode:
+		Inspect(n.Object, fn)
+		Inspect(n.Index, fn)
+	case *CallNode:
+		Inspect(n.Function, fn)
+		for _, arg := range n.Args {
+			Inspect(arg, fn)
+		}
+	case *ListNode:
+		for _, e := range n.Elements {
+			Inspect(e, fn)
+		}
+	case *MapNode:
+		for i := range n.Keys {
+			Inspect(n.Keys[i], fn)
+			Inspect(n.Values[i], fn)
+		}
+	case *InNode:
+		Inspect(n.Value, fn)
+		Inspect(n.Container, fn)
+	case *StringInterpolation:
+		for _, part := range n.Parts {
+			Inspect(part, fn)
+		}
+	}
+}
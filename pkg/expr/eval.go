@@ -88,6 +88,16 @@ func evalBinary(n *BinaryNode, scope Scope) (types.Value, error) {
 		}
 		return Evaluate(n.Right, scope)
 	}
+	if n.Op == TokenCoalesce {
+		left, err := evalCoalesceLeft(n.Left, scope)
+		if err != nil {
+			return types.Null, err
+		}
+		if !left.IsNull() {
+			return left, nil
+		}
+		return Evaluate(n.Right, scope)
+	}
 
 	left, err := Evaluate(n.Left, scope)
 	if err != nil {
@@ -102,10 +112,10 @@ func evalBinary(n *BinaryNode, scope Scope) (types.Value, error) {
 	case TokenPlus:
 		return evalAdd(left, right)
 	case TokenMinus:
-		return evalArith(left, right, func(a, b int64) int64 { return a - b },
+		return evalArith("-", left, right, subInt,
 			func(a, b float64) float64 { return a - b })
 	case TokenStar:
-		return evalArith(left, right, func(a, b int64) int64 { return a * b },
+		return evalArith("*", left, right, mulInt,
 			func(a, b float64) float64 { return a * b })
 	case TokenSlash:
 		return evalDivide(left, right)
@@ -140,6 +150,11 @@ func evalAdd(left, right types.Value) (types.Value, error) {
 		return types.Null, types.NewTypeError(
 			fmt.Sprintf("unsupported operand types for +: %s and %s (explicit conversion required)", left.Type(), right.Type()))
 	}
+	// GCW has no map +; point at the function that does what was likely meant
+	if left.Type() == types.TypeMap || right.Type() == types.TypeMap {
+		return types.Null, types.NewTypeError(
+			fmt.Sprintf("unsupported operand types for +: %s and %s (maps cannot be added; use map.merge)", left.Type(), right.Type()))
+	}
 	// List concatenation
 	if left.Type() == types.TypeList && right.Type() == types.TypeList {
 		result := make([]types.Value, 0, len(left.AsList())+len(right.AsList()))
@@ -147,25 +162,54 @@ func evalAdd(left, right types.Value) (types.Value, error) {
 		result = append(result, right.AsList()...)
 		return types.NewList(result), nil
 	}
-	return evalArith(left, right, func(a, b int64) int64 { return a + b },
+	return evalArith("+", left, right, addInt,
 		func(a, b float64) float64 { return a + b })
 }
 
-func evalArith(left, right types.Value, intOp func(int64, int64) int64, floatOp func(float64, float64) float64) (types.Value, error) {
+// evalArith applies a numeric operator. Only ints and doubles are operands:
+// bools, lists, maps, and the rest raise a TypeError naming both types rather
+// than being coerced. intOp reports false if the int result overflows, which
+// raises a ValueError instead of wrapping.
+func evalArith(op string, left, right types.Value, intOp func(int64, int64) (int64, bool), floatOp func(float64, float64) float64) (types.Value, error) {
 	if left.Type() == types.TypeInt && right.Type() == types.TypeInt {
-		return types.NewInt(intOp(left.AsInt(), right.AsInt())), nil
+		r, ok := intOp(left.AsInt(), right.AsInt())
+		if !ok {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("integer overflow: %d %s %d", left.AsInt(), op, right.AsInt()))
+		}
+		return types.NewInt(r), nil
 	}
 
 	a, aOk := left.AsNumber()
 	b, bOk := right.AsNumber()
 	if !aOk || !bOk {
 		return types.Null, types.NewTypeError(
-			fmt.Sprintf("unsupported operand types: %s and %s", left.Type(), right.Type()))
+			fmt.Sprintf("unsupported operand types for %s: %s and %s", op, left.Type(), right.Type()))
 	}
 
 	return types.NewDouble(floatOp(a, b)), nil
 }
 
+// addInt, subInt, and mulInt are int64 arithmetic that report overflow.
+func addInt(a, b int64) (int64, bool) {
+	r := a + b
+	return r, (r > a) == (b > 0)
+}
+
+func subInt(a, b int64) (int64, bool) {
+	r := a - b
+	return r, (r < a) == (b > 0)
+}
+
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	r := a * b
+	// MinInt64 * -1 wraps to MinInt64, which the division check misses
+	return r, r/b == a && !(a == math.MinInt64 && b == -1)
+}
+
 func evalDivide(left, right types.Value) (types.Value, error) {
 	a, aOk := left.AsNumber()
 	b, bOk := right.AsNumber()
@@ -180,6 +224,9 @@ func evalDivide(left, right types.Value) (types.Value, error) {
 	return types.NewDouble(a / b), nil
 }
 
+// evalModulo implements %. Like GCW, the remainder takes the sign of the
+// dividend (truncated division), which is what Go's % and math.Mod produce:
+// -7 % 3 == -1 and 7 % -3 == 1. Note this differs from //, which floors.
 func evalModulo(left, right types.Value) (types.Value, error) {
 	if left.Type() == types.TypeInt && right.Type() == types.TypeInt {
 		if right.AsInt() == 0 {
@@ -249,10 +296,21 @@ func compare(a, b types.Value) (int, error) {
 		return strings.Compare(a.AsString(), b.AsString()), nil
 	}
 
+	// Lists and maps support == and != (via Value.Equal) but have no ordering
+	if isContainer(a) || isContainer(b) {
+		return 0, types.NewTypeError(
+			fmt.Sprintf("cannot order list/map values (%s and %s): only == and != are supported", a.Type(), b.Type()))
+	}
+
 	return 0, types.NewTypeError(
 		fmt.Sprintf("cannot compare %s and %s", a.Type(), b.Type()))
 }
 
+// isContainer reports whether v is a list or map.
+func isContainer(v types.Value) bool {
+	return v.Type() == types.TypeList || v.Type() == types.TypeMap
+}
+
 func evalUnary(n *UnaryNode, scope Scope) (types.Value, error) {
 	operand, err := Evaluate(n.Operand, scope)
 	if err != nil {
@@ -263,6 +321,11 @@ func evalUnary(n *UnaryNode, scope Scope) (types.Value, error) {
 	case TokenMinus:
 		switch operand.Type() {
 		case types.TypeInt:
+			// -MinInt64 does not fit in an int64 and would wrap to itself
+			if operand.AsInt() == math.MinInt64 {
+				return types.Null, types.NewValueError(
+					fmt.Sprintf("integer overflow: -(%d)", operand.AsInt()))
+			}
 			return types.NewInt(-operand.AsInt()), nil
 		case types.TypeDouble:
 			return types.NewDouble(-operand.AsDouble()), nil
@@ -277,21 +340,59 @@ func evalUnary(n *UnaryNode, scope Scope) (types.Value, error) {
 	}
 }
 
+// evalCoalesceLeft evaluates the left operand of ??. A missing variable or
+// key counts as null, but only when it is the outermost lookup: a KeyError
+// from a function argument, an index expression or an earlier step of a
+// property chain is still raised.
+func evalCoalesceLeft(node Node, scope Scope) (types.Value, error) {
+	var val types.Value
+	var err error
+	switch n := node.(type) {
+	case *IdentNode:
+		val, err = scope.GetVariable(n.Name)
+	case *PropertyNode:
+		obj, objErr := Evaluate(n.Object, scope)
+		if objErr != nil {
+			return types.Null, objErr
+		}
+		val, err = getProperty(obj, n.Property)
+	case *IndexNode:
+		obj, objErr := Evaluate(n.Object, scope)
+		if objErr != nil {
+			return types.Null, objErr
+		}
+		idx, idxErr := Evaluate(n.Index, scope)
+		if idxErr != nil {
+			return types.Null, idxErr
+		}
+		val, err = getIndex(obj, idx)
+	default:
+		return Evaluate(node, scope)
+	}
+	if we, ok := err.(*types.WorkflowError); ok && we.HasTag(types.TagKeyError) {
+		return types.Null, nil
+	}
+	return val, err
+}
+
 func evalProperty(n *PropertyNode, scope Scope) (types.Value, error) {
 	obj, err := Evaluate(n.Object, scope)
 	if err != nil {
 		return types.Null, err
 	}
+	return getProperty(obj, n.Property)
+}
 
+func getProperty(obj types.Value, property string) (types.Value, error) {
 	if obj.Type() != types.TypeMap {
 		return types.Null, types.NewTypeError(
-			fmt.Sprintf("cannot access property '%s' on %s", n.Property, obj.Type()))
+			fmt.Sprintf("cannot access property '%s' on %s", property, obj.Type()))
 	}
 
-	val, ok := obj.AsMap().Get(n.Property)
+	val, ok := obj.AsMap().Get(property)
 	if !ok {
 		return types.Null, types.NewKeyError(
-			fmt.Sprintf("key '%s' not found in map", n.Property))
+			fmt.Sprintf("key '%s' not found in map", property))
 	}
 	return val, nil
 }
@@ -306,7 +407,10 @@ func evalIndex(n *IndexNode, scope Scope) (types.Value, error) {
 	if err != nil {
 		return types.Null, err
 	}
+	return getIndex(obj, idx)
+}
 
+func getIndex(obj, idx types.Value) (types.Value, error) {
 	switch obj.Type() {
 	case types.TypeList:
 		if idx.Type() != types.TypeInt {
@@ -357,6 +461,10 @@ func evalCall(n *CallNode, scope Scope) (types.Value, error) {
 	// Build the function name from the node
 	name := functionName(n.Function)
 
+	if name == "if" && len(n.Args) == 3 {
+		return evalIf(n, scope)
+	}
+
 	// Evaluate arguments
 	args := make([]types.Value, len(n.Args))
 	for i, arg := range n.Args {
@@ -370,6 +478,24 @@ func evalCall(n *CallNode, scope Scope) (types.Value, error) {
 	return scope.CallFunction(name, args)
 }
 
+// evalIf evaluates if(condition, ifTrue, ifFalse) lazily: only the branch
+// selected by the condition is evaluated, so the other may reference keys
+// that do not exist.
+func evalIf(n *CallNode, scope Scope) (types.Value, error) {
+	cond, err := Evaluate(n.Args[0], scope)
+	if err != nil {
+		return types.Null, err
+	}
+	if cond.Type() != types.TypeBool {
+		return types.Null, types.NewTypeError(
+			fmt.Sprintf("if() condition must be a bool, got %s", cond.Type()))
+	}
+	if cond.AsBool() {
+		return Evaluate(n.Args[1], scope)
+	}
+	return Evaluate(n.Args[2], scope)
+}
+
 // functionName extracts the dotted function name from a node.
 func functionName(node Node) string {
 	switch n := node.(type) {
@@ -2,6 +2,9 @@ package expr
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
@@ -108,6 +111,43 @@ func TestArithmeticExpressions(t *testing.T) {
 	}
 }
 
+// TestModuloSign checks that % truncates like GCW: the result takes the sign
+// of the dividend, for both integer and double operands.
+func TestModuloSign(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input string
+		want  types.Value
+	}{
+		{"7 % 3", types.NewInt(1)},
+		{"-7 % 3", types.NewInt(-1)},
+		{"7 % -3", types.NewInt(1)},
+		{"-7 % -3", types.NewInt(-1)},
+		{"7.5 % 2", types.NewDouble(1.5)},
+		{"-7.5 % 2", types.NewDouble(-1.5)},
+		{"7.5 % -2", types.NewDouble(1.5)},
+		{"-7.5 % -2.0", types.NewDouble(-1.5)},
+		{"-7 % 2.5", types.NewDouble(-2.0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if got.Type() != tt.want.Type() || !got.Equal(tt.want) {
+				t.Errorf("got %v (%s), want %v (%s)", got, got.Type(), tt.want, tt.want.Type())
+			}
+		})
+	}
+}
+
 func TestComparisonExpressions(t *testing.T) {
 	scope := newTestScope()
 
@@ -147,6 +187,120 @@ func TestComparisonExpressions(t *testing.T) {
 	}
 }
 
+func TestContainerEquality(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 3]", true},
+		{`{"a": 1} == {"a": 1}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if got.Type() != types.TypeBool || got.AsBool() != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerOrderingIsTypeError(t *testing.T) {
+	scope := newTestScope()
+
+	for _, input := range []string{"[1] < [2]", `{"a": 1} >= {"a": 1}`, "[1] > 1"} {
+		t.Run(input, func(t *testing.T) {
+			node, err := ParseExpression(input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			_, err = Evaluate(node, scope)
+			if err == nil {
+				t.Fatal("expected TypeError for ordering comparison on list/map")
+			}
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T", err)
+			}
+			if !we.HasTag(types.TagTypeError) {
+				t.Errorf("expected TypeError tag, got %v", we.Tags)
+			}
+			if !strings.Contains(we.Message, "cannot order list/map") {
+				t.Errorf("expected clear ordering message, got %q", we.Message)
+			}
+		})
+	}
+}
+
+func TestMixedTypeEquality(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`"a" == 1`, false},
+		{`"a" != 1`, true},
+		{`"1" == 1`, false},
+		{"true == 1", false},
+		{"null == false", false},
+		{`null != ""`, true},
+		{"[1] == 1", false},
+		{`{"a": 1} == [1]`, false},
+		{"1 == 1.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if got.Type() != types.TypeBool || got.AsBool() != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixedTypeOrderingIsTypeError(t *testing.T) {
+	scope := newTestScope()
+
+	for _, input := range []string{`"a" < 1`, `1 >= "1"`, "true > false", "null <= 0", `"b" > null`} {
+		t.Run(input, func(t *testing.T) {
+			node, err := ParseExpression(input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			_, err = Evaluate(node, scope)
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+			}
+			if !we.HasTag(types.TagTypeError) {
+				t.Errorf("expected TypeError tag, got %v", we.Tags)
+			}
+		})
+	}
+}
+
 func TestLogicalExpressions(t *testing.T) {
 	scope := newTestScope()
 
@@ -181,6 +335,138 @@ func TestLogicalExpressions(t *testing.T) {
 	}
 }
 
+func TestNullCoalescePrecedence(t *testing.T) {
+	// a ?? b ?? c groups as a ?? (b ?? c)
+	node, err := ParseExpression("a ?? b ?? c")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	bin, ok := node.(*BinaryNode)
+	if !ok || bin.Op != TokenCoalesce {
+		t.Fatalf("expected ?? at the root, got %#v", node)
+	}
+	if _, ok := bin.Left.(*IdentNode); !ok {
+		t.Errorf("left = %#v, want identifier", bin.Left)
+	}
+	if right, ok := bin.Right.(*BinaryNode); !ok || right.Op != TokenCoalesce {
+		t.Errorf("right = %#v, want nested ??", bin.Right)
+	}
+
+	// ?? binds looser than or, so a or b ?? c groups as (a or b) ?? c
+	node, err = ParseExpression("a or b ?? c")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	bin, ok = node.(*BinaryNode)
+	if !ok || bin.Op != TokenCoalesce {
+		t.Fatalf("expected ?? at the root, got %#v", node)
+	}
+	if left, ok := bin.Left.(*BinaryNode); !ok || left.Op != TokenOr {
+		t.Errorf("left = %#v, want or", bin.Left)
+	}
+
+	scope := newTestScope()
+	scope.vars["x"] = types.Null
+	tests := []struct {
+		input string
+		want  types.Value
+	}{
+		{"x ?? 1 + 2", types.NewInt(3)},
+		{"x ?? 1 == 1", types.NewBool(true)},
+		{"x ?? null ?? \"c\"", types.NewString("c")},
+		{"(x ?? 1) + 2", types.NewInt(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNullCoalesce(t *testing.T) {
+	scope := newTestScope()
+	m := types.NewOrderedMap()
+	m.Set("a", types.NewInt(1))
+	m.Set("n", types.Null)
+	scope.vars["obj"] = types.NewMap(m)
+	scope.vars["x"] = types.Null
+	scope.vars["zero"] = types.NewInt(0)
+	scope.funcs["boom"] = func(args []types.Value) (types.Value, error) {
+		t.Error("right operand evaluated although left was non-null")
+		return types.Null, nil
+	}
+
+	tests := []struct {
+		input string
+		want  types.Value
+	}{
+		{"x ?? \"default\"", types.NewString("default")},
+		{"obj.n ?? 2", types.NewInt(2)},
+		{"obj.a ?? 2", types.NewInt(1)},
+		{"zero ?? 2", types.NewInt(0)},
+		{"false ?? true", types.NewBool(false)},
+		{"obj.missing ?? 3", types.NewInt(3)},
+		{"obj[\"missing\"] ?? 3", types.NewInt(3)},
+		{"undefined ?? 4", types.NewInt(4)},
+		{"obj.a ?? boom()", types.NewInt(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNullCoalesceKeepsOtherErrors(t *testing.T) {
+	scope := newTestScope()
+	scope.vars["items"] = types.NewList([]types.Value{types.NewInt(1)})
+	scope.vars["cfg"] = types.NewMap(types.NewOrderedMap())
+	scope.funcs["f"] = func(args []types.Value) (types.Value, error) {
+		return args[0], nil
+	}
+
+	// Only a KeyError from the outermost lookup counts as null.
+	for _, input := range []string{
+		"1 / 0 ?? 2",
+		"items[5] ?? 2",
+		"x ?? obj.missing",
+		"f(cfg.missing) ?? 2",
+		"cfg[cfg.missing] ?? 2",
+		"cfg.missing.inner ?? 2",
+		"missing.inner ?? 2",
+	} {
+		t.Run(input, func(t *testing.T) {
+			node, err := ParseExpression(input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			if _, err := Evaluate(node, scope); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	scope := newTestScope()
 
@@ -217,6 +503,145 @@ func TestStringPlusNonStringIsTypeError(t *testing.T) {
 	}
 }
 
+func TestArithmeticOnNonNumbersIsTypeError(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"true + 1", "unsupported operand types for +: bool and int"},
+		{"[1, 2] - [3]", "unsupported operand types for -: list and list"},
+		{"{} - {}", "unsupported operand types for -: map and map"},
+		{"2 * false", "unsupported operand types for *: int and bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			_, err = Evaluate(node, scope)
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T (%v)", err, err)
+			}
+			if !we.HasTag(types.TagTypeError) {
+				t.Errorf("expected TypeError tag, got %v", we.Tags)
+			}
+			if we.Message != tt.message {
+				t.Errorf("message = %q, want %q", we.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestMapPlusIsTypeError(t *testing.T) {
+	scope := newTestScope()
+
+	for _, input := range []string{`{"a": 1} + {"b": 2}`, "{} + {}", `{"a": 1} + 1`} {
+		t.Run(input, func(t *testing.T) {
+			node, err := ParseExpression(input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			_, err = Evaluate(node, scope)
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T (%v)", err, err)
+			}
+			if !we.HasTag(types.TagTypeError) {
+				t.Errorf("expected TypeError tag, got %v", we.Tags)
+			}
+			if !strings.Contains(we.Message, "maps cannot be added; use map.merge") {
+				t.Errorf("expected message pointing at map.merge, got %q", we.Message)
+			}
+		})
+	}
+}
+
+func TestIntegerOverflowIsValueError(t *testing.T) {
+	scope := newTestScope()
+	scope.vars["max"] = types.NewInt(math.MaxInt64)
+	scope.vars["min"] = types.NewInt(math.MinInt64)
+
+	for _, input := range []string{"max + 1", "min - 1", "max * 2", "min * -1", "-1 * min", "3037000500 * 3037000500", "-min"} {
+		t.Run(input, func(t *testing.T) {
+			node, err := ParseExpression(input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err == nil {
+				t.Fatalf("expected overflow error, got %v", got)
+			}
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T (%v)", err, err)
+			}
+			if !we.HasTag(types.TagValueError) {
+				t.Errorf("expected ValueError tag, got %v", we.Tags)
+			}
+		})
+	}
+
+	// Results at the edges of the int64 range are exact
+	for input, want := range map[string]int64{
+		"max - 1 + 1": math.MaxInt64,
+		"min + max":   -1,
+		"min * 1":     math.MinInt64,
+		"max * -1":    -math.MaxInt64,
+		"-max":        -math.MaxInt64,
+		"-(min + 1)":  math.MaxInt64,
+	} {
+		node, err := ParseExpression(input)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", input, err)
+		}
+		got, err := Evaluate(node, scope)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", input, err)
+		}
+		if got.Type() != types.TypeInt || got.AsInt() != want {
+			t.Errorf("%s = %v, want %d", input, got, want)
+		}
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input string
+		want  types.Value
+	}{
+		{"1_000_000", types.NewInt(1000000)},
+		{"9223372036854775807", types.NewInt(math.MaxInt64)},
+		{"1234567890123456789", types.NewInt(1234567890123456789)},
+		{"1.5e3", types.NewDouble(1500)},
+		{"2E-2", types.NewDouble(0.02)},
+		{"1_000.000_5", types.NewDouble(1000.0005)},
+		{"1_000 + 1", types.NewInt(1001)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if got.Type() != tt.want.Type() || !got.Equal(tt.want) {
+				t.Errorf("got %v (%s), want %v (%s)", got, got.Type(), tt.want, tt.want.Type())
+			}
+		})
+	}
+}
+
 func TestVariableAccess(t *testing.T) {
 	scope := newTestScope()
 	scope.vars["x"] = types.NewInt(42)
@@ -336,6 +761,67 @@ func TestFunctionCall(t *testing.T) {
 	}
 }
 
+func TestIfEvaluatesOnlySelectedBranch(t *testing.T) {
+	scope := newTestScope()
+	m := types.NewOrderedMap()
+	m.Set("field", types.NewString("value"))
+	scope.vars["x"] = types.NewMap(m)
+	scope.vars["y"] = types.Null
+
+	tests := []struct {
+		input string
+		want  types.Value
+	}{
+		{`if(x != null, x.field, "default")`, types.NewString("value")},
+		{`if(y != null, y.field, "default")`, types.NewString("default")},
+		{`if(true, 1, missing)`, types.NewInt(1)},
+		{`if(false, x.missing, 2)`, types.NewInt(2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			got, err := Evaluate(node, scope)
+			if err != nil {
+				t.Fatalf("eval error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIfErrors(t *testing.T) {
+	scope := newTestScope()
+
+	tests := []struct {
+		input string
+		tag   string
+	}{
+		{`if(1, "a", "b")`, types.TagTypeError},
+		{`if(true, x.missing, "b")`, types.TagKeyError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := ParseExpression(tt.input)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			_, err = Evaluate(node, scope)
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %v", err)
+			}
+			if !we.HasTag(tt.tag) {
+				t.Errorf("expected %s tag, got %v", tt.tag, we.Tags)
+			}
+		})
+	}
+}
+
 func TestDivisionByZero(t *testing.T) {
 	scope := newTestScope()
 
@@ -476,6 +962,27 @@ func TestIndexOutOfRange(t *testing.T) {
 	}
 }
 
+func TestMapLiteralKeepsKeyOrder(t *testing.T) {
+	scope := newTestScope()
+	scope.vars["k"] = types.NewString("b")
+
+	node, err := ParseExpression(`{"z": 1, "a": 2, k: 3, "m": {"y": 4, "x": 5}}`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	got, err := Evaluate(node, scope)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	if keys := got.AsMap().Keys(); !slices.Equal(keys, []string{"z", "a", "b", "m"}) {
+		t.Errorf("keys = %v, want [z a b m]", keys)
+	}
+	inner, _ := got.AsMap().Get("m")
+	if keys := inner.AsMap().Keys(); !slices.Equal(keys, []string{"y", "x"}) {
+		t.Errorf("nested keys = %v, want [y x]", keys)
+	}
+}
+
 func TestMissingMapKey(t *testing.T) {
 	scope := newTestScope()
 	m := types.NewOrderedMap()
@@ -76,6 +76,9 @@ func (l *Lexer) next() (Token, error) {
 		case ">=":
 			l.pos += 2
 			return Token{Type: TokenGte, Value: ">=", Pos: l.pos - 2}, nil
+		case "??":
+			l.pos += 2
+			return Token{Type: TokenCoalesce, Value: "??", Pos: l.pos - 2}, nil
 		}
 	}
 
@@ -195,6 +198,10 @@ func (l *Lexer) readNumber() (Token, error) {
 		ch := l.input[l.pos]
 		if ch >= '0' && ch <= '9' {
 			l.pos++
+		} else if ch == '_' && l.pos > start && isDigit(l.input[l.pos-1]) &&
+			l.pos+1 < len(l.input) && isDigit(l.input[l.pos+1]) {
+			// Digit separator, as in 1_000_000
+			l.pos++
 		} else if ch == '.' && !isFloat {
 			// Check it's not a method call like 123.toString
 			if l.pos+1 < len(l.input) && l.input[l.pos+1] >= '0' && l.input[l.pos+1] <= '9' {
@@ -215,15 +222,16 @@ func (l *Lexer) readNumber() (Token, error) {
 	}
 
 	raw := l.input[start:l.pos]
+	digits := strings.ReplaceAll(raw, "_", "")
 	if isFloat {
-		f, err := strconv.ParseFloat(raw, 64)
+		f, err := strconv.ParseFloat(digits, 64)
 		if err != nil {
 			return Token{}, fmt.Errorf("invalid float %q at position %d", raw, start)
 		}
 		return Token{Type: TokenFloat, Value: raw, FloatVal: f, Pos: start}, nil
 	}
 
-	i, err := strconv.ParseInt(raw, 10, 64)
+	i, err := strconv.ParseInt(digits, 10, 64)
 	if err != nil {
 		return Token{}, fmt.Errorf("invalid integer %q at position %d", raw, start)
 	}
@@ -271,3 +279,7 @@ func isIdentStart(ch byte) bool {
 func isIdentPart(ch byte) bool {
 	return isIdentStart(ch) || (ch >= '0' && ch <= '9')
 }
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -247,6 +247,7 @@ func (p *Parser) expect(tt TokenType) (Token, error) {
 
 // parseExpression is the entry point: handles the lowest precedence operators.
 // Precedence (low to high):
+//   ?? (right-associative)
 //   or
 //   and
 //   not
@@ -257,7 +258,24 @@ func (p *Parser) expect(tt TokenType) (Token, error) {
 //   unary -, unary not
 //   property access, index, function call
 func (p *Parser) parseExpression() (Node, error) {
-	return p.parseOr()
+	return p.parseCoalesce()
+}
+
+func (p *Parser) parseCoalesce() (Node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.current().Type == TokenCoalesce {
+		p.advance()
+		right, err := p.parseCoalesce()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: TokenCoalesce, Left: left, Right: right}
+	}
+	return left, nil
 }
 
 func (p *Parser) parseOr() (Node, error) {
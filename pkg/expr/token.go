@@ -53,6 +53,9 @@ const (
 	// Membership
 	TokenIn // in
 
+	// Null coalescing
+	TokenCoalesce // ??
+
 	// Special
 	TokenEOF // end of expression
 )
@@ -134,6 +137,8 @@ func (t TokenType) String() string {
 		return "NOT"
 	case TokenIn:
 		return "IN"
+	case TokenCoalesce:
+		return "COALESCE"
 	case TokenEOF:
 		return "EOF"
 	default:
@@ -0,0 +1,51 @@
+// Package logging builds the structured logger used for execution lifecycle
+// events, so that log lines can be correlated by execution, workflow, and step.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Supported log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Correlation field names attached to execution log records.
+const (
+	KeyExecution = "execution"
+	KeyWorkflow  = "workflow"
+	KeyStep      = "step"
+)
+
+// New returns a logger writing records to w in the given format. All levels,
+// including debug, are written.
+func New(format string, w io.Writer) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch format {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want %q or %q)", format, FormatText, FormatJSON)
+	}
+}
+
+// Default returns a text logger writing to stderr.
+func Default() *slog.Logger {
+	l, _ := New(FormatText, os.Stderr)
+	return l
+}
+
+// ForExecution returns l with the execution name and its parent workflow name
+// attached to every record.
+func ForExecution(l *slog.Logger, execName string) *slog.Logger {
+	workflow, _, _ := strings.Cut(execName, "/executions/")
+	return l.With(KeyExecution, execName, KeyWorkflow, workflow)
+}
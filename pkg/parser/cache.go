@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
+)
+
+// DefaultCacheSize is the number of parsed sources a Cache keeps before it
+// evicts the least recently used one.
+const DefaultCacheSize = 256
+
+// Cache memoizes Parse by a hash of the workflow source, so identical source
+// is parsed once however many times it is deployed or executed. Parse errors
+// are not cached. A Cache is safe for concurrent use: sources are parsed
+// outside its lock, and concurrent calls for the same source share one
+// parse. It holds at most DefaultCacheSize sources, so old revisions of
+// edited workflows are eventually dropped.
+//
+// The returned ASTs are shared between callers and must not be modified.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element // values are *cacheEntry
+	lru     *list.List                          // most recently used first
+	size    int                                 // max entries
+	parses  int
+	strict  bool
+}
+
+// cacheEntry is one cached source. done is closed once wf and err are set.
+type cacheEntry struct {
+	key  [sha256.Size]byte
+	done chan struct{}
+	wf   *ast.Workflow
+	err  error
+}
+
+// NewCache creates an empty parse cache.
+func NewCache() *Cache {
+	return &Cache{
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+		size:    DefaultCacheSize,
+	}
+}
+
+// SetStrict makes the cache parse with ParseStrict instead of Parse. It drops
+// any entries already cached, since they were not checked the same way.
+func (c *Cache) SetStrict(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strict = on
+	c.entries = make(map[[sha256.Size]byte]*list.Element)
+	c.lru.Init()
+}
+
+// Parse returns the cached AST for source, parsing it on the first call.
+func (c *Cache) Parse(source []byte) (*ast.Workflow, error) {
+	key := sha256.Sum256(source)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		e := el.Value.(*cacheEntry)
+		<-e.done
+		return e.wf, e.err
+	}
+	e := &cacheEntry{key: key, done: make(chan struct{})}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	c.parses++
+	parse := Parse
+	if c.strict {
+		parse = ParseStrict
+	}
+	c.mu.Unlock()
+
+	e.wf, e.err = parse(source)
+	close(e.done)
+	if e.err != nil {
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok && el.Value == e {
+			c.remove(el)
+		}
+		c.mu.Unlock()
+	}
+	return e.wf, e.err
+}
+
+// remove drops a cached entry. The caller must hold c.mu.
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// Parses returns the number of times the cache has called Parse, i.e. the
+// number of cache misses.
+func (c *Cache) Parses() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.parses
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
+)
+
+// cacheSource returns a distinct valid workflow for each n.
+func cacheSource(n int) []byte {
+	return []byte(fmt.Sprintf("main:\n  steps:\n    - done:\n        return: %d\n", n))
+}
+
+func TestCacheSharesConcurrentParses(t *testing.T) {
+	c := NewCache()
+	src := cacheSource(1)
+
+	var wg sync.WaitGroup
+	results := make([]*ast.Workflow, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wf, err := c.Parse(src)
+			if err != nil {
+				t.Errorf("parse: %v", err)
+			}
+			results[i] = wf
+		}()
+	}
+	wg.Wait()
+
+	if n := c.Parses(); n != 1 {
+		t.Errorf("source parsed %d times, want 1", n)
+	}
+	for i, wf := range results {
+		if wf != results[0] {
+			t.Errorf("call %d got a different AST", i)
+		}
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache()
+	c.size = 2
+
+	for _, n := range []int{1, 2, 1, 3} {
+		if _, err := c.Parse(cacheSource(n)); err != nil {
+			t.Fatalf("parse %d: %v", n, err)
+		}
+	}
+	if n := c.lru.Len(); n != 2 {
+		t.Fatalf("%d sources cached, want 2", n)
+	}
+
+	// 2 was least recently used when 3 was added
+	before := c.Parses()
+	c.Parse(cacheSource(1))
+	if c.Parses() != before {
+		t.Error("source 1 was re-parsed, want it cached")
+	}
+	c.Parse(cacheSource(2))
+	if c.Parses() != before+1 {
+		t.Error("source 2 was not re-parsed, want it evicted")
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	c := NewCache()
+	src := []byte("helper:\n  steps:\n    - done:\n        return: 1\n")
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Parse(src); err == nil {
+			t.Fatal("expected a parse error")
+		}
+	}
+	if n := c.Parses(); n != 2 {
+		t.Errorf("invalid source parsed %d times, want 2", n)
+	}
+	if n := c.lru.Len(); n != 0 {
+		t.Errorf("%d sources cached after errors, want 0", n)
+	}
+}
@@ -2,7 +2,12 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
@@ -20,55 +25,97 @@ func preprocessSource(source []byte) []byte {
 
 	var result strings.Builder
 	for _, line := range strings.Split(s, "\n") {
+		result.WriteString(quoteMapLiterals(line))
+		result.WriteByte('\n')
+	}
+	return []byte(strings.TrimRight(result.String(), "\n"))
+}
+
+// quoteMapLiterals wraps each ${{ ... }} region of line in a YAML single-quoted
+// string. The region ends at the brace that balances its opening "${", so
+// nested maps and braces inside string literals stay within it. Literals the
+// author already quoted are left alone.
+func quoteMapLiterals(line string) string {
+	var result strings.Builder
+	for {
 		idx := strings.Index(line, "${{")
-		if idx >= 0 {
-			// Find the matching closing }} accounting for strings
-			rest := line[idx:]
-			depth := 0
-			inStr := false
-			strChar := byte(0)
-			end := -1
-			for i := 0; i < len(rest); i++ {
-				ch := rest[i]
-				if inStr {
-					if ch == '\\' && i+1 < len(rest) {
-						i++ // skip escaped char
-						continue
-					}
-					if ch == strChar {
-						inStr = false
-					}
-					continue
-				}
-				if ch == '"' || ch == '\'' {
-					inStr = true
-					strChar = ch
-					continue
-				}
-				if ch == '{' {
-					depth++
-				} else if ch == '}' {
-					depth--
-					if depth == 0 {
-						end = i + 1
-						break
-					}
-				}
+		if idx < 0 {
+			break
+		}
+		prefix := line[:idx]
+		end := balancedEnd(line[idx:])
+		if end < 0 || alreadyQuoted(prefix) {
+			result.WriteString(line[:idx+3])
+			line = line[idx+3:]
+			continue
+		}
+		expr := line[idx : idx+end]
+		result.WriteString(prefix + "'" + strings.ReplaceAll(expr, "'", "''") + "'")
+		line = line[idx+end:]
+	}
+	result.WriteString(line)
+	return result.String()
+}
+
+// balancedEnd returns the length of the brace-balanced region at the start of
+// s, skipping braces inside quoted strings, or -1 if it is not closed.
+func balancedEnd(s string) int {
+	depth := 0
+	inStr := false
+	strChar := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if inStr {
+			if ch == '\\' && i+1 < len(s) {
+				i++ // skip escaped char
+				continue
 			}
-			if end > 0 {
-				expr := rest[:end]
-				prefix := line[:idx]
-				suffix := line[idx+end:]
-				result.WriteString(prefix + "'" + expr + "'" + suffix)
-			} else {
-				result.WriteString(line)
+			if ch == strChar {
+				inStr = false
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			inStr = true
+			strChar = ch
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
 			}
-		} else {
-			result.WriteString(line)
 		}
-		result.WriteByte('\n')
 	}
-	return []byte(strings.TrimRight(result.String(), "\n"))
+	return -1
+}
+
+// alreadyQuoted reports whether text following prefix is inside a YAML
+// quoted scalar, i.e. prefix leaves a single- or double-quoted string open.
+func alreadyQuoted(prefix string) bool {
+	var open byte
+	for i := 0; i < len(prefix); i++ {
+		ch := prefix[i]
+		switch {
+		case open == 0 && (ch == '"' || ch == '\''):
+			// Quotes only open a scalar at its start, e.g. after ": " or "- "
+			if before := strings.TrimRight(prefix[:i], " \t"); before == "" ||
+				strings.HasSuffix(before, ":") || strings.HasSuffix(before, "-") ||
+				strings.HasSuffix(before, "[") || strings.HasSuffix(before, ",") {
+				open = ch
+			}
+		case open == '"' && ch == '\\':
+			i++
+		case open == ch:
+			if ch == '\'' && i+1 < len(prefix) && prefix[i+1] == '\'' {
+				i++ // '' is an escaped quote
+				continue
+			}
+			open = 0
+		}
+	}
+	return open != 0
 }
 
 // MaxAssignments is the maximum number of assignments per assign step.
@@ -80,6 +127,9 @@ const MaxConditions = 50
 // MaxBranches is the maximum number of branches per parallel step.
 const MaxBranches = 10
 
+// MaxRetries is the maximum max_retries value of a retry policy.
+const MaxRetries = 100
+
 // MaxSourceSize is the maximum workflow source code size in bytes (128 KB).
 const MaxSourceSize = 128 * 1024
 
@@ -102,21 +152,10 @@ func Parse(source []byte) (*ast.Workflow, error) {
 		return nil, &ParseError{Message: fmt.Sprintf("workflow source size %d exceeds maximum %d bytes", len(source), MaxSourceSize)}
 	}
 
-	// Preprocess ${{ }} map literal syntax before YAML parsing
-	source = preprocessSource(source)
-
-	// Parse YAML into a generic map
-	var raw yaml.Node
-	if err := yaml.Unmarshal(source, &raw); err != nil {
-		return nil, &ParseError{Message: fmt.Sprintf("invalid YAML: %v", err)}
+	rootNode, err := decodeSource(source)
+	if err != nil {
+		return nil, err
 	}
-
-	// The root node is a document node containing the actual content
-	if raw.Kind != yaml.DocumentNode || len(raw.Content) == 0 {
-		return nil, &ParseError{Message: "empty workflow definition"}
-	}
-
-	rootNode := raw.Content[0]
 	if rootNode.Kind != yaml.MappingNode {
 		return nil, &ParseError{Message: "workflow definition must be a mapping"}
 	}
@@ -144,12 +183,123 @@ func Parse(source []byte) (*ast.Workflow, error) {
 	}
 
 	if workflow.Main == nil {
-		return nil, &ParseError{Message: "workflow must have a 'main' workflow"}
+		return nil, &ParseError{Message: "workflow must have a 'main' workflow", Location: "top level"}
+	}
+
+	if err := checkRetryPredicates(workflow); err != nil {
+		return nil, err
 	}
 
 	return workflow, nil
 }
 
+// CanonicalJSON re-serializes a YAML or JSON workflow definition as JSON with
+// map keys sorted, so equivalent definitions produce identical output. The
+// source must already parse with Parse.
+func CanonicalJSON(source []byte) ([]byte, error) {
+	rootNode, err := decodeSource(source)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(nodeToInterface(rootNode))
+}
+
+// decodeSource parses workflow source into the YAML node of its single
+// document, with anchors and aliases resolved.
+func decodeSource(source []byte) (*yaml.Node, error) {
+	// Preprocess ${{ }} map literal syntax before YAML parsing
+	dec := yaml.NewDecoder(bytes.NewReader(preprocessSource(source)))
+
+	var raw yaml.Node
+	if err := dec.Decode(&raw); err != nil {
+		if err == io.EOF {
+			return nil, &ParseError{Message: "empty workflow definition"}
+		}
+		return nil, yamlSyntaxError(err)
+	}
+
+	// The root node is a document node containing the actual content
+	if raw.Kind != yaml.DocumentNode || len(raw.Content) == 0 {
+		return nil, &ParseError{Message: "empty workflow definition"}
+	}
+
+	// A workflow is one document; later ones would otherwise be ignored
+	var extra yaml.Node
+	if err := dec.Decode(&extra); err != io.EOF {
+		return nil, &ParseError{Message: "multiple YAML documents are not supported: a workflow definition must be a single document"}
+	}
+
+	return expandAliases(raw.Content[0]), nil
+}
+
+// yamlSyntaxError converts a YAML decoding error into a ParseError, moving
+// the line yaml.v3 reports ("yaml: line 3: ...") into the location.
+func yamlSyntaxError(err error) *ParseError {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if rest, ok := strings.CutPrefix(msg, "line "); ok {
+		if n, detail, ok := strings.Cut(rest, ": "); ok {
+			if _, convErr := strconv.Atoi(n); convErr == nil {
+				return &ParseError{Message: "invalid YAML: " + detail, Location: "line " + n}
+			}
+		}
+	}
+	return &ParseError{Message: "invalid YAML: " + msg}
+}
+
+// expandAliases returns a copy of node with every alias replaced by a copy of
+// the node it refers to, and every merge key ("<<: *anchor") replaced by the
+// entries of the merged mappings. Keys set explicitly in a mapping take
+// precedence over merged ones, and earlier merged mappings over later ones.
+func expandAliases(node *yaml.Node) *yaml.Node {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return expandAliases(node.Alias)
+	case yaml.MappingNode:
+		out := *node
+		out.Content = nil
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !isMergeKey(node.Content[i]) {
+				seen[node.Content[i].Value] = true
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if !isMergeKey(key) {
+				out.Content = append(out.Content, key, expandAliases(val))
+				continue
+			}
+			merged := []*yaml.Node{val}
+			if val.Kind == yaml.SequenceNode {
+				merged = val.Content
+			}
+			for _, m := range merged {
+				m = expandAliases(m)
+				for j := 0; j+1 < len(m.Content); j += 2 {
+					if !seen[m.Content[j].Value] {
+						seen[m.Content[j].Value] = true
+						out.Content = append(out.Content, m.Content[j], m.Content[j+1])
+					}
+				}
+			}
+		}
+		return &out
+	case yaml.SequenceNode, yaml.DocumentNode:
+		out := *node
+		out.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			out.Content[i] = expandAliases(child)
+		}
+		return &out
+	}
+	return node
+}
+
+// isMergeKey reports whether a mapping key is the YAML merge key "<<".
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" && key.Tag == "!!merge"
+}
+
 // parseSubworkflow parses a single workflow/subworkflow body.
 func parseSubworkflow(name string, node *yaml.Node) (*ast.Subworkflow, error) {
 	sub := &ast.Subworkflow{Name: name}
@@ -189,7 +339,7 @@ func parseSubworkflow(name string, node *yaml.Node) (*ast.Subworkflow, error) {
 			sub.Steps = steps
 		default:
 			return nil, &ParseError{
-				Message:  fmt.Sprintf("unknown key '%s' in workflow body", key),
+				Message:  fmt.Sprintf("unknown key '%s' in workflow body%s", key, didYouMean(key, workflowBodyKeys)),
 				Location: fmt.Sprintf("workflow '%s'", name),
 			}
 		}
@@ -255,6 +405,7 @@ func parseSteps(node *yaml.Node, context string) ([]*ast.Step, error) {
 	}
 
 	var steps []*ast.Step
+	seen := make(map[string]bool)
 	for _, item := range node.Content {
 		if item.Kind != yaml.MappingNode || len(item.Content) != 2 {
 			return nil, &ParseError{
@@ -266,6 +417,15 @@ func parseSteps(node *yaml.Node, context string) ([]*ast.Step, error) {
 		stepName := item.Content[0].Value
 		stepBody := item.Content[1]
 
+		// next jumps are resolved by name, so names must be unique per block
+		if seen[stepName] {
+			return nil, &ParseError{
+				Message:  fmt.Sprintf("duplicate step name '%s' (line %d)", stepName, item.Content[0].Line),
+				Location: context,
+			}
+		}
+		seen[stepName] = true
+
 		step, err := parseStep(stepName, stepBody, context)
 		if err != nil {
 			return nil, err
@@ -317,9 +477,6 @@ func parseStep(name string, body *yaml.Node, context string) (*ast.Step, error)
 			step.Call.Args = args
 
 		case "result":
-			if step.Call != nil {
-				step.Call.Result = val.Value
-			}
 			step.Result = val.Value
 
 		case "switch":
@@ -373,6 +530,16 @@ func parseStep(name string, body *yaml.Node, context string) (*ast.Step, error)
 			}
 			step.Try.Retry = retry
 
+		case "finally":
+			if step.Try == nil {
+				step.Try = &ast.TryExpr{}
+			}
+			finally, err := parseFinally(val, loc)
+			if err != nil {
+				return nil, err
+			}
+			step.Try.Finally = finally
+
 		case "raise":
 			step.Raise = nodeToInterface(val)
 
@@ -392,12 +559,31 @@ func parseStep(name string, body *yaml.Node, context string) (*ast.Step, error)
 
 		default:
 			return nil, &ParseError{
-				Message:  fmt.Sprintf("unknown step key '%s'", key),
+				Message:  fmt.Sprintf("unknown step key '%s'%s", key, didYouMean(key, stepKeys)),
 				Location: loc,
 			}
 		}
 	}
 
+	if step.Try != nil && step.Try.Finally != nil && step.Try.Try == nil {
+		return nil, &ParseError{
+			Message:  "'finally' is only allowed on try steps",
+			Location: loc,
+		}
+	}
+
+	// result may precede call in the step body, so it is attached once all
+	// keys are read. GCW only allows it on call steps.
+	if step.Result != "" {
+		if step.Call == nil {
+			return nil, &ParseError{
+				Message:  "'result' is only allowed on call steps",
+				Location: loc,
+			}
+		}
+		step.Call.Result = step.Result
+	}
+
 	return step, nil
 }
 
@@ -696,6 +882,23 @@ func parseExcept(node *yaml.Node, loc string) (*ast.ExceptExpr, error) {
 	return except, nil
 }
 
+// parseFinally parses the finally clause of a try step, given either as a
+// mapping with a steps key (like except) or directly as a list of steps.
+func parseFinally(node *yaml.Node, loc string) ([]*ast.Step, error) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "steps" {
+				return parseSteps(node.Content[i+1], loc+" (finally)")
+			}
+		}
+		return nil, &ParseError{
+			Message:  "finally must have 'steps'",
+			Location: loc,
+		}
+	}
+	return parseSteps(node, loc+" (finally)")
+}
+
 // parseRetry parses the retry clause of a try step.
 func parseRetry(node *yaml.Node, loc string) (*ast.RetryExpr, error) {
 	if node.Kind != yaml.MappingNode {
@@ -715,6 +918,12 @@ func parseRetry(node *yaml.Node, loc string) (*ast.RetryExpr, error) {
 			retry.Predicate = nodeToInterface(val)
 		case "max_retries":
 			retry.MaxRetries = intFromNode(val)
+			if retry.MaxRetries < 0 || retry.MaxRetries > MaxRetries {
+				return nil, &ParseError{
+					Message:  fmt.Sprintf("max_retries must be between 0 and %d, got %d", MaxRetries, retry.MaxRetries),
+					Location: loc,
+				}
+			}
 		case "backoff":
 			backoff, err := parseBackoff(val, loc)
 			if err != nil {
@@ -727,6 +936,101 @@ func parseRetry(node *yaml.Node, loc string) (*ast.RetryExpr, error) {
 	return retry, nil
 }
 
+// retryPredicates lists the built-in retry predicates.
+var retryPredicates = []string{
+	"http.default_retry",
+	"http.default_retry_predicate",
+	"http.default_retry_non_idempotent",
+	"retry.always",
+	"retry.never",
+}
+
+// checkRetryPredicates rejects retry predicates that name neither a built-in
+// predicate nor a subworkflow of wf, with or without a ${} wrapper.
+func checkRetryPredicates(wf *ast.Workflow) error {
+	valid := append([]string(nil), retryPredicates...)
+	for name := range wf.Subworkflows {
+		valid = append(valid, name)
+	}
+
+	check := func(step *ast.Step, loc string) error {
+		if step.Try == nil || step.Try.Retry == nil || step.Try.Retry.Predicate == nil {
+			return nil
+		}
+		pred, ok := step.Try.Retry.Predicate.(string)
+		if !ok {
+			return &ParseError{
+				Message:  "retry predicate must be the name of a built-in predicate or a subworkflow",
+				Location: loc,
+			}
+		}
+		name := strings.TrimSpace(pred)
+		if strings.HasPrefix(name, "${") && strings.HasSuffix(name, "}") {
+			name = strings.TrimSpace(name[2 : len(name)-1])
+		}
+		for _, v := range valid {
+			if name == v {
+				return nil
+			}
+		}
+		return &ParseError{
+			Message: fmt.Sprintf("unknown retry predicate '%s'; use a built-in predicate or the name of a subworkflow%s",
+				name, didYouMean(name, valid)),
+			Location: loc,
+		}
+	}
+
+	if err := walkSteps(wf.Main.Steps, "main", check); err != nil {
+		return err
+	}
+	for name, sub := range wf.Subworkflows {
+		if err := walkSteps(sub.Steps, name, check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkSteps calls fn for each of steps and every step nested in them, in
+// order, with a location describing the step. It stops at the first error.
+func walkSteps(steps []*ast.Step, context string, fn func(step *ast.Step, loc string) error) error {
+	for _, step := range steps {
+		loc := fmt.Sprintf("step '%s' in %s", step.Name, context)
+		if err := fn(step, loc); err != nil {
+			return err
+		}
+
+		nested := [][]*ast.Step{step.Steps}
+		for _, cond := range step.Switch {
+			nested = append(nested, cond.Steps)
+		}
+		if step.For != nil {
+			nested = append(nested, step.For.Steps)
+		}
+		if step.Try != nil {
+			nested = append(nested, step.Try.Try)
+			if step.Try.Except != nil {
+				nested = append(nested, step.Try.Except.Steps)
+			}
+			nested = append(nested, step.Try.Finally)
+		}
+		if p := step.Parallel; p != nil {
+			for _, b := range p.Branches {
+				nested = append(nested, b.Steps)
+			}
+			if p.For != nil {
+				nested = append(nested, p.For.Steps)
+			}
+		}
+		for _, n := range nested {
+			if err := walkSteps(n, loc, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // parseBackoff parses exponential backoff configuration.
 func parseBackoff(node *yaml.Node, loc string) (*ast.BackoffExpr, error) {
 	if node.Kind != yaml.MappingNode {
@@ -756,6 +1060,25 @@ func parseBackoff(node *yaml.Node, loc string) (*ast.BackoffExpr, error) {
 		}
 	}
 
+	if b.InitialDelay < 0 {
+		return nil, &ParseError{
+			Message:  fmt.Sprintf("backoff initial_delay must not be negative, got %g", b.InitialDelay),
+			Location: loc,
+		}
+	}
+	if b.MaxDelay < 0 {
+		return nil, &ParseError{
+			Message:  fmt.Sprintf("backoff max_delay must not be negative, got %g", b.MaxDelay),
+			Location: loc,
+		}
+	}
+	if b.Multiplier < 1 {
+		return nil, &ParseError{
+			Message:  fmt.Sprintf("backoff multiplier must be at least 1, got %g", b.Multiplier),
+			Location: loc,
+		}
+	}
+
 	return b, nil
 }
 
@@ -799,16 +1122,31 @@ func scalarToInterface(node *yaml.Node) interface{} {
 
 	switch node.Tag {
 	case "!!bool":
-		return node.Value == "true" || node.Value == "True" || node.Value == "TRUE" ||
-			node.Value == "yes" || node.Value == "Yes" || node.Value == "YES"
+		// An explicit !!bool tag may still use the YAML 1.1 spellings
+		switch strings.ToLower(node.Value) {
+		case "true", "yes", "on":
+			return true
+		}
+		return false
 	case "!!int":
+		// Decode follows the YAML rules for separators and bases (1_000, 0x1F)
 		var i int64
-		fmt.Sscanf(node.Value, "%d", &i)
-		return i
+		if err := node.Decode(&i); err == nil {
+			return i
+		}
+		// Beyond the int64 range (YAML already tags larger values as !!float
+		// unless they fit in a uint64): GCW treats these as doubles
+		var f float64
+		if err := node.Decode(&f); err == nil {
+			return f
+		}
+		return node.Value
 	case "!!float":
 		var f float64
-		fmt.Sscanf(node.Value, "%f", &f)
-		return f
+		if err := node.Decode(&f); err == nil {
+			return f
+		}
+		return node.Value
 	case "!!str":
 		return node.Value
 	}
@@ -816,19 +1154,24 @@ func scalarToInterface(node *yaml.Node) interface{} {
 	// Auto-detect type for untagged scalars
 	val := node.Value
 
-	// Check for boolean
+	// Check for boolean. As in GCW, only true and false are booleans:
+	// yes, no, on and off stay strings.
 	lower := strings.ToLower(val)
-	if lower == "true" || lower == "yes" {
+	if lower == "true" {
 		return true
 	}
-	if lower == "false" || lower == "no" {
+	if lower == "false" {
 		return false
 	}
 
-	// Check for integer
-	var i int64
-	if n, _ := fmt.Sscanf(val, "%d", &i); n == 1 && fmt.Sprintf("%d", i) == val {
+	// Check for integer. Integers beyond the int64 range become doubles, as
+	// in GCW, rather than falling through to strings.
+	if i, err := strconv.ParseInt(val, 10, 64); err == nil {
 		return i
+	} else if errors.Is(err, strconv.ErrRange) {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
 	}
 
 	// Check for float
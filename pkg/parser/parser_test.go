@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseBasicWorkflow(t *testing.T) {
@@ -554,3 +558,601 @@ func TestParseLargeAssignmentSucceeds(t *testing.T) {
 		t.Fatalf("expected parse to succeed (limits are runtime-enforced), got: %v", err)
 	}
 }
+
+func TestParseRejectsInvalidRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry string
+	}{
+		{"negative max_retries", `
+          max_retries: -1`},
+		{"max_retries over limit", `
+          max_retries: 1000`},
+		{"multiplier below one", `
+          max_retries: 3
+          backoff:
+            initial_delay: 1
+            max_delay: 10
+            multiplier: 0.5`},
+		{"negative initial_delay", `
+          max_retries: 3
+          backoff:
+            initial_delay: -1`},
+		{"unknown predicate", `
+          predicate: ${retry.sometimes}`},
+		{"predicate through a variable", `
+          predicate: ${policy}`},
+		{"predicate not a name", `
+          predicate:
+            always: true`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte(`
+main:
+  steps:
+    - guarded:
+        try:
+          call: sys.log
+          args:
+            text: hi
+        retry:` + tt.retry + `
+`)
+
+			_, err := Parse(src)
+			if err == nil {
+				t.Fatal("expected error for invalid retry policy")
+			}
+			if _, ok := err.(*ParseError); !ok {
+				t.Errorf("expected *ParseError, got %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestParseNumericLiterals(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - separated: 1_000_000
+          - big: 9223372036854775807
+          - sci: 1.5e3
+          - hex: 0x1F
+    - done:
+        return: ${separated}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []interface{}{int64(1000000), int64(9223372036854775807), float64(1500), int64(31)}
+	for i, a := range wf.Main.Steps[0].Assign {
+		if a.Value != want[i] {
+			t.Errorf("%s = %v (%T), want %v (%T)", a.Target, a.Value, a.Value, want[i], want[i])
+		}
+	}
+}
+
+func TestParseIntegerBeyondInt64IsDouble(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - huge: 99999999999999999999
+          - uint: 18446744073709551615
+          - negative: -99999999999999999999
+    - done:
+        return: ${huge}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []interface{}{float64(1e20), float64(18446744073709551615), float64(-1e20)}
+	for i, a := range wf.Main.Steps[0].Assign {
+		if a.Value != want[i] {
+			t.Errorf("%s = %v (%T), want %v (%T)", a.Target, a.Value, a.Value, want[i], want[i])
+		}
+	}
+
+	// Untagged scalars take the same path
+	if got := scalarToInterface(&yaml.Node{Kind: yaml.ScalarNode, Value: "99999999999999999999"}); got != float64(1e20) {
+		t.Errorf("untagged huge integer = %v (%T), want 1e20", got, got)
+	}
+	if got := scalarToInterface(&yaml.Node{Kind: yaml.ScalarNode, Value: "42"}); got != int64(42) {
+		t.Errorf("untagged integer = %v (%T), want 42", got, got)
+	}
+}
+
+func TestParseYesNoOnOffAreStrings(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - foo: no
+          - bar: yes
+          - baz: on
+          - qux: off
+          - t: true
+          - f: False
+          - tagged: !!bool yes
+    - done:
+        return: ${foo}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []interface{}{"no", "yes", "on", "off", true, false, true}
+	for i, a := range wf.Main.Steps[0].Assign {
+		if a.Value != want[i] {
+			t.Errorf("%s = %v (%T), want %v (%T)", a.Target, a.Value, a.Value, want[i], want[i])
+		}
+	}
+
+	// Untagged scalars take the same path
+	for _, v := range []string{"no", "yes", "on", "off"} {
+		if got := scalarToInterface(&yaml.Node{Kind: yaml.ScalarNode, Value: v}); got != v {
+			t.Errorf("untagged %s = %v (%T), want the string", v, got, got)
+		}
+	}
+}
+
+func TestParseResolvesAnchorsAndAliases(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - first:
+        call: http.get
+        args: &common
+          url: https://example.com/api
+          timeout: 30
+    - second:
+        call: http.get
+        args: *common
+    - third:
+        call: http.post
+        args:
+          <<: *common
+          timeout: 60
+          body: ${payload}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	steps := wf.Main.Steps
+	for _, i := range []int{0, 1} {
+		if got := steps[i].Call.Args["url"]; got != "https://example.com/api" {
+			t.Errorf("step %s: url = %v", steps[i].Name, got)
+		}
+		if got := steps[i].Call.Args["timeout"]; got != int64(30) {
+			t.Errorf("step %s: timeout = %v", steps[i].Name, got)
+		}
+	}
+
+	merged := steps[2].Call.Args
+	if got := merged["url"]; got != "https://example.com/api" {
+		t.Errorf("merged url = %v", got)
+	}
+	if got := merged["timeout"]; got != int64(60) {
+		t.Errorf("merged timeout = %v, want the explicit 60", got)
+	}
+	if got := merged["body"]; got != "${payload}" {
+		t.Errorf("merged body = %v", got)
+	}
+	if _, ok := merged["<<"]; ok {
+		t.Error("merge key was kept as an argument")
+	}
+}
+
+func TestParseRejectsMultipleDocuments(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - done:
+        return: 1
+---
+other:
+  steps:
+    - done:
+        return: 2
+`)
+
+	_, err := Parse(src)
+	if err == nil {
+		t.Fatal("expected error for multi-document source")
+	}
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("expected *ParseError, got %T", err)
+	}
+	if !strings.Contains(err.Error(), "multiple YAML documents") {
+		t.Errorf("expected clear multi-document message, got %q", err)
+	}
+
+	// A leading document marker is still a single document
+	if _, err := Parse([]byte("---\nmain:\n  steps:\n    - done:\n        return: 1\n")); err != nil {
+		t.Errorf("single document with marker: unexpected error: %v", err)
+	}
+}
+
+func TestParseMapLiteralExpressions(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - nested: ${{"a": {"b": {"c": 1}}}}
+          - braces: ${{"s": "x}y", "t": "{"}}  # trailing } in a comment
+          - apostrophe: ${{"s": "it's"}}
+          - quoted: '${{"s": 1}}'
+          - list: [${{"a": 1}}, ${{"b": 2}}]
+    - done:
+        return: ${nested}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []interface{}{
+		`${{"a": {"b": {"c": 1}}}}`,
+		`${{"s": "x}y", "t": "{"}}`,
+		`${{"s": "it's"}}`,
+		`${{"s": 1}}`,
+		[]interface{}{`${{"a": 1}}`, `${{"b": 2}}`},
+	}
+	for i, a := range wf.Main.Steps[0].Assign {
+		if !reflect.DeepEqual(a.Value, want[i]) {
+			t.Errorf("%s = %#v, want %#v", a.Target, a.Value, want[i])
+		}
+	}
+}
+
+func TestParseCallResult(t *testing.T) {
+	// result is attached to the call regardless of key order
+	src := []byte(`
+main:
+  steps:
+    - before:
+        result: first
+        call: sys.now
+    - after:
+        call: sys.now
+        result: second
+    - done:
+        return: ${first}
+`)
+
+	wf, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []string{"first", "second"} {
+		if got := wf.Main.Steps[i].Call.Result; got != want {
+			t.Errorf("step %s: Call.Result = %q, want %q", wf.Main.Steps[i].Name, got, want)
+		}
+	}
+}
+
+func TestParseRejectsResultOnNonCallStep(t *testing.T) {
+	tests := map[string]string{
+		"for": `
+main:
+  steps:
+    - loop:
+        for:
+          value: v
+          in: [1, 2]
+          steps:
+            - noop:
+                assign:
+                  - x: ${v}
+        result: out
+`,
+		"parallel": `
+main:
+  steps:
+    - par:
+        parallel:
+          branches:
+            - b1:
+                steps:
+                  - noop:
+                      assign:
+                        - x: 1
+        result: out
+`,
+		"assign": `
+main:
+  steps:
+    - init:
+        assign:
+          - x: 1
+        result: out
+`,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(src))
+			if err == nil {
+				t.Fatal("expected error for result on a non-call step")
+			}
+			if !strings.Contains(err.Error(), "only allowed on call steps") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRejectsDuplicateStepNames(t *testing.T) {
+	src := []byte(`
+main:
+  steps:
+    - foo:
+        assign:
+          - x: 1
+    - foo:
+        return: ${x}
+`)
+
+	_, err := Parse(src)
+	if err == nil {
+		t.Fatal("expected error for duplicate step names")
+	}
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T", err)
+	}
+	if pe.Message != "duplicate step name 'foo' (line 7)" {
+		t.Errorf("message = %q", pe.Message)
+	}
+	if pe.Location != "main" {
+		t.Errorf("location = %q, want main", pe.Location)
+	}
+
+	// The same name in different blocks is fine
+	if _, err := Parse([]byte(`
+main:
+  steps:
+    - foo:
+        steps:
+          - foo:
+              assign:
+                - x: 1
+    - done:
+        return: ${x}
+`)); err != nil {
+		t.Errorf("unexpected error for nested duplicate: %v", err)
+	}
+}
+
+func TestParseUnknownKeySuggestions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "workflow body",
+			src: `
+main:
+  step:
+    - done:
+        return: 1
+`,
+			want: "unknown key 'step' in workflow body — did you mean 'steps'?",
+		},
+		{
+			name: "step body",
+			src: `
+main:
+  steps:
+    - fetch:
+        cal: http.get
+`,
+			want: "unknown step key 'cal' — did you mean 'call'?",
+		},
+		{
+			name: "no close match",
+			src: `
+main:
+  steps:
+    - fetch:
+        bogus: 1
+`,
+			want: "unknown step key 'bogus'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected *ParseError, got %T: %v", err, err)
+			}
+			if pe.Message != tt.want {
+				t.Errorf("message = %q, want %q", pe.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsFinallyWithoutTry(t *testing.T) {
+	_, err := Parse([]byte(`
+main:
+  steps:
+    - cleanup:
+        finally:
+          - noop:
+              assign:
+                - x: 1
+`))
+	if err == nil || !strings.Contains(err.Error(), "only allowed on try steps") {
+		t.Errorf("expected finally without try to be rejected, got %v", err)
+	}
+}
+
+func TestParseStrictRejectsExtensions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"bare step list", `
+main:
+  - done:
+      return: 1
+`, "bare step list"},
+		{"finally", `
+main:
+  steps:
+    - outer:
+        steps:
+          - guarded:
+              try:
+                call: sys.log
+                args:
+                  data: hi
+              finally:
+                - cleanup:
+                    assign:
+                      - x: 1
+`, "step 'guarded' in step 'outer' in main: 'finally' is an emulator extension"},
+		{"null coalescing", `
+main:
+  steps:
+    - init:
+        assign:
+          - x: null
+    - done:
+        return: ${x ?? "fallback"}
+`, "?? operator is an emulator extension (line 8)"},
+		{"extension function in an expression", `
+main:
+  steps:
+    - done:
+        return: ${len(list.range(1, 3))}
+`, "the function list.range is an emulator extension (line 5)"},
+		{"extension function in a call step", `
+main:
+  steps:
+    - fmt:
+        call: text.format
+        args:
+          format: "%s"
+        result: s
+`, "step 'fmt' in main: the function text.format is an emulator extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.src)); err != nil {
+				t.Fatalf("Parse: unexpected error: %v", err)
+			}
+			_, err := ParseStrict([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseStrict: expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseStrictRejectsEveryExtensionFunction(t *testing.T) {
+	calls := []string{
+		`if(true, 1, 2)`,
+		`clone(m)`,
+		`get(m, "k")`,
+		`text.format("%s", "x")`,
+		`text.join(["a"], ",")`,
+		`text.split_n("a,b", ",", 1)`,
+		`list.range(1, 3)`,
+		`list.repeat(0, 3)`,
+		`list.index_of([1], 1)`,
+		`list.contains([1], 1)`,
+		`text.to_hex(b)`,
+		`text.from_hex("6869")`,
+		`http.get_paginated(url)`,
+		// Namespaced aliases of GCW's bare helpers
+		`map.keys(m)`,
+		`map.length(m)`,
+		`list.length([1])`,
+	}
+	for _, call := range calls {
+		t.Run(call, func(t *testing.T) {
+			src := "main:\n  steps:\n    - done:\n        return: ${" + call + "}\n"
+			_, err := ParseStrict([]byte(src))
+			if err == nil || !strings.Contains(err.Error(), "is an emulator extension") {
+				t.Errorf("ParseStrict: expected an extension error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseStrictAcceptsGCWWorkflow(t *testing.T) {
+	_, err := ParseStrict([]byte(`
+main:
+  params: [args]
+  steps:
+    - guarded:
+        try:
+          call: helper
+          args:
+            label: '${"a??b"}'
+          result: r
+        except:
+          as: e
+          steps:
+            - fail:
+                raise: ${e}
+    - done:
+        return: ${default(r, "none")}
+helper:
+  params: [label]
+  steps:
+    - ret:
+        return: ${label}
+`))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseErrorLocations(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		location string
+	}{
+		{"yaml syntax", "main:\n  steps:\n    - done:\n        return: x: y\n", "line 4"},
+		{"missing main", "helper:\n  steps:\n    - done:\n        return: 1\n", "top level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected *ParseError, got %T (%v)", err, err)
+			}
+			if pe.Location != tt.location {
+				t.Errorf("location = %q, want %q", pe.Location, tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/expr"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseStrict parses source like Parse, then rejects the emulator extensions
+// that Cloud Workflows itself does not accept, so a definition that passes
+// will also deploy to GCP:
+//
+//   - a workflow body written as a bare list of steps instead of a mapping
+//     with 'steps'
+//   - 'finally' clauses on try steps
+//   - the ?? null-coalescing operator in expressions
+//   - calls to emulator-only functions (see stdlib.IsExtension), in
+//     expressions or call steps
+func ParseStrict(source []byte) (*ast.Workflow, error) {
+	wf, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse has already decoded the source successfully
+	rootNode, _ := decodeSource(source)
+	for i := 0; i+1 < len(rootNode.Content); i += 2 {
+		if rootNode.Content[i+1].Kind == yaml.SequenceNode {
+			return nil, &ParseError{
+				Message:  "a workflow body must be a mapping with 'steps'; a bare step list is an emulator extension",
+				Location: fmt.Sprintf("workflow '%s'", rootNode.Content[i].Value),
+			}
+		}
+	}
+
+	if err := checkStrictSteps(wf, wf.Main.Steps, "main"); err != nil {
+		return nil, err
+	}
+	for name, sub := range wf.Subworkflows {
+		if err := checkStrictSteps(wf, sub.Steps, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if line, what := findExtension(rootNode); line > 0 {
+		return nil, &ParseError{
+			Message: fmt.Sprintf("%s is an emulator extension (line %d)", what, line),
+		}
+	}
+
+	return wf, nil
+}
+
+// checkStrictSteps rejects 'finally' clauses and call steps that call
+// emulator-only functions, in steps and everything nested in them. A call to a
+// subworkflow of wf is fine whatever its name.
+func checkStrictSteps(wf *ast.Workflow, steps []*ast.Step, context string) error {
+	return walkSteps(steps, context, func(step *ast.Step, loc string) error {
+		if step.Try != nil && step.Try.Finally != nil {
+			return &ParseError{
+				Message:  "'finally' is an emulator extension",
+				Location: loc,
+			}
+		}
+		if c := step.Call; c != nil && stdlib.IsExtension(c.Function) && wf.Subworkflows[c.Function] == nil {
+			return &ParseError{
+				Message:  fmt.Sprintf("the function %s is an emulator extension", c.Function),
+				Location: loc,
+			}
+		}
+		return nil
+	})
+}
+
+// findExtension returns the line of the first scalar under node whose
+// expression uses the ?? operator or calls an emulator-only function, with a
+// description of what it uses, or 0 if there is none. Expressions that do not
+// parse are left for the runtime to report.
+func findExtension(node *yaml.Node) (int, string) {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") {
+			return 0, ""
+		}
+		n, err := expr.ParseValue(node.Value)
+		if err != nil {
+			return 0, ""
+		}
+		what := ""
+		expr.Inspect(n, func(n expr.Node) bool {
+			switch n := n.(type) {
+			case *expr.BinaryNode:
+				if n.Op == expr.TokenCoalesce {
+					what = "the ?? operator"
+				}
+			case *expr.CallNode:
+				if stdlib.IsExtension(n.Name()) {
+					what = fmt.Sprintf("the function %s", n.Name())
+				}
+			}
+			return what == ""
+		})
+		if what != "" {
+			return node.Line, what
+		}
+		return 0, ""
+	}
+	for _, child := range node.Content {
+		if line, what := findExtension(child); line > 0 {
+			return line, what
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,51 @@
+package parser
+
+// workflowBodyKeys are the keys allowed in a workflow or subworkflow body.
+var workflowBodyKeys = []string{"params", "steps"}
+
+// stepKeys are the keys allowed in a step body.
+var stepKeys = []string{
+	"assign", "call", "args", "result", "switch", "for", "parallel",
+	"try", "except", "retry", "finally", "raise", "return", "next", "steps",
+}
+
+// maxSuggestDistance is the largest edit distance at which a valid key is
+// still offered as a suggestion for an unknown one.
+const maxSuggestDistance = 2
+
+// didYouMean returns a " — did you mean 'x'?" hint naming the valid key
+// closest to key, or "" when none is close enough to be a likely typo.
+func didYouMean(key string, valid []string) string {
+	best, bestDist := "", maxSuggestDistance+1
+	for _, v := range valid {
+		if d := levenshtein(key, v); d < bestDist {
+			best, bestDist = v, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return " — did you mean '" + best + "'?"
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,421 @@
+// Package runner runs workflow executions for the API servers. The REST and
+// gRPC servers share a Runner, so both front ends parse, queue, run, time out
+// and cancel executions the same way.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/runtime"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Runner starts executions of deployed workflows in the background and
+// records their outcome in the store. It is safe for concurrent use; the
+// setters should be called before the first execution starts.
+type Runner struct {
+	store *store.Store
+
+	parseCache *parser.Cache               // parsed ASTs by source hash
+	parsed     map[string]*ast.Workflow    // parsed ASTs by workflow name
+	parsedMu   sync.RWMutex                // guards parsed
+	engines    map[string]runningExecution // running executions (for cancel)
+	enginesMu  sync.Mutex                  // guards engines
+
+	defaultBaseURL string                    // prefix for relative http.* URLs
+	httpTransport  http.RoundTripper         // transport for http.* requests (nil = default)
+	connectorMocks stdlib.ConnectorMocks     // canned googleapis.* responses
+	limiter        *runtime.ExecutionLimiter // bounds concurrently running executions
+	execTimeout    time.Duration             // wall-clock limit per execution (0 = none)
+	retryJitter    float64                   // retry backoff jitter fraction (0 = none)
+	limits         runtime.Limits            // per-execution limits (zero fields = GCW defaults)
+	deterministic  bool                      // run time-based stdlib functions on a virtual clock
+	logger         *slog.Logger              // execution lifecycle logger
+	tracer         trace.Tracer              // execution and step spans (nil = off)
+}
+
+// New creates a runner for the workflows and executions in s.
+func New(s *store.Store) *Runner {
+	return &Runner{
+		store:       s,
+		parseCache:  parser.NewCache(),
+		parsed:      make(map[string]*ast.Workflow),
+		engines:     make(map[string]runningExecution),
+		limiter:     runtime.NewExecutionLimiter(runtime.DefaultMaxConcurrentExecutions),
+		logger:      logging.Default(),
+		execTimeout: runtime.DefaultExecutionTimeout,
+	}
+}
+
+// SetExecutionTimeout sets the wall-clock limit for each execution. Executions
+// running longer fail with a TimeoutError. Zero disables the limit.
+func (r *Runner) SetExecutionTimeout(d time.Duration) {
+	r.execTimeout = d
+}
+
+// SetLogger sets the logger for execution lifecycle and step events.
+func (r *Runner) SetLogger(l *slog.Logger) {
+	r.logger = l
+}
+
+// SetTracer records each execution as an OpenTelemetry root span on t, with
+// a child span per step. Nil, the default, disables tracing.
+func (r *Runner) SetTracer(t trace.Tracer) {
+	r.tracer = t
+}
+
+// SetDeterministic runs each execution's sys.now, sys.sleep,
+// sys.sleep_until and retry backoff on its own virtual clock: sleeps return
+// immediately but advance the time the execution sees by their full
+// duration. Parallel branches keep separate time, and retry jitter comes
+// from a fixed seed.
+func (r *Runner) SetDeterministic(on bool) {
+	r.deterministic = on
+}
+
+// SetStrict makes Parse and ParseDefinition reject emulator-only extensions
+// (see parser.ParseStrict), so accepted workflows also deploy to GCP.
+func (r *Runner) SetStrict(on bool) {
+	r.parseCache.SetStrict(on)
+}
+
+// SetLimits sets the per-execution step, call stack and parallel nesting
+// limits, and the step and subworkflow limits checked by ParseDefinition.
+// Zero fields keep the GCW defaults.
+func (r *Runner) SetLimits(l runtime.Limits) {
+	r.limits = l
+}
+
+// SetRetryJitter sets the fraction by which retry backoff delays are
+// randomized, e.g. 0.1 for ±10%. Zero keeps delays deterministic.
+func (r *Runner) SetRetryJitter(jitter float64) {
+	r.retryJitter = jitter
+}
+
+// SetExecutionLimiter replaces the limiter bounding concurrently running
+// executions.
+func (r *Runner) SetExecutionLimiter(l *runtime.ExecutionLimiter) {
+	r.limiter = l
+}
+
+// SetDefaultBaseURL sets the base URL that relative http.* request URLs are
+// resolved against.
+func (r *Runner) SetDefaultBaseURL(baseURL string) {
+	r.defaultBaseURL = baseURL
+}
+
+// SetHTTPTransport sets the transport used for http.* requests, e.g. to serve
+// canned responses from HTTPMocks.
+func (r *Runner) SetHTTPTransport(rt http.RoundTripper) {
+	r.httpTransport = rt
+}
+
+// SetConnectorMocks sets the canned responses returned by googleapis.*
+// connector calls.
+func (r *Runner) SetConnectorMocks(mocks stdlib.ConnectorMocks) {
+	r.connectorMocks = mocks
+}
+
+// Parse parses workflow source through the runner's parse cache. The
+// returned AST is shared and must not be modified.
+func (r *Runner) Parse(source []byte) (*ast.Workflow, error) {
+	return r.parseCache.Parse(source)
+}
+
+// ParseDefinition parses workflow source for deployment: like Parse, but it
+// also checks the definition against the deploy-time limits.
+func (r *Runner) ParseDefinition(source []byte) (*ast.Workflow, error) {
+	wfAST, err := r.parseCache.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.limits.CheckDefinition(wfAST); err != nil {
+		return nil, err
+	}
+	return wfAST, nil
+}
+
+// Parses returns the number of times the runner has parsed workflow source,
+// as opposed to reusing a cached parse.
+func (r *Runner) Parses() int {
+	return r.parseCache.Parses()
+}
+
+// WorkflowAST returns the cached parsed form of the named workflow, parsing
+// source and caching the result if it is not cached yet.
+func (r *Runner) WorkflowAST(name, source string) (*ast.Workflow, error) {
+	r.parsedMu.RLock()
+	wfAST, ok := r.parsed[name]
+	r.parsedMu.RUnlock()
+	if ok {
+		return wfAST, nil
+	}
+
+	wfAST, err := r.parseCache.Parse([]byte(source))
+	if err != nil {
+		return nil, err
+	}
+	r.SetParsed(name, wfAST)
+	return wfAST, nil
+}
+
+// Parsed returns the cached parsed form of the named workflow, or nil if
+// none is cached.
+func (r *Runner) Parsed(name string) *ast.Workflow {
+	r.parsedMu.RLock()
+	defer r.parsedMu.RUnlock()
+	return r.parsed[name]
+}
+
+// SetParsed caches the parsed form of the named workflow for executions
+// started from now on, or drops it from the cache if wfAST is nil.
+// Executions already running keep the AST they started with.
+func (r *Runner) SetParsed(name string, wfAST *ast.Workflow) {
+	r.parsedMu.Lock()
+	defer r.parsedMu.Unlock()
+	if wfAST == nil {
+		delete(r.parsed, name)
+		return
+	}
+	r.parsed[name] = wfAST
+}
+
+// Start creates an execution of the named workflow and runs it in the
+// background. A non-empty execID is a client-chosen execution ID: if the
+// workflow already has an execution with that ID, it is returned as is and
+// nothing new is started. If the execution limit has been reached, the
+// execution is returned QUEUED and starts once every execution queued before
+// it has started and a slot is free.
+func (r *Runner) Start(workflowName, execID string, args types.Value) (*store.Execution, error) {
+	wf, err := r.store.GetWorkflow(workflowName)
+	if err != nil {
+		return nil, err
+	}
+	wfAST, err := r.WorkflowAST(wf.Name, wf.SourceCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse workflow: %v", err)
+	}
+
+	var exec *store.Execution
+	if execID == "" {
+		exec, err = r.store.CreateExecution(workflowName, args)
+	} else {
+		var created bool
+		exec, created, err = r.store.CreateExecutionWithID(workflowName, execID, args)
+		if err == nil && !created {
+			return exec, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.limiter.TryAcquire() {
+		go r.run(exec.Name, wfAST, args)
+		return exec, nil
+	}
+
+	// Join the queue before returning, so queued executions start in the
+	// order they were created
+	_ = r.store.QueueExecution(exec.Name)
+	ready := r.limiter.Enqueue()
+	go func() {
+		<-ready
+		if err := r.store.StartQueuedExecution(exec.Name); err != nil {
+			// Cancelled while waiting for a slot
+			r.limiter.Release()
+			return
+		}
+		r.run(exec.Name, wfAST, args)
+	}()
+	exec.State = store.ExecutionQueued
+	return exec, nil
+}
+
+// Cancel marks the named execution CANCELLED and stops its engine, if it is
+// running. An execution cancelled before its engine starts runs no steps.
+func (r *Runner) Cancel(name string) error {
+	// Mark the execution CANCELLED before stopping its engine, so the engine's
+	// cancellation error cannot be recorded as a failure first
+	if err := r.store.CancelExecution(name); err != nil {
+		return err
+	}
+	r.enginesMu.Lock()
+	running, ok := r.engines[name]
+	r.enginesMu.Unlock()
+	if ok {
+		running.engine.Cancel()
+		running.cancel()
+	}
+	return nil
+}
+
+// Running reports whether an engine is still running the named execution.
+// Once it returns false for a started execution, its outcome is recorded.
+func (r *Runner) Running(name string) bool {
+	r.enginesMu.Lock()
+	defer r.enginesMu.Unlock()
+	_, ok := r.engines[name]
+	return ok
+}
+
+// run executes a workflow in the current goroutine. The caller must hold an
+// execution slot, which is released when the execution finishes.
+func (r *Runner) run(execName string, wfAST *ast.Workflow, args types.Value) {
+	defer r.limiter.Release()
+	logger := logging.ForExecution(r.logger, execName)
+	logger.Debug("execution started")
+
+	// Not derived from the request that created the execution, which ends
+	// when the request returns. Cancel ends it too, which stops any child
+	// executions running on it.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if r.execTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, r.execTimeout)
+		defer cancelTimeout()
+	}
+
+	funcs := r.newRegistry(ctx)
+	if exec, err := r.store.GetExecution(execName); err == nil {
+		funcs.RegisterExecutionEnv(stdlib.ExecutionEnv(exec.Name, exec.WorkflowRevisionID))
+	}
+
+	engine := r.newEngine(wfAST, funcs, logger)
+	engine.SetStepHook(func(step string) func(error) {
+		i := r.store.StartStep(execName, step)
+		return func(err error) { r.store.FinishStep(execName, i, err) }
+	})
+	if r.tracer != nil {
+		engine.SetTracer(r.tracer, attribute.String("gcw.execution", execName))
+	}
+
+	r.enginesMu.Lock()
+	r.engines[execName] = runningExecution{engine: engine, cancel: cancel}
+	r.enginesMu.Unlock()
+
+	// A Cancel that came before the engine was registered had no engine to
+	// stop. Once registered, Cancel finds it, so checking the state here
+	// leaves no window in which a cancelled execution runs any step.
+	if exec, err := r.store.GetExecution(execName); err == nil && exec.State != store.ExecutionActive {
+		engine.Cancel()
+	}
+
+	result, err := engine.Execute(ctx, args)
+
+	var we *types.WorkflowError
+	switch {
+	case errors.As(err, &we) && we.HasTag(types.TagCancelledError):
+		// Cancel has already marked the execution CANCELLED
+		logger.Debug("execution cancelled")
+	case err != nil:
+		logger.Error("execution failed", "error", err)
+		_ = r.store.FailExecution(execName, err)
+	default:
+		logger.Debug("execution succeeded")
+		_ = r.store.CompleteExecution(execName, result)
+	}
+
+	r.enginesMu.Lock()
+	delete(r.engines, execName)
+	r.enginesMu.Unlock()
+}
+
+// newRegistry returns the functions available to one execution: the
+// standard library plus the runner's HTTP, child execution, connector and
+// clock configuration. Child executions run on ctx, the execution's context.
+func (r *Runner) newRegistry(ctx context.Context) *stdlib.Registry {
+	funcs := stdlib.NewRegistry()
+	client := &http.Client{Timeout: 30 * time.Second, Transport: r.httpTransport}
+	funcs.RegisterHTTPWithBaseURL(client, r.defaultBaseURL)
+	funcs.RegisterWorkflowExecution(ctx, storeAdapter{r.store}, r.WorkflowAST, r.childExecutor())
+	funcs.RegisterConnectorMocks(r.connectorMocks)
+	if r.deterministic {
+		funcs.RegisterClock(stdlib.NewVirtualClock(time.Now()))
+	}
+	return funcs
+}
+
+// jitterSeed seeds retry jitter in deterministic mode, so reruns of an
+// execution wait out the same backoff delays.
+const jitterSeed = 1
+
+// newEngine returns an engine for wfAST that calls funcs, waits out retry
+// backoff on the same clock as sys.sleep, gives parallel branches their own
+// time and logs to logger.
+func (r *Runner) newEngine(wfAST *ast.Workflow, funcs *stdlib.Registry, logger *slog.Logger) *runtime.Engine {
+	engine := runtime.NewEngine(wfAST, funcs)
+	var src rand.Source // nil = time-seeded
+	if r.deterministic {
+		src = rand.NewSource(jitterSeed)
+	}
+	engine.SetRetryJitter(r.retryJitter, src)
+	engine.SetClock(funcs.Clock())
+	engine.SetBrancher(branchRegistry)
+	engine.SetLimits(r.limits)
+	engine.SetLogger(logger)
+	return engine
+}
+
+// branchRegistry is a runtime.Brancher for engines calling a
+// stdlib.Registry: each parallel branch gets the registry's Branch, which
+// keeps its own virtual time in deterministic mode.
+func branchRegistry(funcs runtime.FunctionRegistry, clock runtime.Clock) (runtime.FunctionRegistry, runtime.Clock, func()) {
+	reg, ok := funcs.(*stdlib.Registry)
+	if !ok {
+		return funcs, clock, func() {}
+	}
+	branch, done := reg.Branch()
+	return branch, branch.Clock(), done
+}
+
+// childExecutor returns a ChildExecutor that creates a fresh engine for each
+// child workflow execution, with all stdlib functions registered. The child
+// runs on its parent's context, so it stops when the parent times out or is
+// cancelled.
+func (r *Runner) childExecutor() stdlib.ChildExecutor {
+	return func(ctx context.Context, wfAST *ast.Workflow, args types.Value) (types.Value, error) {
+		engine := r.newEngine(wfAST, r.newRegistry(ctx), r.logger)
+		if r.tracer != nil {
+			engine.SetTracer(r.tracer)
+		}
+		return engine.Execute(ctx, args)
+	}
+}
+
+// runningExecution is an execution whose engine is running.
+type runningExecution struct {
+	engine *runtime.Engine
+	cancel context.CancelFunc // ends the execution's context
+}
+
+// storeAdapter adapts *store.Store to the stdlib.WorkflowStore interface.
+type storeAdapter struct {
+	s *store.Store
+}
+
+func (a storeAdapter) FindWorkflowByID(workflowID string) (stdlib.WorkflowInfo, error) {
+	wf, err := a.s.FindWorkflowByID(workflowID)
+	if err != nil {
+		return stdlib.WorkflowInfo{}, err
+	}
+	return stdlib.WorkflowInfo{
+		Name:       wf.Name,
+		SourceCode: wf.SourceCode,
+	}, nil
+}
@@ -2,20 +2,92 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/logging"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // MaxCallStackDepth is the maximum allowed call stack depth for subworkflows.
 const MaxCallStackDepth = 20
 
 // MaxStepsPerExecution is the maximum number of steps that can execute in a single run.
+// Call steps count like any other step, so loops of stdlib or HTTP calls hit it too.
 const MaxStepsPerExecution = 100_000
 
+// MaxDefinitionSteps is the maximum number of steps a workflow definition may
+// contain, counting main, every subworkflow and all nested steps. GCW bounds
+// definitions by their 128 KB source size rather than a step count; this
+// guardrail rejects generated definitions that pack thousands of tiny steps
+// into that budget.
+const MaxDefinitionSteps = 5_000
+
+// MaxSubworkflows is the maximum number of subworkflows, besides main, that a
+// workflow definition may declare.
+const MaxSubworkflows = 500
+
+// Limits are the limits the emulator enforces, per execution and on the
+// definitions it deploys. A zero field uses the GCW default:
+// MaxStepsPerExecution, MaxCallStackDepth, MaxParallelNestingDepth,
+// MaxDefinitionSteps or MaxSubworkflows.
+type Limits struct {
+	MaxSteps                int // steps per execution
+	MaxCallStackDepth       int // nested subworkflow calls
+	MaxParallelNestingDepth int // nested parallel steps
+	MaxDefinitionSteps      int // steps in a deployed definition
+	MaxSubworkflows         int // subworkflows in a deployed definition
+}
+
+// withDefaults returns l with every zero field set to its GCW default.
+func (l Limits) withDefaults() Limits {
+	if l.MaxSteps == 0 {
+		l.MaxSteps = MaxStepsPerExecution
+	}
+	if l.MaxCallStackDepth == 0 {
+		l.MaxCallStackDepth = MaxCallStackDepth
+	}
+	if l.MaxParallelNestingDepth == 0 {
+		l.MaxParallelNestingDepth = MaxParallelNestingDepth
+	}
+	if l.MaxDefinitionSteps == 0 {
+		l.MaxDefinitionSteps = MaxDefinitionSteps
+	}
+	if l.MaxSubworkflows == 0 {
+		l.MaxSubworkflows = MaxSubworkflows
+	}
+	return l
+}
+
+// CheckDefinition reports an error if wf is too large to deploy under l.
+func (l Limits) CheckDefinition(wf *ast.Workflow) error {
+	l = l.withDefaults()
+	st := wf.Stats()
+	if st.Steps > l.MaxDefinitionSteps {
+		return fmt.Errorf("workflow has %d steps, exceeding the limit of %d", st.Steps, l.MaxDefinitionSteps)
+	}
+	if st.Subworkflows > l.MaxSubworkflows {
+		return fmt.Errorf("workflow has %d subworkflows, exceeding the limit of %d", st.Subworkflows, l.MaxSubworkflows)
+	}
+	return nil
+}
+
+// DefaultExecutionTimeout is the default wall-clock limit for a single execution.
+const DefaultExecutionTimeout = 30 * time.Minute
+
 // FlowControl represents special flow control signals during execution.
 type FlowControl int
 
@@ -39,13 +111,54 @@ type StepResult struct {
 type Engine struct {
 	workflow *ast.Workflow
 	funcs    FunctionRegistry
+	logger   *slog.Logger
+	limits   Limits
+
+	stepHook   StepHook             // step lifecycle callback, if any
+	tracer     trace.Tracer         // spans for the execution and its steps
+	traceAttrs []attribute.KeyValue // extra attributes for the execution span
 
 	mu        sync.Mutex
 	stepCount int
 	callDepth int
 	cancelled bool
+	cancelCtx context.CancelFunc // ends the running execution's context
+
+	retryJitter float64    // fraction of each backoff delay to randomize (0 = none)
+	rand        *rand.Rand // source for retry jitter, guarded by mu
+	clock       Clock      // waits out retry backoff delays
+	brancher    Brancher   // functions and clock for each parallel branch (nil = shared)
+
+	parallelPeak int // most branches/iterations seen running at once in one parallel step
+}
+
+// Clock is the time source the engine waits on between retry attempts.
+// stdlib clocks satisfy it, so retries can share the clock that sys.sleep uses.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
 }
 
+// wallClock is the default Clock: it sleeps for real.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Brancher gives a parallel branch its own functions and clock, so that
+// time-based functions in concurrent branches can keep separate time. Given
+// the functions and clock of the step that starts the branch, it returns the
+// ones the branch runs with and a function the engine calls once the branch
+// has finished.
+type Brancher func(funcs FunctionRegistry, clock Clock) (FunctionRegistry, Clock, func())
+
+// StepHook is called as each step starts, with the step's name. If it returns
+// a function, that function is called when the step finishes, with the error
+// the step failed with or nil. Steps in parallel branches call it
+// concurrently.
+type StepHook func(step string) func(err error)
+
 // contextKey is an unexported type for context keys defined in this package.
 type contextKey string
 
@@ -64,12 +177,147 @@ func parallelDepthFromCtx(ctx context.Context) int {
 	return 0
 }
 
+// callStackKey is the context key for the names of the workflows on the call
+// stack, outermost first (e.g. main -> fact -> fact).
+const callStackKey contextKey = "callStack"
+
+// withCallStack returns a context whose call stack is extended by name.
+func withCallStack(ctx context.Context, name string) context.Context {
+	parent := callStackFromCtx(ctx)
+	stack := make([]string, len(parent), len(parent)+1)
+	copy(stack, parent)
+	return context.WithValue(ctx, callStackKey, append(stack, name))
+}
+
+// callStackFromCtx returns the call stack stored in ctx, or nil.
+func callStackFromCtx(ctx context.Context) []string {
+	stack, _ := ctx.Value(callStackKey).([]string)
+	return stack
+}
+
+// stepPathKey is the context key for the path of workflow and step names
+// leading to the step currently executing (e.g. main -> loop -> call_api).
+const stepPathKey contextKey = "stepPath"
+
+// withStepPath returns a context whose step path is extended by name.
+func withStepPath(ctx context.Context, name string) context.Context {
+	parent := stepPathFromCtx(ctx)
+	path := make([]string, len(parent), len(parent)+1)
+	copy(path, parent)
+	return context.WithValue(ctx, stepPathKey, append(path, name))
+}
+
+// stepPathFromCtx returns the step path stored in ctx, or nil.
+func stepPathFromCtx(ctx context.Context) []string {
+	path, _ := ctx.Value(stepPathKey).([]string)
+	return path
+}
+
+// branchKey is the context key for the functions and clock of the parallel
+// branch a step runs in, when a Brancher gave the branch its own.
+const branchKey contextKey = "branch"
+
+// branchEnv is what a Brancher gave a parallel branch.
+type branchEnv struct {
+	funcs FunctionRegistry
+	clock Clock
+}
+
+// funcsFor returns the functions for steps running in ctx.
+func (e *Engine) funcsFor(ctx context.Context) FunctionRegistry {
+	if b, ok := ctx.Value(branchKey).(branchEnv); ok {
+		return b.funcs
+	}
+	return e.funcs
+}
+
+// clockFor returns the clock for steps running in ctx.
+func (e *Engine) clockFor(ctx context.Context) Clock {
+	if b, ok := ctx.Value(branchKey).(branchEnv); ok {
+		return b.clock
+	}
+	return e.clock
+}
+
+// startBranch returns the context for a parallel branch started from ctx and
+// a function to call once the branch has finished.
+func (e *Engine) startBranch(ctx context.Context) (context.Context, func()) {
+	if e.brancher == nil {
+		return ctx, func() {}
+	}
+	funcs, clock, done := e.brancher(e.funcsFor(ctx), e.clockFor(ctx))
+	return context.WithValue(ctx, branchKey, branchEnv{funcs: funcs, clock: clock}), done
+}
+
+// recordStepPath attaches the step path of ctx to err when err is a
+// WorkflowError that has not yet recorded where it was raised. The innermost
+// failing step records first, so enclosing steps leave the path alone.
+func recordStepPath(ctx context.Context, err error) {
+	if we, ok := err.(*types.WorkflowError); ok && we.StepPath == nil {
+		we.StepPath = stepPathFromCtx(ctx)
+	}
+}
+
 // NewEngine creates a new workflow execution engine.
 func NewEngine(workflow *ast.Workflow, funcs FunctionRegistry) *Engine {
 	return &Engine{
 		workflow: workflow,
 		funcs:    funcs,
+		logger:   logging.Default(),
+		limits:   Limits{}.withDefaults(),
+		tracer:   noop.NewTracerProvider().Tracer(""),
+		clock:    wallClock{},
+	}
+}
+
+// SetLimits overrides the engine's per-execution limits. Zero fields keep
+// their GCW defaults.
+func (e *Engine) SetLimits(l Limits) {
+	e.limits = l.withDefaults()
+}
+
+// SetLogger sets the logger for step events. Callers typically attach the
+// execution and workflow names so the records can be correlated.
+func (e *Engine) SetLogger(l *slog.Logger) {
+	e.logger = l
+}
+
+// SetStepHook sets the callback notified as each step starts and finishes.
+func (e *Engine) SetStepHook(h StepHook) {
+	e.stepHook = h
+}
+
+// SetTracer makes the engine record the execution as a root span on t, with
+// attrs added to it, and each step it runs as a child span carrying the
+// step's name and type. Steps nested in other steps, loops, parallel branches
+// and subworkflow calls are children of the step that ran them.
+func (e *Engine) SetTracer(t trace.Tracer, attrs ...attribute.KeyValue) {
+	e.tracer = t
+	e.traceAttrs = attrs
+}
+
+// SetClock sets the clock the engine waits on for retry backoff delays. The
+// default sleeps on the wall clock for the full delay.
+func (e *Engine) SetClock(c Clock) {
+	e.clock = c
+}
+
+// SetBrancher sets how each parallel branch gets its functions and clock.
+// Without one, branches share the engine's.
+func (e *Engine) SetBrancher(b Brancher) {
+	e.brancher = b
+}
+
+// SetRetryJitter randomizes every retry backoff delay by up to ±jitter of its
+// value (e.g. 0.1 for ±10%). Zero, the default, keeps delays deterministic.
+// src supplies the randomness so runs can be reproduced; nil uses a
+// time-seeded source.
+func (e *Engine) SetRetryJitter(jitter float64, src rand.Source) {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
 	}
+	e.retryJitter = jitter
+	e.rand = rand.New(src)
 }
 
 // Execute runs the main workflow with the given arguments and returns the result.
@@ -99,15 +347,45 @@ func (e *Engine) Execute(ctx context.Context, args types.Value) (types.Value, er
 		}
 	}
 
+	ctx, span := e.tracer.Start(ctx, "execution", trace.WithNewRoot(),
+		trace.WithAttributes(e.traceAttrs...))
+	defer span.End()
+
+	// Cancel ends the context so that, as with a deadline, in-flight steps
+	// stop and no retry, except or finally runs
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.mu.Lock()
+	e.cancelCtx = cancel
+	e.mu.Unlock()
+
 	// Execute main directly without counting toward call stack depth
-	result, err := e.executeSteps(ctx, e.workflow.Main.Steps, scope)
+	ctx = withCallStack(ctx, e.workflow.Main.Name)
+	ctx = withStepPath(ctx, e.workflow.Main.Name)
+	result, err := e.executeBlock(ctx, e.workflow.Main.Steps, scope,
+		fmt.Sprintf("workflow '%s'", e.workflow.Main.Name))
 	if err != nil {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = types.NewTimeoutError("execution exceeded its deadline")
+		case e.isCancelled():
+			err = types.NewCancelledError("execution cancelled")
+		}
+		recordSpanError(span, err)
 		return types.Null, err
 	}
 	return result.Value, nil
 }
 
-// executeSubworkflow runs a subworkflow with its own scope.
+// recordSpanError marks span as failed with err.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// executeSubworkflow runs a subworkflow with its own scope. Only an explicit
+// return yields a value: a subworkflow that runs off its last step or ends
+// with next: end returns null, and only the subworkflow ends, not its caller.
 func (e *Engine) executeSubworkflow(ctx context.Context, sub *ast.Subworkflow, scope *VariableScope) (types.Value, error) {
 	e.mu.Lock()
 	e.callDepth++
@@ -120,21 +398,31 @@ func (e *Engine) executeSubworkflow(ctx context.Context, sub *ast.Subworkflow, s
 		e.mu.Unlock()
 	}()
 
-	if depth > MaxCallStackDepth {
-		return types.Null, types.NewRecursionError()
+	ctx = withCallStack(ctx, sub.Name)
+	if depth > e.limits.MaxCallStackDepth {
+		// Name the calls so an unbounded recursion shows its cycle
+		return types.Null, types.NewRecursionError(fmt.Sprintf(
+			"call stack depth limit exceeded (max %d): %s",
+			e.limits.MaxCallStackDepth, strings.Join(callStackFromCtx(ctx), " -> ")))
 	}
 
-	result, err := e.executeSteps(ctx, sub.Steps, scope)
+	result, err := e.executeBlock(withStepPath(ctx, sub.Name), sub.Steps, scope,
+		fmt.Sprintf("workflow '%s'", sub.Name))
 	if err != nil {
 		return types.Null, err
 	}
+	if result.Flow != FlowReturn {
+		return types.Null, nil
+	}
 	return result.Value, nil
 }
 
 // executeSteps runs a sequence of steps and returns the result.
 func (e *Engine) executeSteps(ctx context.Context, steps []*ast.Step, scope *VariableScope) (StepResult, error) {
+	// An empty block simply completes; only an explicit next: end ends the
+	// workflow.
 	if len(steps) == 0 {
-		return StepResult{Flow: FlowEnd, Value: types.Null}, nil
+		return StepResult{Flow: FlowNone}, nil
 	}
 
 	// Build step index for next jumps
@@ -154,23 +442,39 @@ func (e *Engine) executeSteps(ctx context.Context, steps []*ast.Step, scope *Var
 		e.mu.Lock()
 		if e.cancelled {
 			e.mu.Unlock()
-			return StepResult{}, fmt.Errorf("execution cancelled")
+			return StepResult{}, types.NewCancelledError("execution cancelled")
 		}
 		e.stepCount++
-		if e.stepCount > MaxStepsPerExecution {
+		if e.stepCount > e.limits.MaxSteps {
 			e.mu.Unlock()
 			return StepResult{}, types.NewResourceLimitError(
-				fmt.Sprintf("execution exceeded maximum step limit of %d", MaxStepsPerExecution))
+				fmt.Sprintf("execution exceeded maximum step limit of %d", e.limits.MaxSteps))
 		}
 		e.mu.Unlock()
 
 		step := steps[i]
-		log.Printf("[DEBUG] Executing step: %s", step.Name)
-		result, err := e.executeStep(ctx, step, scope)
+		e.logger.Debug("executing step", logging.KeyStep, step.Name)
+		stepCtx, span := e.tracer.Start(withStepPath(ctx, step.Name), step.Name,
+			trace.WithAttributes(
+				attribute.String("gcw.step.name", step.Name),
+				attribute.String("gcw.step.type", step.Type()),
+			))
+		var stepDone func(error)
+		if e.stepHook != nil {
+			stepDone = e.stepHook(step.Name)
+		}
+		result, err := e.executeStep(stepCtx, step, scope)
+		if stepDone != nil {
+			stepDone(err)
+		}
 		if err != nil {
-			log.Printf("[ERROR] Step %s failed: %v", step.Name, err)
+			recordStepPath(stepCtx, err)
+			recordSpanError(span, err)
+			span.End()
+			e.logger.Error("step failed", logging.KeyStep, step.Name, "error", err)
 			return StepResult{}, err
 		}
+		span.End()
 
 		switch result.Flow {
 		case FlowNone:
@@ -187,7 +491,8 @@ func (e *Engine) executeSteps(ctx context.Context, steps []*ast.Step, scope *Var
 			}
 			idx, ok := stepIndex[result.NextStep]
 			if !ok {
-				return StepResult{}, fmt.Errorf("step '%s' not found", result.NextStep)
+				// The target may be in an enclosing block
+				return result, nil
 			}
 			i = idx
 		case FlowEnd:
@@ -204,7 +509,21 @@ func (e *Engine) executeSteps(ctx context.Context, steps []*ast.Step, scope *Var
 	return StepResult{Flow: FlowNone}, nil
 }
 
-// executeStep runs a single step.
+// executeBlock runs steps that form a jump boundary: a workflow body, a loop
+// body or a parallel branch. A next target not found in steps or the blocks
+// nested within them cannot be reached from inside; where describes the
+// boundary in the resulting error.
+func (e *Engine) executeBlock(ctx context.Context, steps []*ast.Step, scope *VariableScope, where string) (StepResult, error) {
+	result, err := e.executeSteps(ctx, steps, scope)
+	if err == nil && result.Flow == FlowNext {
+		return StepResult{}, fmt.Errorf("next: step '%s' not found in %s", result.NextStep, where)
+	}
+	return result, err
+}
+
+// executeStep runs a single step. A step may combine several clauses; they
+// run in a fixed order regardless of their order in the source: steps,
+// assign, call, switch, for, try, parallel, raise, return, next.
 func (e *Engine) executeStep(ctx context.Context, step *ast.Step, scope *VariableScope) (StepResult, error) {
 	var result StepResult
 	var err error
@@ -215,14 +534,14 @@ func (e *Engine) executeStep(ctx context.Context, step *ast.Step, scope *Variabl
 		if err != nil {
 			return StepResult{}, err
 		}
-		if result.Flow == FlowReturn || result.Flow == FlowBreak || result.Flow == FlowContinue {
+		if result.Flow != FlowNone {
 			return result, nil
 		}
 	}
 
 	// Handle assign step
 	if step.Assign != nil {
-		err = e.executeAssign(step.Assign, scope)
+		err = e.executeAssign(ctx, step.Assign, scope)
 		if err != nil {
 			return StepResult{}, err
 		}
@@ -279,12 +598,12 @@ func (e *Engine) executeStep(ctx context.Context, step *ast.Step, scope *Variabl
 
 	// Handle raise
 	if step.Raise != nil {
-		return StepResult{}, e.executeRaise(step.Raise, scope)
+		return StepResult{}, e.executeRaise(ctx, step.Raise, scope)
 	}
 
 	// Handle return
 	if step.HasReturn {
-		val, err := EvalValue(step.Return, scope, e.funcs)
+		val, err := EvalValue(step.Return, scope, e.funcsFor(ctx))
 		if err != nil {
 			return StepResult{}, err
 		}
@@ -303,7 +622,7 @@ func (e *Engine) executeStep(ctx context.Context, step *ast.Step, scope *Variabl
 const MaxAssignments = 50
 
 // executeAssign executes an assign step.
-func (e *Engine) executeAssign(assignments []ast.Assignment, scope *VariableScope) error {
+func (e *Engine) executeAssign(ctx context.Context, assignments []ast.Assignment, scope *VariableScope) error {
 	if len(assignments) > MaxAssignments {
 		return types.NewResourceLimitError(
 			fmt.Sprintf("assign step exceeds maximum of %d assignments", MaxAssignments))
@@ -313,11 +632,11 @@ func (e *Engine) executeAssign(assignments []ast.Assignment, scope *VariableScop
 	defer scope.UnlockShared()
 
 	for _, a := range assignments {
-		val, err := EvalValue(a.Value, scope, e.funcs)
+		val, err := EvalValue(a.Value, scope, e.funcsFor(ctx))
 		if err != nil {
 			return err
 		}
-		err = SetByPath(scope, a.Target, val)
+		err = SetByPath(scope, a.Target, val, e.funcsFor(ctx))
 		if err != nil {
 			return err
 		}
@@ -339,7 +658,7 @@ func (e *Engine) executeCall(ctx context.Context, call *ast.CallExpr, scope *Var
 		// Build a single map argument for function calls
 		argMap := types.NewOrderedMap()
 		for k, v := range call.Args {
-			val, err := EvalValue(v, scope, e.funcs)
+			val, err := EvalValue(v, scope, e.funcsFor(ctx))
 			if err != nil {
 				return err
 			}
@@ -348,43 +667,58 @@ func (e *Engine) executeCall(ctx context.Context, call *ast.CallExpr, scope *Var
 		args = append(args, types.NewMap(argMap))
 	}
 
-	result, err := e.funcs.CallFunction(call.Function, args)
+	result, err := e.funcsFor(ctx).CallFunction(call.Function, args)
 	if err != nil {
 		return err
 	}
 
 	if call.Result != "" {
+		if err := scope.CheckWritable(call.Result); err != nil {
+			return err
+		}
 		scope.Set(call.Result, result)
 	}
 
 	return nil
 }
 
-// executeSubworkflowCall calls a subworkflow with evaluated arguments.
+// executeSubworkflowCall calls a subworkflow with evaluated arguments. Param
+// defaults are only evaluated for missing arguments, in the caller's scope.
+// Arguments are deep-copied, so the subworkflow cannot mutate the caller's
+// maps and lists.
 func (e *Engine) executeSubworkflowCall(ctx context.Context, sub *ast.Subworkflow, call *ast.CallExpr, parentScope *VariableScope) error {
 	childScope := NewScope()
 
+	// Every argument must name a param, so a typo is not silently dropped
+	for _, name := range slices.Sorted(maps.Keys(call.Args)) {
+		if !slices.ContainsFunc(sub.Params, func(p ast.Param) bool { return p.Name == name }) {
+			return types.NewValueError(
+				fmt.Sprintf("unexpected argument '%s' for subworkflow '%s'", name, sub.Name))
+		}
+	}
+
 	// Evaluate and set parameters
 	for _, param := range sub.Params {
 		if call.Args != nil {
 			if argExpr, ok := call.Args[param.Name]; ok {
-				val, err := EvalValue(argExpr, parentScope, e.funcs)
+				val, err := EvalValue(argExpr, parentScope, e.funcsFor(ctx))
 				if err != nil {
 					return err
 				}
-				childScope.Set(param.Name, val)
+				childScope.Set(param.Name, val.Clone())
 				continue
 			}
 		}
 		// Use default value
 		if param.HasDefault {
-			val, err := EvalValue(param.Default, parentScope, e.funcs)
+			val, err := EvalValue(param.Default, parentScope, e.funcsFor(ctx))
 			if err != nil {
 				return err
 			}
-			childScope.Set(param.Name, val)
+			childScope.Set(param.Name, val.Clone())
 		} else {
-			return fmt.Errorf("missing required argument '%s' for subworkflow '%s'", param.Name, sub.Name)
+			return types.NewValueError(
+				fmt.Sprintf("missing required argument '%s' for subworkflow '%s'", param.Name, sub.Name))
 		}
 	}
 
@@ -394,6 +728,9 @@ func (e *Engine) executeSubworkflowCall(ctx context.Context, sub *ast.Subworkflo
 	}
 
 	if call.Result != "" {
+		if err := parentScope.CheckWritable(call.Result); err != nil {
+			return err
+		}
 		parentScope.Set(call.Result, result)
 	}
 
@@ -411,7 +748,7 @@ func (e *Engine) executeSwitch(ctx context.Context, conditions []ast.SwitchCondi
 	}
 	for _, cond := range conditions {
 		if cond.Condition != nil {
-			val, err := EvalValue(cond.Condition, scope, e.funcs)
+			val, err := EvalValue(cond.Condition, scope, e.funcsFor(ctx))
 			if err != nil {
 				return StepResult{}, err
 			}
@@ -422,7 +759,7 @@ func (e *Engine) executeSwitch(ctx context.Context, conditions []ast.SwitchCondi
 
 		// Condition matched - execute any inline actions
 		if cond.Assign != nil {
-			err := e.executeAssign(cond.Assign, scope)
+			err := e.executeAssign(ctx, cond.Assign, scope)
 			if err != nil {
 				return StepResult{}, err
 			}
@@ -439,7 +776,7 @@ func (e *Engine) executeSwitch(ctx context.Context, conditions []ast.SwitchCondi
 		}
 
 		if cond.HasReturn {
-			val, err := EvalValue(cond.Return, scope, e.funcs)
+			val, err := EvalValue(cond.Return, scope, e.funcsFor(ctx))
 			if err != nil {
 				return StepResult{}, err
 			}
@@ -447,7 +784,7 @@ func (e *Engine) executeSwitch(ctx context.Context, conditions []ast.SwitchCondi
 		}
 
 		if cond.Raise != nil {
-			return StepResult{}, e.executeRaise(cond.Raise, scope)
+			return StepResult{}, e.executeRaise(ctx, cond.Raise, scope)
 		}
 
 		if cond.Next != "" {
@@ -469,11 +806,11 @@ func (e *Engine) executeFor(ctx context.Context, forExpr *ast.ForExpr, parentSco
 
 	if forExpr.HasRange {
 		// Evaluate range bounds
-		startVal, err := EvalValue(forExpr.Range[0], parentScope, e.funcs)
+		startVal, err := EvalValue(forExpr.Range[0], parentScope, e.funcsFor(ctx))
 		if err != nil {
 			return StepResult{}, err
 		}
-		endVal, err := EvalValue(forExpr.Range[1], parentScope, e.funcs)
+		endVal, err := EvalValue(forExpr.Range[1], parentScope, e.funcsFor(ctx))
 		if err != nil {
 			return StepResult{}, err
 		}
@@ -484,7 +821,7 @@ func (e *Engine) executeFor(ctx context.Context, forExpr *ast.ForExpr, parentSco
 		}
 	} else {
 		// Evaluate the iterable
-		iterVal, err := EvalValue(forExpr.In, parentScope, e.funcs)
+		iterVal, err := EvalValue(forExpr.In, parentScope, e.funcsFor(ctx))
 		if err != nil {
 			return StepResult{}, err
 		}
@@ -516,7 +853,8 @@ func (e *Engine) executeFor(ctx context.Context, forExpr *ast.ForExpr, parentSco
 			loopScope.SetLocal(forExpr.Index, indices[i])
 		}
 
-		result, err := e.executeSteps(ctx, forExpr.Steps, loopScope)
+		result, err := e.executeBlock(ctx, forExpr.Steps, loopScope,
+			"the for loop body (use next: break to leave a loop)")
 		if err != nil {
 			return StepResult{}, err
 		}
@@ -536,8 +874,29 @@ func (e *Engine) executeFor(ctx context.Context, forExpr *ast.ForExpr, parentSco
 	return StepResult{}, nil
 }
 
-// executeTry executes a try/except/retry step.
+// executeTry executes a try/except/retry step, followed by its finally block
+// if it has one.
 func (e *Engine) executeTry(ctx context.Context, tryExpr *ast.TryExpr, scope *VariableScope) (StepResult, error) {
+	result, err := e.executeTryExcept(ctx, tryExpr, scope)
+	if tryExpr.Finally == nil || uncatchable(ctx, err) {
+		return result, err
+	}
+
+	// finally runs whatever the outcome. An error or control flow (return,
+	// next, ...) from finally itself replaces the try/except outcome.
+	finallyResult, finallyErr := e.executeSteps(ctx, tryExpr.Finally, scope)
+	if finallyErr != nil {
+		return StepResult{}, finallyErr
+	}
+	if finallyResult.Flow != FlowNone {
+		return finallyResult, nil
+	}
+	return result, err
+}
+
+// executeTryExcept runs the try block with its retry policy and, if it
+// still fails, the except block.
+func (e *Engine) executeTryExcept(ctx context.Context, tryExpr *ast.TryExpr, scope *VariableScope) (StepResult, error) {
 	maxAttempts := 1
 	if tryExpr.Retry != nil {
 		maxAttempts = tryExpr.Retry.MaxRetries + 1
@@ -553,13 +912,21 @@ func (e *Engine) executeTry(ctx context.Context, tryExpr *ast.TryExpr, scope *Va
 
 		lastErr = err
 
+		// A cancelled or timed-out execution must not be retried or caught
+		if uncatchable(ctx, err) {
+			return StepResult{}, err
+		}
+
 		// Check if we should retry
 		if tryExpr.Retry != nil && attempt < maxAttempts-1 {
-			if e.shouldRetry(tryExpr.Retry, err, scope) {
-				// Apply backoff delay if configured
+			if e.shouldRetry(ctx, tryExpr.Retry, err) {
+				// Wait out the backoff delay before the next attempt
 				if tryExpr.Retry.Backoff != nil {
 					delay := e.calculateBackoff(tryExpr.Retry.Backoff, attempt)
-					_ = delay // TODO: actually sleep for delay seconds
+					e.clockFor(ctx).Sleep(time.Duration(delay * float64(time.Second)))
+					if ctx.Err() != nil {
+						return StepResult{}, err
+					}
 				}
 				continue
 			}
@@ -575,29 +942,86 @@ func (e *Engine) executeTry(ctx context.Context, tryExpr *ast.TryExpr, scope *Va
 	return StepResult{}, lastErr
 }
 
-// shouldRetry determines if an error should be retried based on the retry predicate.
-func (e *Engine) shouldRetry(retry *ast.RetryExpr, err error, scope *VariableScope) bool {
+// uncatchable reports whether err ends the execution without any retry,
+// except or finally running: the execution has timed out or been cancelled.
+// Cancel marks the engine cancelled just before it ends the context, so a
+// CancelledError can surface while ctx is still live; its tag alone is
+// enough.
+func uncatchable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	var we *types.WorkflowError
+	return errors.As(err, &we) && we.HasTag(types.TagCancelledError)
+}
+
+// shouldRetry determines if an error should be retried based on the retry
+// predicate: a built-in predicate or a subworkflow named either bare or in a
+// ${} wrapper. The parser rejects any other predicate; one that slips through
+// is treated as not retrying.
+func (e *Engine) shouldRetry(ctx context.Context, retry *ast.RetryExpr, err error) bool {
 	if retry.Predicate == nil {
 		return true // retry all if no predicate
 	}
 
-	// Check for built-in retry predicates
-	if predStr, ok := retry.Predicate.(string); ok {
-		// Handle ${http.default_retry} and similar
-		predStr = extractExprString(predStr)
-		switch predStr {
-		case "http.default_retry", "http.default_retry_predicate":
-			return isRetryableHTTPError(err)
-		case "http.default_retry_non_idempotent":
-			return isRetryableHTTPError(err)
-		case "retry.always":
-			return true
-		case "retry.never":
-			return false
+	predStr, _ := retry.Predicate.(string)
+	name := strings.TrimSpace(extractExprString(strings.TrimSpace(predStr)))
+	if matched, retryErr := builtinRetryPredicate(name, err); matched {
+		return retryErr
+	}
+
+	// Custom predicate: a subworkflow that receives the error
+	if sub, ok := e.workflow.Subworkflows[name]; ok {
+		return e.evalRetryPredicate(ctx, sub, err)
+	}
+
+	e.logger.Error("unknown retry predicate", "predicate", retry.Predicate)
+	return false
+}
+
+// evalRetryPredicate runs a custom predicate subworkflow with the error map
+// bound to its first parameter and reports whether it returned a truthy value.
+// A predicate that itself fails is treated as not retrying.
+func (e *Engine) evalRetryPredicate(ctx context.Context, sub *ast.Subworkflow, err error) bool {
+	predScope := NewScope()
+	for i, param := range sub.Params {
+		if i == 0 {
+			predScope.Set(param.Name, errorValue(err))
+			continue
+		}
+		if param.HasDefault {
+			val, evalErr := EvalValue(param.Default, predScope, e.funcsFor(ctx))
+			if evalErr != nil {
+				e.logger.Error("retry predicate failed", "predicate", sub.Name, "error", evalErr)
+				return false
+			}
+			predScope.Set(param.Name, val)
 		}
 	}
 
-	return true
+	result, predErr := e.executeSubworkflow(ctx, sub, predScope)
+	if predErr != nil {
+		e.logger.Error("retry predicate failed", "predicate", sub.Name, "error", predErr)
+		return false
+	}
+	return result.Truthy()
+}
+
+// builtinRetryPredicate applies the built-in predicate called name to err.
+// It reports whether name is a built-in predicate and, if so, whether err
+// should be retried.
+func builtinRetryPredicate(name string, err error) (matched, retry bool) {
+	switch name {
+	case "http.default_retry", "http.default_retry_predicate":
+		return true, isRetryableHTTPError(err)
+	case "http.default_retry_non_idempotent":
+		return true, isRetryableHTTPError(err)
+	case "retry.always":
+		return true, true
+	case "retry.never":
+		return true, false
+	}
+	return false, false
 }
 
 // extractExprString extracts the expression from a ${...} wrapper.
@@ -626,7 +1050,8 @@ func isRetryableHTTPError(err error) bool {
 	return false
 }
 
-// calculateBackoff calculates the delay for a retry attempt using exponential backoff.
+// calculateBackoff calculates the delay for a retry attempt using exponential
+// backoff, randomized by the engine's retry jitter when one is set.
 func (e *Engine) calculateBackoff(backoff *ast.BackoffExpr, attempt int) float64 {
 	delay := backoff.InitialDelay
 	for i := 0; i < attempt; i++ {
@@ -635,35 +1060,44 @@ func (e *Engine) calculateBackoff(backoff *ast.BackoffExpr, attempt int) float64
 	if delay > backoff.MaxDelay {
 		delay = backoff.MaxDelay
 	}
+	if e.retryJitter > 0 && e.rand != nil {
+		e.mu.Lock()
+		r := e.rand.Float64()
+		e.mu.Unlock()
+		delay *= 1 + e.retryJitter*(2*r-1)
+	}
 	return delay
 }
 
 // executeExcept handles an error in the except block.
 func (e *Engine) executeExcept(ctx context.Context, except *ast.ExceptExpr, err error, scope *VariableScope) (StepResult, error) {
-	// In GCW, except blocks share the parent scope so variables set inside
-	// are visible after the try/except completes.
-	// We bind the error variable directly in the current scope.
+	// In GCW, the error variable and any variable first created inside the
+	// except block are local to it. Variables that already exist in the
+	// enclosing scope are still assigned in place.
+	exceptScope := scope.NewChildScope()
 	if except.As != "" {
-		var errVal types.Value
-		if we, ok := err.(*types.WorkflowError); ok {
-			errVal = we.ToValue()
-		} else {
-			// For non-WorkflowError errors, create a map with message field
-			m := types.NewOrderedMap()
-			m.Set("message", types.NewString(err.Error()))
-			m.Set("code", types.NewInt(0))
-			m.Set("tags", types.NewList(nil))
-			errVal = types.NewMap(m)
-		}
-		scope.Set(except.As, errVal)
+		exceptScope.SetLocal(except.As, errorValue(err))
 	}
 
-	return e.executeSteps(ctx, except.Steps, scope)
+	return e.executeSteps(ctx, except.Steps, exceptScope)
+}
+
+// errorValue converts err to the error map seen by workflow code.
+func errorValue(err error) types.Value {
+	if we, ok := err.(*types.WorkflowError); ok {
+		return we.ToValue()
+	}
+	// For non-WorkflowError errors, create a map with message field
+	m := types.NewOrderedMap()
+	m.Set("message", types.NewString(err.Error()))
+	m.Set("code", types.NewInt(0))
+	m.Set("tags", types.NewList(nil))
+	return types.NewMap(m)
 }
 
 // executeRaise raises an error from a raise step.
-func (e *Engine) executeRaise(raiseExpr interface{}, scope *VariableScope) error {
-	val, err := EvalValue(raiseExpr, scope, e.funcs)
+func (e *Engine) executeRaise(ctx context.Context, raiseExpr interface{}, scope *VariableScope) error {
+	val, err := EvalValue(raiseExpr, scope, e.funcsFor(ctx))
 	if err != nil {
 		return err
 	}
@@ -688,9 +1122,9 @@ const MaxParallelNestingDepth = 2
 // executeParallel executes a parallel step.
 func (e *Engine) executeParallel(ctx context.Context, p *ast.ParallelExpr, scope *VariableScope) error {
 	depth := parallelDepthFromCtx(ctx) + 1
-	if depth > MaxParallelNestingDepth {
+	if depth > e.limits.MaxParallelNestingDepth {
 		return types.NewParallelNestingError(
-			fmt.Sprintf("parallel nesting depth %d exceeds maximum of %d", depth, MaxParallelNestingDepth))
+			fmt.Sprintf("parallel nesting depth %d exceeds maximum of %d", depth, e.limits.MaxParallelNestingDepth))
 	}
 
 	// Propagate the incremented depth to child goroutines via context.
@@ -705,6 +1139,16 @@ func (e *Engine) executeParallel(ctx context.Context, p *ast.ParallelExpr, scope
 	return nil
 }
 
+// sharedSet returns the shared variable names of a parallel step as a set.
+// The set is never nil, so branch scopes always enforce it.
+func sharedSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
 // MaxParallelBranches is the maximum number of branches per parallel step.
 const MaxParallelBranches = 10
 
@@ -726,7 +1170,7 @@ func (e *Engine) executeParallelBranches(ctx context.Context, p *ast.ParallelExp
 	if limit <= 0 {
 		limit = 20
 	}
-	sem := make(chan struct{}, limit)
+	slots := newBranchSlots(limit)
 
 	branchCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -736,23 +1180,31 @@ func (e *Engine) executeParallelBranches(ctx context.Context, p *ast.ParallelExp
 
 	// Create shared mutex for all branches in this parallel step
 	sharedMu := &sync.Mutex{}
+	shared := sharedSet(p.Shared)
+
+	var running int32 // branches currently holding a slot
 
 	for i, branch := range p.Branches {
 		wg.Add(1)
+		ctx, done := e.startBranch(branchCtx)
 		go func(idx int, b *ast.ParallelBranch) {
 			defer wg.Done()
+			defer done()
 
-			sem <- struct{}{}
-			defer func() { <-sem }()
+			clock := e.clockFor(ctx)
+			slots.acquire(clock)
+			defer slots.release(clock)
+			defer e.trackParallel(&running)()
 
 			// Create branch scope with shared variable access
 			branchScope := &VariableScope{
 				parent:   scope,
 				vars:     make(map[string]types.Value),
 				sharedMu: sharedMu,
+				shared:   shared,
 			}
 
-			_, err := e.executeSteps(branchCtx, b.Steps, branchScope)
+			_, err := e.executeBlock(ctx, b.Steps, branchScope, "the parallel branch")
 			results[idx] = branchResult{err: err}
 
 			if err != nil && p.ExceptionPolicy != "continueAll" {
@@ -791,7 +1243,7 @@ func (e *Engine) executeParallelBranches(ctx context.Context, p *ast.ParallelExp
 // executeParallelFor runs a parallel for loop.
 func (e *Engine) executeParallelFor(ctx context.Context, p *ast.ParallelExpr, scope *VariableScope) error {
 	// Evaluate the iterable
-	iterVal, err := EvalValue(p.For.In, scope, e.funcs)
+	iterVal, err := EvalValue(p.For.In, scope, e.funcsFor(ctx))
 	if err != nil {
 		return err
 	}
@@ -808,7 +1260,7 @@ func (e *Engine) executeParallelFor(ctx context.Context, p *ast.ParallelExpr, sc
 	if limit <= 0 {
 		limit = 20
 	}
-	sem := make(chan struct{}, limit)
+	slots := newBranchSlots(limit)
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
@@ -819,26 +1271,34 @@ func (e *Engine) executeParallelFor(ctx context.Context, p *ast.ParallelExpr, sc
 
 	// Create shared mutex for all iterations in this parallel for
 	sharedMu := &sync.Mutex{}
+	shared := sharedSet(p.Shared)
+
+	var running int32 // iterations currently holding a slot
 
 	for i, item := range items {
 		wg.Add(1)
+		ctx, done := e.startBranch(forCtx)
 		go func(idx int, it types.Value) {
 			defer wg.Done()
+			defer done()
 
-			sem <- struct{}{}
-			defer func() { <-sem }()
+			clock := e.clockFor(ctx)
+			slots.acquire(clock)
+			defer slots.release(clock)
+			defer e.trackParallel(&running)()
 
 			iterScope := &VariableScope{
 				parent:   scope,
 				vars:     make(map[string]types.Value),
 				sharedMu: sharedMu,
+				shared:   shared,
 			}
 			iterScope.SetLocal(p.For.Value, it)
 			if p.For.Index != "" {
 				iterScope.SetLocal(p.For.Index, types.NewInt(int64(idx)))
 			}
 
-			_, err := e.executeSteps(forCtx, p.For.Steps, iterScope)
+			_, err := e.executeBlock(ctx, p.For.Steps, iterScope, "the parallel for loop body")
 			if err != nil && p.ExceptionPolicy != "continueAll" {
 				mu.Lock()
 				if firstErr == nil {
@@ -854,11 +1314,75 @@ func (e *Engine) executeParallelFor(ctx context.Context, p *ast.ParallelExpr, sc
 	return firstErr
 }
 
-// Cancel cancels the current execution.
+// branchSlots bounds how many branches or iterations of a parallel step run
+// at once. Each slot holds the time it was last released, so a branch that
+// waited for one starts, on its own clock, no earlier than the branch before
+// it in that slot finished.
+type branchSlots chan time.Time
+
+// newBranchSlots returns limit free slots.
+func newBranchSlots(limit int) branchSlots {
+	s := make(branchSlots, limit)
+	for i := 0; i < limit; i++ {
+		s <- time.Time{}
+	}
+	return s
+}
+
+// acquire waits for a free slot and moves clock on to the time it was
+// released, if that is later.
+func (s branchSlots) acquire(clock Clock) {
+	if d := (<-s).Sub(clock.Now()); d > 0 {
+		clock.Sleep(d)
+	}
+}
+
+// release frees a slot at clock's current time.
+func (s branchSlots) release(clock Clock) {
+	s <- clock.Now()
+}
+
+// trackParallel records that one more branch or iteration of a parallel step
+// is running, updating the engine's high-water mark, and returns a function
+// that records its completion.
+func (e *Engine) trackParallel(running *int32) func() {
+	n := int(atomic.AddInt32(running, 1))
+	e.mu.Lock()
+	if n > e.parallelPeak {
+		e.parallelPeak = n
+	}
+	e.mu.Unlock()
+	return func() { atomic.AddInt32(running, -1) }
+}
+
+// PeakParallelism returns the largest number of branches or iterations of a
+// single parallel step that have run at the same time in this execution. It
+// never exceeds the step's concurrency_limit.
+func (e *Engine) PeakParallelism() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.parallelPeak
+}
+
+// Cancel cancels the current execution. As in GCW, cancellation is abrupt:
+// the running step is abandoned and no except, retry or finally block runs.
+// There is no graceful mode that lets cleanup run. Execute returns a
+// CancelledError; if Cancel is called before Execute, no step runs at all.
 func (e *Engine) Cancel() {
 	e.mu.Lock()
 	e.cancelled = true
+	cancel := e.cancelCtx
 	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// isCancelled reports whether Cancel has been called.
+func (e *Engine) isCancelled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cancelled
 }
 
 // StepCount returns the current step count.
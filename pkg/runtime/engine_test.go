@@ -2,11 +2,28 @@ package runtime
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/stdlib"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func runWorkflow(t *testing.T, source string, args types.Value) types.Value {
@@ -177,6 +194,97 @@ main:
 	}
 }
 
+func TestSwitchNextToOuterStep(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - group:
+        steps:
+          - check:
+              switch:
+                - condition: true
+                  next: finish
+          - unreachable:
+              return: "fell through"
+    - skipped:
+        return: "skipped"
+    - finish:
+        return: "jumped"
+`, types.Null)
+
+	if !result.Equal(types.NewString("jumped")) {
+		t.Errorf("got %v, want 'jumped'", result)
+	}
+}
+
+func TestNextToUnknownStepFails(t *testing.T) {
+	tests := map[string]struct {
+		source string
+		want   string
+	}{
+		"missing step": {
+			source: `
+main:
+  steps:
+    - check:
+        switch:
+          - condition: true
+            next: nowhere
+`,
+			want: "next: step 'nowhere' not found in workflow 'main'",
+		},
+		"out of a for loop": {
+			source: `
+main:
+  steps:
+    - loop:
+        for:
+          value: v
+          in: [1]
+          steps:
+            - leave:
+                next: done
+    - done:
+        return: 1
+`,
+			want: "next: step 'done' not found in the for loop body",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := runWorkflowExpectError(t, tt.source, types.Null)
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwitchListEquality(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - pair: [1, 2]
+    - check:
+        switch:
+          - condition: ${pair == [2, 1]}
+            return: "reversed"
+          - condition: ${pair != [1, 2]}
+            return: "different"
+          - condition: ${pair == [1, 2]}
+            return: "same"
+    - fallback:
+        return: "none"
+`, types.Null)
+
+	if !result.Equal(types.NewString("same")) {
+		t.Errorf("got %v, want 'same'", result)
+	}
+}
+
 func TestForLoop(t *testing.T) {
 	result := runWorkflow(t, `
 main:
@@ -382,6 +490,68 @@ main:
 	}
 }
 
+func TestTryFinally(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - cleanups: 0
+          - caught: ""
+    - succeeds:
+        try:
+          steps:
+            - ok:
+                assign:
+                  - x: 1
+        finally:
+          steps:
+            - cleanup:
+                assign:
+                  - cleanups: ${cleanups + 1}
+    - fails:
+        try:
+          steps:
+            - boom:
+                raise: "broken"
+        except:
+          as: e
+          steps:
+            - handle:
+                assign:
+                  - caught: ${e.message}
+        finally:
+          - cleanup:
+              assign:
+                - cleanups: ${cleanups + 1}
+    - uncaught:
+        try:
+          steps:
+            - nested:
+                try:
+                  steps:
+                    - boom:
+                        raise: "escapes"
+                finally:
+                  - cleanup:
+                      assign:
+                        - cleanups: ${cleanups + 1}
+        except:
+          as: e
+          steps:
+            - handle:
+                assign:
+                  - caught: ${caught + ", " + e.message}
+    - done:
+        return: ${[cleanups, caught]}
+`, types.Null)
+
+	want := types.NewList([]types.Value{types.NewInt(3), types.NewString("broken, escapes")})
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
 func TestRaise(t *testing.T) {
 	err := runWorkflowExpectError(t, `
 main:
@@ -542,6 +712,26 @@ main:
 	}
 }
 
+func TestNestedMapLiteral(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - data: ${{"user": {"name": "it's {Bob}", "tags": ["a"]}}}
+    - done:
+        return: ${data}
+`, types.Null)
+
+	want, err := types.ParseJSON([]byte(`{"user": {"name": "it's {Bob}", "tags": ["a"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
 func TestMapMutation(t *testing.T) {
 	result := runWorkflow(t, `
 main:
@@ -586,6 +776,34 @@ infinite:
 	}
 }
 
+func TestRecursionErrorNamesCallChain(t *testing.T) {
+	err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - start:
+        call: countdown
+        args:
+          n: 3
+
+countdown:
+  params: [n]
+  steps:
+    - again:
+        call: countdown
+        args:
+          n: ${n - 1}
+`, types.Null)
+
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+	}
+	want := "call stack depth limit exceeded (max 20): main" + strings.Repeat(" -> countdown", MaxCallStackDepth+1)
+	if we.Message != want {
+		t.Errorf("message = %q, want %q", we.Message, want)
+	}
+}
+
 func TestNestedSteps(t *testing.T) {
 	result := runWorkflow(t, `
 main:
@@ -606,3 +824,1230 @@ main:
 		t.Errorf("got %v, want 30", result)
 	}
 }
+
+func TestHTTPRelativeURLUsesBaseURL(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer svc.Close()
+
+	wf, err := parser.Parse([]byte(`
+main:
+  params: [args]
+  steps:
+    - relative:
+        call: http.get
+        args:
+          url: /users/1
+        result: rel
+    - absolute:
+        call: http.get
+        args:
+          url: ${args.absolute}
+        result: abs
+    - done:
+        return: ${[rel.body.path, abs.body.path]}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterHTTPWithBaseURL(nil, svc.URL+"/api/")
+	engine := NewEngine(wf, funcs)
+
+	args := types.NewOrderedMap()
+	args.Set("absolute", types.NewString(svc.URL+"/health"))
+	result, err := engine.Execute(context.Background(), types.NewMap(args))
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	want := types.NewList([]types.Value{types.NewString("/api/users/1"), types.NewString("/health")})
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
+func TestAssignIsVisibleToCallInSameStep(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer svc.Close()
+
+	// Keys are listed call-first to show that clause order, not key order,
+	// decides execution: the assign still runs before the call.
+	wf, err := parser.Parse([]byte(`
+main:
+  params: [base]
+  steps:
+    - fetch:
+        call: http.get
+        args:
+          url: ${url}
+        result: resp
+        assign:
+          - url: ${base + "/users/1"}
+        next: done
+    - skipped:
+        return: "next was ignored"
+    - done:
+        return: ${resp.body.path}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterHTTP(nil)
+	engine := NewEngine(wf, funcs)
+
+	result, err := engine.Execute(context.Background(), types.NewString(svc.URL))
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if !result.Equal(types.NewString("/users/1")) {
+		t.Errorf("got %v, want /users/1", result)
+	}
+}
+
+func TestConnectorCallReturnsMock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connectors.json")
+	if err := os.WriteFile(path, []byte(`{
+  "googleapis.storage.v1.objects.get": {"name": "report.csv", "size": "1024"}
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mocks, err := stdlib.LoadConnectorMocks(path)
+	if err != nil {
+		t.Fatalf("load mocks: %v", err)
+	}
+
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - get:
+        call: googleapis.storage.v1.objects.get
+        args:
+          bucket: my-bucket
+          object: report.csv
+        result: obj
+    - mutate:
+        assign:
+          - obj.size: "0"
+    - again:
+        call: googleapis.storage.v1.objects.get
+        args:
+          bucket: my-bucket
+          object: report.csv
+        result: fresh
+    - done:
+        return: ${fresh}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterConnectorMocks(mocks)
+	result, err := NewEngine(wf, funcs).Execute(context.Background(), types.Null)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	want := types.NewMap(types.NewOrderedMapFromPairs("name", types.NewString("report.csv"), "size", types.NewString("1024")))
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+
+	// Connectors without a mock name the missing method
+	err = runWorkflowExpectError(t, `
+main:
+  steps:
+    - list:
+        call: googleapis.storage.v1.objects.list
+        args:
+          bucket: my-bucket
+`, types.Null)
+	if !strings.Contains(err.Error(), "googleapis.storage.v1.objects.list") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHTTPMockServesCannedResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mocks.yaml")
+	if err := os.WriteFile(path, []byte(`
+- method: GET
+  url: https://api.example.com/*
+  response:
+    status: 200
+    headers:
+      X-Mocked: "yes"
+    body: {"user": "alice"}
+- method: POST
+  url: https://api.example.com/users
+  response:
+    status: 409
+    body: conflict
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mocks, err := stdlib.LoadHTTPMocks(path)
+	if err != nil {
+		t.Fatalf("load mocks: %v", err)
+	}
+
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - code: null
+    - get:
+        call: http.get
+        args:
+          url: https://api.example.com/users/1
+          query:
+            verbose: true
+        result: resp
+    - post:
+        try:
+          call: http.post
+          args:
+            url: https://api.example.com/users
+        except:
+          as: e
+          steps:
+            - caught:
+                assign:
+                  - code: ${e.code}
+    - done:
+        return: ${[resp.body.user, resp.headers["x-mocked"], code]}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	// Any request reaching the fallback transport would be a real network call
+	fallback := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("unmocked request to %s", r.URL)
+		return nil, fmt.Errorf("network disabled")
+	})
+
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterHTTP(&http.Client{Transport: mocks.Transport(fallback)})
+	result, err := NewEngine(wf, funcs).Execute(context.Background(), types.Null)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	want := types.NewList([]types.Value{types.NewString("alice"), types.NewString("yes"), types.NewInt(409)})
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
+
+func TestHTTPRecordThenReplay(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"method": %q, "echo": %q}`, r.Method, body)
+	}))
+
+	wf, err := parser.Parse([]byte(`
+main:
+  params: [base]
+  steps:
+    - get:
+        call: http.get
+        args:
+          url: ${base + "/items"}
+        result: got
+    - post_a:
+        call: http.post
+        args:
+          url: ${base + "/items"}
+          body: "a"
+        result: a
+    - post_b:
+        call: http.post
+        args:
+          url: ${base + "/items"}
+          body: "b"
+        result: b
+    - done:
+        return: ${[got.body, a.body, b.body]}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	run := func(rt http.RoundTripper) (types.Value, error) {
+		funcs := stdlib.NewRegistry()
+		funcs.RegisterHTTP(&http.Client{Transport: rt})
+		return NewEngine(wf, funcs).Execute(context.Background(), types.NewString(svc.URL))
+	}
+
+	dir := t.TempDir()
+	recorded, err := run(stdlib.RecordingTransport(dir, http.DefaultTransport))
+	if err != nil {
+		t.Fatalf("record run: %v", err)
+	}
+	svc.Close()
+
+	replayed, err := run(stdlib.ReplayTransport(dir))
+	if err != nil {
+		t.Fatalf("replay run: %v", err)
+	}
+	if !replayed.Equal(recorded) {
+		t.Errorf("replayed %v, recorded %v", replayed, recorded)
+	}
+	if a, b := replayed.AsList()[1], replayed.AsList()[2]; a.Equal(b) {
+		t.Errorf("requests differing only in body replayed the same response: %v", a)
+	}
+
+	// A request that was never recorded fails instead of reaching the network
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterHTTP(&http.Client{Transport: stdlib.ReplayTransport(dir)})
+	if _, err := funcs.CallFunction("http.get", []types.Value{
+		types.NewMap(types.NewOrderedMapFromPairs("url", types.NewString(svc.URL+"/other"))),
+	}); err == nil || !strings.Contains(err.Error(), "no recording") {
+		t.Errorf("unrecorded request: err = %v", err)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestNamespacedHelperAliases(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - m: {"a": 1, "b": 2}
+          - l: [1, 2, 3]
+    - done:
+        return:
+          keys: ${keys(m) == map.keys(m)}
+          map_len: ${len(m) == map.length(m)}
+          list_len: ${len(l) == list.length(l)}
+          get: ${get(m, "a") == map.get(m, "a")}
+          get_default: ${get(m, "z", 9) == map.get(m, "z", 9)}
+`, types.Null)
+
+	for _, key := range []string{"keys", "map_len", "list_len", "get", "get_default"} {
+		v, ok := result.AsMap().Get(key)
+		if !ok || !v.Equal(types.NewBool(true)) {
+			t.Errorf("%s: bare and namespaced forms differ (got %v)", key, v)
+		}
+	}
+}
+
+func TestListRangeExtremeBounds(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - done:
+        return: ${list.range(9223372036854775806, 9223372036854775807)}
+`, types.Null)
+	want := types.NewList([]types.Value{types.NewInt(math.MaxInt64 - 1), types.NewInt(math.MaxInt64)})
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+
+	for _, bounds := range []string{
+		"-1, 9223372036854775807",
+		"-9223372036854775807 - 1, 9223372036854775807",
+		"-9223372036854775807 - 1, 0",
+	} {
+		err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - done:
+        return: ${list.range(`+bounds+`)}
+`, types.Null)
+		if we, ok := err.(*types.WorkflowError); !ok || !we.HasTag(types.TagResourceLimitError) {
+			t.Errorf("list.range(%s): got %v, want ResourceLimitError", bounds, err)
+		}
+	}
+}
+
+func TestSysSleepInvalidSeconds(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds string
+		tag     string
+	}{
+		{"negative", "-1", types.TagValueError},
+		{"non-numeric", `"soon"`, types.TagValueError},
+		{"over limit", "40000000", types.TagResourceLimitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - wait:
+        call: sys.sleep
+        args:
+          seconds: `+tt.seconds+`
+`, types.Null)
+
+			we, ok := err.(*types.WorkflowError)
+			if !ok {
+				t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+			}
+			if !we.HasTag(tt.tag) {
+				t.Errorf("expected %s tag, got %v", tt.tag, we.Tags)
+			}
+		})
+	}
+}
+
+func TestSysSleepFractionalSeconds(t *testing.T) {
+	start := time.Now()
+	runWorkflow(t, `
+main:
+  steps:
+    - wait:
+        call: sys.sleep
+        args:
+          seconds: 0.25
+`, types.Null)
+
+	// Sub-second sleeps are not truncated to whole seconds
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 750*time.Millisecond {
+		t.Errorf("sys.sleep(0.25) took %v, want about 250ms", elapsed)
+	}
+}
+
+func TestSysSleepAdvancesVirtualClockExactly(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - fractional:
+        call: sys.sleep
+        args:
+          seconds: 0.25
+    - whole:
+        call: sys.sleep
+        args:
+          seconds: 2
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := stdlib.NewVirtualClock(start)
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterClock(clock)
+	if _, err := NewEngine(wf, funcs).Execute(context.Background(), types.Null); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if got, want := clock.Now().Sub(start), 2250*time.Millisecond; got != want {
+		t.Errorf("clock advanced by %v, want %v", got, want)
+	}
+}
+
+func TestTracerRecordsExecutionAndStepSpans(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - init:
+        assign:
+          - x: 1
+    - work:
+        steps:
+          - inner:
+              assign:
+                - x: ${x + 1}
+    - done:
+        return: ${x}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	engine.SetTracer(provider.Tracer("test"), attribute.String("gcw.execution", "exec-1"))
+	if _, err := engine.Execute(context.Background(), types.Null); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	// Spans end innermost first, so the execution span ends last
+	spans := recorder.Ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	if got, want := strings.Join(names, ","), "init,inner,work,done,execution"; got != want {
+		t.Fatalf("spans = %s, want %s", got, want)
+	}
+
+	root := spans[4]
+	if root.Parent().IsValid() {
+		t.Errorf("execution span has parent %v, want a root span", root.Parent())
+	}
+	attrs := attribute.NewSet(root.Attributes()...)
+	if v, _ := attrs.Value("gcw.execution"); v.AsString() != "exec-1" {
+		t.Errorf("execution span gcw.execution = %q, want exec-1", v.AsString())
+	}
+
+	parents := map[string]string{"init": "execution", "inner": "work", "work": "execution", "done": "execution"}
+	stepTypes := map[string]string{"init": "assign", "inner": "assign", "work": "steps", "done": "return"}
+	byID := map[string]string{}
+	for _, s := range spans {
+		byID[s.SpanContext().SpanID().String()] = s.Name()
+	}
+	for _, s := range spans[:4] {
+		if got := byID[s.Parent().SpanID().String()]; got != parents[s.Name()] {
+			t.Errorf("span %s has parent %q, want %q", s.Name(), got, parents[s.Name()])
+		}
+		attrs := attribute.NewSet(s.Attributes()...)
+		if v, _ := attrs.Value("gcw.step.name"); v.AsString() != s.Name() {
+			t.Errorf("span %s gcw.step.name = %q", s.Name(), v.AsString())
+		}
+		if v, _ := attrs.Value("gcw.step.type"); v.AsString() != stepTypes[s.Name()] {
+			t.Errorf("span %s gcw.step.type = %q, want %q", s.Name(), v.AsString(), stepTypes[s.Name()])
+		}
+		if s.EndTime().Before(s.StartTime()) {
+			t.Errorf("span %s ends before it starts", s.Name())
+		}
+	}
+}
+
+func TestTracerMarksFailedStepSpans(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - fail:
+        raise: "boom"
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	engine.SetTracer(provider.Tracer("test"))
+	if _, err := engine.Execute(context.Background(), types.Null); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	for _, s := range recorder.Ended() {
+		if s.Status().Code != codes.Error {
+			t.Errorf("span %s status = %v, want Error", s.Name(), s.Status().Code)
+		}
+	}
+}
+
+func TestCancelDuringTrySkipsCleanup(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - guarded:
+        try:
+          steps:
+            - loop:
+                for:
+                  value: i
+                  range: [1, 1000]
+                  steps:
+                    - wait:
+                        call: sys.sleep
+                        args:
+                          seconds: 0.01
+        retry:
+          max_retries: 3
+        except:
+          as: e
+          steps:
+            - handle:
+                return: "caught"
+        finally:
+          steps:
+            - cleanup:
+                assign:
+                  - done: true
+    - after:
+        return: "continued"
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	var mu sync.Mutex
+	ran := map[string]int{}
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	engine.SetStepHook(func(step string) func(error) {
+		mu.Lock()
+		ran[step]++
+		mu.Unlock()
+		return nil
+	})
+	time.AfterFunc(50*time.Millisecond, engine.Cancel)
+
+	result, err := engine.Execute(context.Background(), types.Null)
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v (result %v)", err, err, result)
+	}
+	if !we.HasTag(types.TagCancelledError) {
+		t.Errorf("expected CancelledError tag, got %v", we.Tags)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if ran["loop"] != 1 {
+		t.Errorf("try block ran %d times, want 1 (no retry after cancel)", ran["loop"])
+	}
+	for _, step := range []string{"handle", "cleanup", "after"} {
+		if ran[step] > 0 {
+			t.Errorf("step %s ran after cancel", step)
+		}
+	}
+}
+
+func TestCancelledErrorIsUncatchableBeforeContextEnds(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - guarded:
+        try:
+          steps:
+            - first:
+                assign:
+                  - x: 1
+            - second:
+                assign:
+                  - x: 2
+        retry:
+          max_retries: 3
+          backoff:
+            initial_delay: 10
+            max_delay: 60
+            multiplier: 2
+        except:
+          as: e
+          steps:
+            - handle:
+                return: "caught"
+        finally:
+          steps:
+            - cleanup:
+                assign:
+                  - done: true
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	// Mark the engine cancelled without ending its context, as Cancel does
+	// for a moment before it calls the context's cancel function
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := stdlib.NewVirtualClock(start)
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	engine.SetClock(clock)
+	var ran []string
+	engine.SetStepHook(func(step string) func(error) {
+		ran = append(ran, step)
+		if step == "first" {
+			engine.mu.Lock()
+			engine.cancelled = true
+			engine.mu.Unlock()
+		}
+		return nil
+	})
+
+	result, err := engine.Execute(context.Background(), types.Null)
+	we, ok := err.(*types.WorkflowError)
+	if !ok || !we.HasTag(types.TagCancelledError) {
+		t.Fatalf("expected CancelledError, got %v (result %v)", err, result)
+	}
+	if want := []string{"guarded", "first"}; !slices.Equal(ran, want) {
+		t.Errorf("steps run = %v, want %v", ran, want)
+	}
+	if waited := clock.Now().Sub(start); waited != 0 {
+		t.Errorf("waited %s of retry backoff after cancellation, want none", waited)
+	}
+}
+func TestExecuteDeadlineIsNotCaught(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - loop:
+        for:
+          value: i
+          range: [1, 1000]
+          steps:
+            - guarded:
+                try:
+                  call: sys.sleep
+                  args:
+                    seconds: 0.01
+                retry:
+                  max_retries: 5
+                except:
+                  as: e
+                  steps:
+                    - swallow:
+                        assign:
+                          - caught: ${e}
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = NewEngine(wf, stdlib.NewRegistry()).Execute(ctx, types.Null)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("execution took %s to stop after its deadline", elapsed)
+	}
+
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+	}
+	if !we.HasTag(types.TagTimeoutError) {
+		t.Errorf("expected TimeoutError tag, got %v", we.Tags)
+	}
+}
+
+func TestErrorRecordsStepPath(t *testing.T) {
+	err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - outer:
+        steps:
+          - loop:
+              for:
+                value: i
+                range: [1, 2]
+                steps:
+                  - call_api:
+                      call: helper
+    - unreachable:
+        return: "no"
+helper:
+  steps:
+    - divide:
+        return: ${1 / 0}
+`, types.Null)
+
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+	}
+	want := "main -> outer -> loop -> call_api -> helper -> divide"
+	if got := strings.Join(we.StepPath, " -> "); got != want {
+		t.Errorf("step path = %q, want %q", got, want)
+	}
+}
+
+func TestRetryPredicateExpressionForm(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicate string
+		want      int64
+	}{
+		{"always", "${retry.always}", 4},
+		{"never", "${retry.never}", 1},
+		{"string form", "retry.always", 4},
+		{"http default", "${http.default_retry}", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - attempts: 0
+    - flaky:
+        try:
+          steps:
+            - count:
+                assign:
+                  - attempts: ${attempts + 1}
+            - fail:
+                raise: "boom"
+        retry:
+          predicate: `+tt.predicate+`
+          max_retries: 3
+        except:
+          as: e
+          steps:
+            - swallow:
+                assign:
+                  - caught: ${e}
+    - done:
+        return: ${attempts}
+`, types.Null)
+
+			if result.AsInt() != tt.want {
+				t.Errorf("attempts = %v, want %d", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPredicateNamespacesAreNotVariables(t *testing.T) {
+	for _, expr := range []string{"${http}", "${keys(retry)}", "${retry.always}"} {
+		t.Run(expr, func(t *testing.T) {
+			err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - read:
+        return: `+expr+`
+`, types.Null)
+			we, ok := err.(*types.WorkflowError)
+			if !ok || !we.HasTag(types.TagKeyError) {
+				t.Errorf("expected KeyError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCalculateBackoffJitter(t *testing.T) {
+	backoff := &ast.BackoffExpr{InitialDelay: 2, MaxDelay: 60, Multiplier: 2}
+	engine := NewEngine(&ast.Workflow{}, stdlib.NewRegistry())
+
+	if got := engine.calculateBackoff(backoff, 1); got != 4 {
+		t.Fatalf("without jitter: delay = %v, want 4", got)
+	}
+
+	engine.SetRetryJitter(0.1, rand.NewSource(42))
+	var delays []float64
+	for attempt := 0; attempt < 5; attempt++ {
+		base := backoff.InitialDelay * math.Pow(backoff.Multiplier, float64(attempt))
+		got := engine.calculateBackoff(backoff, attempt)
+		if got < base*0.9 || got > base*1.1 {
+			t.Errorf("attempt %d: delay %v outside ±10%% of %v", attempt, got, base)
+		}
+		delays = append(delays, got)
+	}
+
+	// The same seed reproduces the same delays
+	engine.SetRetryJitter(0.1, rand.NewSource(42))
+	for attempt, want := range delays {
+		if got := engine.calculateBackoff(backoff, attempt); got != want {
+			t.Errorf("attempt %d: reseeded delay %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestRetryBackoffWaitsOnClock(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - retry_step:
+        try:
+          raise: "boom"
+        retry:
+          max_retries: 3
+          backoff:
+            initial_delay: 2
+            max_delay: 60
+            multiplier: 2
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	// waited runs wf to failure and returns how far the virtual clock moved
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	waited := func(jitter float64, src rand.Source) time.Duration {
+		clock := stdlib.NewVirtualClock(start)
+		engine := NewEngine(wf, stdlib.NewRegistry())
+		engine.SetClock(clock)
+		engine.SetRetryJitter(jitter, src)
+		if _, err := engine.Execute(context.Background(), types.Null); err == nil {
+			t.Fatal("expected the execution to fail")
+		}
+		return clock.Now().Sub(start)
+	}
+
+	// 2s + 4s + 8s before the three retries
+	if got := waited(0, nil); got != 14*time.Second {
+		t.Errorf("without jitter: waited %s, want 14s", got)
+	}
+
+	jittered := waited(0.5, rand.NewSource(7))
+	if jittered == 14*time.Second {
+		t.Error("with jitter: waited exactly 14s, want randomized delays")
+	}
+	if jittered < 7*time.Second || jittered > 21*time.Second {
+		t.Errorf("with jitter: waited %s, want within ±50%% of 14s", jittered)
+	}
+	if again := waited(0.5, rand.NewSource(7)); again != jittered {
+		t.Errorf("same seed: waited %s, want %s", again, jittered)
+	}
+}
+
+func TestRaisedHttpErrorMapIsRetried(t *testing.T) {
+	tests := []struct {
+		code int
+		want int64
+	}{
+		{503, 3},
+		{404, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.code), func(t *testing.T) {
+			result := runWorkflow(t, fmt.Sprintf(`
+main:
+  steps:
+    - init:
+        assign:
+          - attempts: 0
+    - flaky:
+        try:
+          steps:
+            - count:
+                assign:
+                  - attempts: ${attempts + 1}
+            - fail:
+                raise:
+                  code: %d
+                  message: "upstream failed"
+                  tags: ["HttpError"]
+        retry:
+          predicate: ${http.default_retry}
+          max_retries: 2
+        except:
+          as: e
+          steps:
+            - done:
+                return:
+                  attempts: ${attempts}
+                  code: ${e.code}
+                  tags: ${e.tags}
+`, tt.code), types.Null)
+
+			m := result.AsMap()
+			attempts, _ := m.Get("attempts")
+			if attempts.AsInt() != tt.want {
+				t.Errorf("attempts = %v, want %d", attempts, tt.want)
+			}
+			code, _ := m.Get("code")
+			if code.AsInt() != int64(tt.code) {
+				t.Errorf("code = %v, want %d", code, tt.code)
+			}
+			tags, _ := m.Get("tags")
+			if list := tags.AsList(); len(list) != 1 || list[0].AsString() != types.TagHttpError {
+				t.Errorf("tags = %v, want [HttpError]", tags)
+			}
+		})
+	}
+}
+
+func TestParallelForSharedMapWrites(t *testing.T) {
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%q", fmt.Sprintf("key%02d", i))
+	}
+	source := `
+main:
+  steps:
+    - init:
+        assign:
+          - shared_map: {}
+    - fill:
+        parallel:
+          shared: [shared_map]
+          for:
+            value: key
+            in: [` + strings.Join(keys, ", ") + `]
+            steps:
+              - put:
+                  assign:
+                    - shared_map[key]: ${key}
+    - done:
+        return: ${shared_map}
+`
+
+	for run := 0; run < 50; run++ {
+		result := runWorkflow(t, source, types.Null)
+		m := result.AsMap()
+		if m.Len() != len(keys) {
+			t.Fatalf("run %d: got %d keys, want %d: %v", run, m.Len(), len(keys), result)
+		}
+		for i := range keys {
+			key := fmt.Sprintf("key%02d", i)
+			if v, ok := m.Get(key); !ok || v.AsString() != key {
+				t.Fatalf("run %d: shared_map[%s] = %v, %v", run, key, v, ok)
+			}
+		}
+	}
+}
+
+func TestParallelBranchWriteRequiresShared(t *testing.T) {
+	err := runWorkflowExpectError(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - total: 0
+          - status: "pending"
+    - fan_out:
+        parallel:
+          shared: [total]
+          branches:
+            - b1:
+                steps:
+                  - add:
+                      assign:
+                        - total: ${total + 1}
+            - b2:
+                steps:
+                  - mark:
+                      assign:
+                        - status: "done"
+`, types.Null)
+
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+	}
+	if !strings.Contains(we.Message, "'status'") || !strings.Contains(we.Message, "shared") {
+		t.Errorf("expected error naming the un-shared variable, got %q", we.Message)
+	}
+}
+
+func TestParallelBranchLocalVariables(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - results: []
+    - fan_out:
+        parallel:
+          shared: [results]
+          branches:
+            - b1:
+                steps:
+                  - work:
+                      assign:
+                        - scratch: 1
+                        - results: ${list.concat(results, scratch)}
+    - done:
+        return: ${results}
+`, types.Null)
+
+	// Branch-local variables need not be shared
+	if list := result.AsList(); len(list) != 1 || list[0].AsInt() != 1 {
+		t.Errorf("results = %v, want [1]", result)
+	}
+}
+
+func TestAssignCrossReferencesEarlierAssignments(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - init:
+        assign:
+          - a: 1
+          - b: ${a + 1}
+          - a: ${b * 10}
+    - done:
+        return: ${[a, b]}
+`, types.Null)
+
+	list := result.AsList()
+	if len(list) != 2 || list[0].AsInt() != 20 || list[1].AsInt() != 2 {
+		t.Errorf("result = %v, want [20, 2]", result)
+	}
+}
+
+func TestParallelForAssignStepIsAtomic(t *testing.T) {
+	source := `
+main:
+  steps:
+    - init:
+        assign:
+          - counter: 0
+    - fan_out:
+        parallel:
+          shared: [counter]
+          for:
+            value: i
+            in: [` + strings.Repeat("0, ", 19) + `0]
+            steps:
+              - bump:
+                  assign:
+                    - local: ${counter}
+                    - counter: ${local + 1}
+    - done:
+        return: ${counter}
+`
+
+	// The whole assign step holds the shared-variable lock, so the read of
+	// counter and the write that depends on it cannot interleave
+	for run := 0; run < 50; run++ {
+		if result := runWorkflow(t, source, types.Null); result.AsInt() != 20 {
+			t.Fatalf("run %d: counter = %v, want 20", run, result)
+		}
+	}
+}
+
+func TestParallelConcurrencyLimitIsBounded(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - fan_out:
+        parallel:
+          concurrency_limit: 2
+          for:
+            value: item
+            in: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]
+            steps:
+              - work:
+                  call: sys.sleep
+                  args:
+                    seconds: 0.02
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	if _, err := engine.Execute(context.Background(), types.Null); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if peak := engine.PeakParallelism(); peak < 1 || peak > 2 {
+		t.Errorf("peak parallelism = %d, want between 1 and 2 (the concurrency limit)", peak)
+	}
+}
+
+func TestParallelSleepReleasesSlotsInWaves(t *testing.T) {
+	branch := func(name string) string {
+		return `
+            - ` + name + `:
+                steps:
+                  - nap:
+                      call: sys.sleep
+                      args:
+                        seconds: 0.05`
+	}
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - fan_out:
+        parallel:
+          concurrency_limit: 2
+          branches:` + branch("b1") + branch("b2") + branch("b3") + branch("b4") + `
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	// Count sleeps in flight rather than timing them: a third sleep may only
+	// start once an earlier one has finished and released its slot
+	var mu sync.Mutex
+	var active, started, finished, peak int
+	engine := NewEngine(wf, stdlib.NewRegistry())
+	engine.SetStepHook(func(step string) func(error) {
+		if step != "nap" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if started >= 2 && finished == 0 {
+			t.Errorf("sleep %d started before any earlier sleep finished", started+1)
+		}
+		started++
+		active++
+		peak = max(peak, active)
+		return func(error) {
+			mu.Lock()
+			defer mu.Unlock()
+			active--
+			finished++
+		}
+	})
+	if _, err := engine.Execute(context.Background(), types.Null); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if finished != 4 {
+		t.Errorf("%d sleeps finished, want 4", finished)
+	}
+	if peak > 2 {
+		t.Errorf("%d sleeps ran at once, want at most 2 (the concurrency limit)", peak)
+	}
+}
+
+// TestCallLoopHitsStepLimit checks that every call step counts toward
+// MaxStepsPerExecution, so a runaway loop of HTTP calls is stopped.
+func TestCallLoopHitsStepLimit(t *testing.T) {
+	wf, err := parser.Parse([]byte(`
+main:
+  steps:
+    - poll:
+        call: http.get
+        args:
+          url: https://api.example.com/status
+        next: poll
+`))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	var calls int
+	mock := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       io.NopCloser(strings.NewReader("pending")),
+			Request:    r,
+		}, nil
+	})
+
+	funcs := stdlib.NewRegistry()
+	funcs.RegisterHTTP(&http.Client{Transport: mock})
+	_, err = NewEngine(wf, funcs).Execute(context.Background(), types.Null)
+	if err == nil {
+		t.Fatal("expected the step limit to stop the loop")
+	}
+	we, ok := err.(*types.WorkflowError)
+	if !ok {
+		t.Fatalf("expected WorkflowError, got %T: %v", err, err)
+	}
+	if !we.HasTag(types.TagResourceLimitError) {
+		t.Errorf("expected ResourceLimitError tag, got %v", we.Tags)
+	}
+	if calls != MaxStepsPerExecution {
+		t.Errorf("made %d calls, want %d", calls, MaxStepsPerExecution)
+	}
+}
+
+func TestMapLiteralKeysInOrder(t *testing.T) {
+	result := runWorkflow(t, `
+main:
+  steps:
+    - done:
+        return: '${keys({"z": 1, "a": 2})}'
+`, types.Null)
+
+	want := types.NewList([]types.Value{types.NewString("z"), types.NewString("a")})
+	if !result.Equal(want) {
+		t.Errorf("got %v, want %v", result, want)
+	}
+}
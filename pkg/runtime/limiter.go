@@ -0,0 +1,89 @@
+package runtime
+
+import "sync"
+
+// DefaultMaxConcurrentExecutions is the default number of executions that may
+// run at the same time before new executions are queued.
+const DefaultMaxConcurrentExecutions = 100
+
+// ExecutionLimiter bounds the number of concurrently running executions.
+// Executions waiting for a slot are granted one in the order they joined the
+// queue. A single limiter can be shared by several API servers so the bound
+// applies across all of them.
+type ExecutionLimiter struct {
+	mu      sync.Mutex
+	max     int             // 0 = no limit
+	running int             // slots taken
+	waiters []chan struct{} // queued waiters, oldest first
+}
+
+// NewExecutionLimiter creates a limiter allowing up to max concurrent
+// executions. A max of zero or less means no limit.
+func NewExecutionLimiter(max int) *ExecutionLimiter {
+	if max < 0 {
+		max = 0
+	}
+	return &ExecutionLimiter{max: max}
+}
+
+// TryAcquire takes a slot if one is free and nobody is queued for it, and
+// reports whether it did.
+func (l *ExecutionLimiter) TryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.free() {
+		return false
+	}
+	l.running++
+	return true
+}
+
+// Enqueue joins the queue for a slot and returns a channel that is closed
+// once the slot has been granted. Slots are granted in the order Enqueue was
+// called.
+func (l *ExecutionLimiter) Enqueue() <-chan struct{} {
+	ready := make(chan struct{})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.free() {
+		l.running++
+		close(ready)
+	} else {
+		l.waiters = append(l.waiters, ready)
+	}
+	return ready
+}
+
+// Acquire blocks until a slot is granted, queueing behind earlier waiters.
+func (l *ExecutionLimiter) Acquire() {
+	<-l.Enqueue()
+}
+
+// Release frees a slot taken by TryAcquire, Enqueue or Acquire. If anyone is
+// queued, the slot passes straight to the oldest waiter.
+func (l *ExecutionLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.waiters) > 0 {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		return
+	}
+	if l.running > 0 {
+		l.running--
+	}
+}
+
+// Running returns the number of slots currently taken.
+func (l *ExecutionLimiter) Running() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
+
+// free reports whether a new execution may take a slot without queueing. The
+// caller must hold l.mu.
+func (l *ExecutionLimiter) free() bool {
+	return l.max == 0 || (l.running < l.max && len(l.waiters) == 0)
+}
@@ -0,0 +1,42 @@
+package runtime
+
+import "testing"
+
+func TestExecutionLimiterGrantsSlotsInOrder(t *testing.T) {
+	l := NewExecutionLimiter(1)
+	if !l.TryAcquire() {
+		t.Fatal("first TryAcquire failed on an idle limiter")
+	}
+
+	var waiters []<-chan struct{}
+	for i := 0; i < 5; i++ {
+		waiters = append(waiters, l.Enqueue())
+	}
+	if l.TryAcquire() {
+		t.Fatal("TryAcquire jumped the queue")
+	}
+
+	for i := range waiters {
+		l.Release()
+		for j, ready := range waiters {
+			select {
+			case <-ready:
+				if j > i {
+					t.Fatalf("release %d granted waiter %d before waiter %d", i, j, i)
+				}
+			default:
+				if j <= i {
+					t.Fatalf("release %d did not grant waiter %d", i, j)
+				}
+			}
+		}
+		if n := l.Running(); n != 1 {
+			t.Fatalf("running = %d after release %d, want 1", n, i)
+		}
+	}
+
+	l.Release()
+	if n := l.Running(); n != 0 {
+		t.Errorf("running = %d after the last release, want 0", n)
+	}
+}
@@ -3,6 +3,7 @@ package runtime
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -18,6 +19,10 @@ type VariableScope struct {
 	vars      map[string]types.Value
 	mu        sync.RWMutex
 	sharedMu  *sync.Mutex // shared mutex for parallel execution atomicity
+
+	// shared is set on the root scope of a parallel branch or iteration and
+	// lists the parent variables it may assign. It is nil on other scopes.
+	shared map[string]bool
 }
 
 // NewScope creates a new root scope.
@@ -129,6 +134,29 @@ func (s *VariableScope) setInParent(name string, value types.Value) {
 	s.parent.setInParent(name, value)
 }
 
+// CheckWritable returns an error if assigning name from this scope would write
+// a variable of an enclosing scope across a parallel branch boundary without
+// that variable being listed in the parallel step's shared variables.
+func (s *VariableScope) CheckWritable(name string) error {
+	for cur := s; cur != nil; cur = cur.parent {
+		cur.mu.RLock()
+		_, ok := cur.vars[name]
+		cur.mu.RUnlock()
+		if ok {
+			return nil
+		}
+		if cur.shared == nil || cur.shared[name] {
+			continue
+		}
+		if cur.parent != nil && cur.parent.Exists(name) {
+			return types.NewValueError(fmt.Sprintf(
+				"variable '%s' is assigned in a parallel branch but is not declared in 'shared'", name))
+		}
+		return nil
+	}
+	return nil
+}
+
 // Exists checks if a variable exists in this scope or any parent.
 func (s *VariableScope) Exists(name string) bool {
 	s.mu.RLock()
@@ -184,18 +212,35 @@ func EvalValue(v interface{}, scope *VariableScope, funcs FunctionRegistry) (typ
 	return expr.Evaluate(node, adapter)
 }
 
-// SetByPath sets a value by dotted/index path (e.g., "obj.key", "list[0]").
-func SetByPath(scope *VariableScope, path string, value types.Value) error {
+// SetByPath sets a value by dotted/index path (e.g., "obj.key", "list[0]",
+// "obj[key]"). Unquoted, non-numeric indexes are expressions evaluated in
+// scope, so a string result selects a map key and an integer a list index.
+// Missing map keys along the path are created as empty maps, as in GCW, but
+// lists are never extended: an index out of range is an IndexError. A failed
+// assignment leaves the variable as it was.
+func SetByPath(scope *VariableScope, path string, value types.Value, funcs FunctionRegistry) error {
 	parts := parseAssignmentPath(path)
 	if len(parts) == 0 {
 		return fmt.Errorf("empty assignment path")
 	}
 
+	if err := scope.CheckWritable(parts[0].name); err != nil {
+		return err
+	}
+
 	if len(parts) == 1 {
 		scope.Set(parts[0].name, value)
 		return nil
 	}
 
+	for i := 1; i < len(parts); i++ {
+		resolved, err := resolvePart(parts[i], scope, funcs)
+		if err != nil {
+			return err
+		}
+		parts[i] = resolved
+	}
+
 	// Get the root variable
 	rootName := parts[0].name
 	root, err := scope.Get(rootName)
@@ -203,19 +248,34 @@ func SetByPath(scope *VariableScope, path string, value types.Value) error {
 		return err
 	}
 
-	// Navigate to the parent of the target and set the value
+	// Navigate to the parent of the target and set the value. If the
+	// assignment fails, the first map created along the way is removed again
+	// so no partial path is left behind; any later ones hang off it.
 	current := root
+	var undo func()
 	for i := 1; i < len(parts)-1; i++ {
+		if next, ok := vivifyPart(current, parts[i], parts[i+1]); ok {
+			if undo == nil {
+				m, key := current.AsMap(), parts[i].name
+				undo = func() { m.Delete(key) }
+			}
+			current = next
+			continue
+		}
 		current, err = accessPart(current, parts[i])
 		if err != nil {
-			return err
+			break
 		}
 	}
 
 	// Set the final value
-	last := parts[len(parts)-1]
-	err = setPart(current, last, value)
+	if err == nil {
+		err = setPart(current, parts[len(parts)-1], value)
+	}
 	if err != nil {
+		if undo != nil {
+			undo()
+		}
 		return err
 	}
 
@@ -228,6 +288,7 @@ type pathPart struct {
 	name    string // property name
 	index   int    // array index (only used if isIndex is true)
 	isIndex bool
+	expr    string // index expression still to be evaluated, e.g. a variable name
 }
 
 func parseAssignmentPath(path string) []pathPart {
@@ -241,16 +302,17 @@ func parseAssignmentPath(path string) []pathPart {
 			if j == -1 {
 				break
 			}
-			indexStr := path[i+1 : i+j]
+			indexStr := strings.TrimSpace(path[i+1 : i+j])
 			// Check if it's a string key (quoted)
 			if len(indexStr) >= 2 && (indexStr[0] == '"' && indexStr[len(indexStr)-1] == '"') {
 				// String key access like data["phone"]
 				keyName := indexStr[1 : len(indexStr)-1]
 				parts = append(parts, pathPart{name: keyName})
-			} else {
-				var idx int
-				fmt.Sscanf(indexStr, "%d", &idx)
+			} else if idx, err := strconv.Atoi(indexStr); err == nil {
 				parts = append(parts, pathPart{index: idx, isIndex: true})
+			} else {
+				// Computed key or index like data[key]
+				parts = append(parts, pathPart{expr: indexStr})
 			}
 			i += j + 1
 			if i < len(path) && path[i] == '.' {
@@ -273,6 +335,27 @@ func parseAssignmentPath(path string) []pathPart {
 	return parts
 }
 
+// resolvePart evaluates a computed index expression into a map key or list
+// index. Parts without an expression are returned unchanged.
+func resolvePart(p pathPart, scope *VariableScope, funcs FunctionRegistry) (pathPart, error) {
+	if p.expr == "" {
+		return p, nil
+	}
+	v, err := EvalValue("${"+p.expr+"}", scope, funcs)
+	if err != nil {
+		return p, err
+	}
+	switch v.Type() {
+	case types.TypeString:
+		return pathPart{name: v.AsString()}, nil
+	case types.TypeInt:
+		return pathPart{index: int(v.AsInt()), isIndex: true}, nil
+	default:
+		return p, types.NewTypeError(
+			fmt.Sprintf("assignment index '%s' must be a string or int, got %s", p.expr, v.Type()))
+	}
+}
+
 func accessPart(v types.Value, p pathPart) (types.Value, error) {
 	if p.isIndex {
 		if v.Type() != types.TypeList {
@@ -281,7 +364,7 @@ func accessPart(v types.Value, p pathPart) (types.Value, error) {
 		list := v.AsList()
 		if p.index < 0 || p.index >= len(list) {
 			return types.Null, types.NewIndexError(
-				fmt.Sprintf("index %d out of range (length %d)", p.index, len(list)))
+				fmt.Sprintf("list index %d out of range (length %d)", p.index, len(list)))
 		}
 		return list[p.index], nil
 	}
@@ -298,15 +381,33 @@ func accessPart(v types.Value, p pathPart) (types.Value, error) {
 	return val, nil
 }
 
+// vivifyPart creates the missing map key p.name in v as an empty map when the
+// next path part is another key, and returns the new map. It reports false,
+// leaving v unchanged, when v is not a map, the key exists, or next is a list
+// index (an index into a list that does not exist yet cannot be satisfied).
+func vivifyPart(v types.Value, p, next pathPart) (types.Value, bool) {
+	if p.isIndex || next.isIndex || v.Type() != types.TypeMap {
+		return types.Null, false
+	}
+	m := v.AsMap()
+	if _, ok := m.Get(p.name); ok {
+		return types.Null, false
+	}
+	child := types.NewMap(types.NewOrderedMap())
+	m.Set(p.name, child)
+	return child, true
+}
+
 func setPart(v types.Value, p pathPart, value types.Value) error {
 	if p.isIndex {
 		if v.Type() != types.TypeList {
 			return types.NewTypeError("index assignment on non-list")
 		}
 		list := v.AsList()
+		// As in expressions, negative indices are not supported
 		if p.index < 0 || p.index >= len(list) {
 			return types.NewIndexError(
-				fmt.Sprintf("index %d out of range (length %d)", p.index, len(list)))
+				fmt.Sprintf("list index %d out of range (length %d)", p.index, len(list)))
 		}
 		list[p.index] = value
 		return nil
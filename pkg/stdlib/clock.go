@@ -0,0 +1,109 @@
+package stdlib
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// Clock is the time source for sys.now, sys.sleep and sys.sleep_until.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// MaxRealSleep is the longest the default clock actually pauses for a single
+// sleep, so that workflows with long sleeps still run quickly.
+const MaxRealSleep = time.Second
+
+// emulatorClock is the default Clock: it reads the wall clock and caps every
+// sleep at MaxRealSleep.
+type emulatorClock struct{}
+
+func (emulatorClock) Now() time.Time { return time.Now() }
+
+func (emulatorClock) Sleep(d time.Duration) {
+	if d > MaxRealSleep {
+		d = MaxRealSleep
+	}
+	time.Sleep(d)
+}
+
+// VirtualClock is a Clock for deterministic runs. Sleeps return immediately
+// and advance its logical time by the full duration instead, so a workflow
+// that sleeps for an hour finishes at once but sees sys.now() move by an
+// hour. It is safe for concurrent use. Parallel branches each keep their own
+// time (see Registry.Branch), so their sleeps overlap rather than add up.
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewVirtualClock returns a VirtualClock whose logical time starts at start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now returns the logical time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep advances the logical time by d without blocking.
+func (c *VirtualClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// fork returns a clock for a parallel branch, starting at c's time.
+func (c *VirtualClock) fork() *VirtualClock {
+	return NewVirtualClock(c.Now())
+}
+
+// advanceTo moves the logical time on to t, if t is later.
+func (c *VirtualClock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	if t.After(c.now) {
+		c.now = t
+	}
+	c.mu.Unlock()
+}
+
+// RegisterClock makes sys.now, sys.sleep and sys.sleep_until use c instead
+// of the default wall clock.
+func (r *Registry) RegisterClock(c Clock) {
+	r.clock = c
+	r.Register("sys.now", sysNow(c))
+	r.Register("sys.sleep", sysSleep(c))
+	r.Register("sys.sleep_until", sysSleepUntil(c))
+}
+
+// Clock returns the clock behind sys.now, sys.sleep and sys.sleep_until, so
+// that other waits in the same execution can share it.
+func (r *Registry) Clock() Clock {
+	return r.clock
+}
+
+// Branch returns the registry for one parallel branch and a function to call
+// once the branch has finished. Under a VirtualClock the branch keeps its own
+// time, starting from the current time, and finishing moves r's time on to
+// the branch's if that is later. The parallel step thus ends at the time of
+// its longest branch, as it would on the wall clock. Other clocks need no
+// separate time, and the branch shares r.
+func (r *Registry) Branch() (*Registry, func()) {
+	vc, ok := r.clock.(*VirtualClock)
+	if !ok {
+		return r, func() {}
+	}
+
+	branch := &Registry{funcs: maps.Clone(r.funcs)}
+	bc := vc.fork()
+	branch.RegisterClock(bc)
+	return branch, func() { vc.advanceTo(bc.Now()) }
+}
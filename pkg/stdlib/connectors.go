@@ -0,0 +1,58 @@
+package stdlib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+)
+
+// ConnectorPrefix is the name prefix of GCW connector calls, e.g.
+// googleapis.storage.v1.objects.get.
+const ConnectorPrefix = "googleapis."
+
+// ConnectorMocks maps connector method names to the canned response each
+// call returns.
+type ConnectorMocks map[string]types.Value
+
+// LoadConnectorMocks reads connector mocks from a JSON file holding an object
+// that maps connector method names to their responses:
+//
+//	{"googleapis.storage.v1.objects.get": {"name": "report.csv", "size": "1024"}}
+func LoadConnectorMocks(path string) (ConnectorMocks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading connector mocks: %w", err)
+	}
+	v, err := types.ParseJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connector mocks %s: %w", path, err)
+	}
+	if v.Type() != types.TypeMap {
+		return nil, fmt.Errorf("connector mocks %s: expected a JSON object, got %s", path, v.Type())
+	}
+
+	mocks := make(ConnectorMocks)
+	for _, name := range v.AsMap().Keys() {
+		if !strings.HasPrefix(name, ConnectorPrefix) {
+			return nil, fmt.Errorf("connector mocks %s: %q is not a connector method (must start with %q)",
+				path, name, ConnectorPrefix)
+		}
+		mocks[name], _ = v.AsMap().Get(name)
+	}
+	return mocks, nil
+}
+
+// RegisterConnectorMocks registers each mocked connector method as a function
+// returning its canned response. Call arguments are ignored. Connector calls
+// without a mock fail with an error naming the missing method.
+func (r *Registry) RegisterConnectorMocks(mocks ConnectorMocks) {
+	for name, resp := range mocks {
+		r.Register(name, func(args []types.Value) (types.Value, error) {
+			// Each call gets its own copy so a workflow mutating the
+			// response cannot leak into later calls
+			return resp.Clone(), nil
+		})
+	}
+}
@@ -9,11 +9,14 @@ import (
 )
 
 // registerExpressionHelpers registers built-in expression helper functions:
-// default, keys, len, type, int, double, string, bool.
+// clone, default, if, keys, len, get, type, int, double, string, bool.
 func (r *Registry) registerExpressionHelpers() {
+	r.Register("clone", stdClone)
 	r.Register("default", stdDefault)
+	r.Register("if", stdIf)
 	r.Register("keys", stdKeys)
 	r.Register("len", stdLen)
+	r.Register("get", mapGet) // bare alias for map.get; an extension, see IsExtension
 	r.Register("type", stdType)
 	r.Register("int", stdInt)
 	r.Register("double", stdDouble)
@@ -21,6 +24,13 @@ func (r *Registry) registerExpressionHelpers() {
 	r.Register("bool", stdBool)
 }
 
+func stdClone(args []types.Value) (types.Value, error) {
+	if err := requireArgs("clone", args, 1, 1); err != nil {
+		return types.Null, err
+	}
+	return args[0].Clone(), nil
+}
+
 func stdDefault(args []types.Value) (types.Value, error) {
 	if err := requireArgs("default", args, 2, 2); err != nil {
 		return types.Null, err
@@ -31,6 +41,23 @@ func stdDefault(args []types.Value) (types.Value, error) {
 	return args[0], nil
 }
 
+// stdIf is the eager form of if(), used when it is called from a call step.
+// In expressions the evaluator handles if() itself so that only the selected
+// branch is evaluated.
+func stdIf(args []types.Value) (types.Value, error) {
+	if err := requireArgs("if", args, 3, 3); err != nil {
+		return types.Null, err
+	}
+	if args[0].Type() != types.TypeBool {
+		return types.Null, types.NewTypeError(
+			fmt.Sprintf("if() condition must be a bool, got %s", args[0].Type()))
+	}
+	if args[0].AsBool() {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
 func stdKeys(args []types.Value) (types.Value, error) {
 	if err := requireArgs("keys", args, 1, 1); err != nil {
 		return types.Null, err
@@ -2,10 +2,14 @@ package stdlib
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -23,13 +27,20 @@ const DefaultHTTPTimeout = 1800 * time.Second
 // RegisterHTTP registers http.* functions. This is separate because it may need
 // a custom HTTP client for testing.
 func (r *Registry) RegisterHTTP(client *http.Client) {
+	r.RegisterHTTPWithBaseURL(client, "")
+}
+
+// RegisterHTTPWithBaseURL registers http.* functions that resolve relative
+// request URLs (e.g. "/users/1") against baseURL. Absolute URLs bypass the base.
+// An empty baseURL leaves relative URLs untouched.
+func (r *Registry) RegisterHTTPWithBaseURL(client *http.Client, baseURL string) {
 	if client == nil {
 		client = &http.Client{Timeout: DefaultHTTPTimeout}
 	}
 
 	doRequest := func(method string) StdlibFunc {
 		return func(args []types.Value) (types.Value, error) {
-			return httpDoRequest(client, method, args)
+			return httpDoRequest(client, baseURL, method, args)
 		}
 	}
 
@@ -46,18 +57,111 @@ func (r *Registry) RegisterHTTP(client *http.Client) {
 				method = strings.ToUpper(m.AsString())
 			}
 		}
-		return httpDoRequest(client, method, args)
+		return httpDoRequest(client, baseURL, method, args)
+	})
+	r.Register("http.get_paginated", func(args []types.Value) (types.Value, error) {
+		return httpGetPaginated(client, baseURL, args)
 	})
 }
 
-func httpDoRequest(client *http.Client, method string, args []types.Value) (types.Value, error) {
+// MaxPaginatedPages bounds the number of pages http.get_paginated follows,
+// so a service that always returns a next link cannot loop forever.
+const MaxPaginatedPages = 1000
+
+// httpGetPaginated implements http.get_paginated(url, next_field, items_field).
+// It GETs url, appends the list in the response body's items_field to the
+// result, and follows the link in next_field until it is missing, null or
+// empty. Relative next links resolve against the page they came from. The
+// arguments may also be passed as a map, which may carry headers and query
+// like http.get; query applies to the first page only.
+func httpGetPaginated(client *http.Client, baseURL string, args []types.Value) (types.Value, error) {
+	var request *types.OrderedMap
+	var nextField, itemsField string
+	switch {
+	case len(args) == 1 && args[0].Type() == types.TypeMap:
+		request = args[0].AsMap().Clone()
+		nf, _ := request.Get("next_field")
+		itf, _ := request.Get("items_field")
+		if nf.Type() != types.TypeString || itf.Type() != types.TypeString {
+			return types.Null, types.NewTypeError("http.get_paginated: next_field and items_field must be strings")
+		}
+		nextField, itemsField = nf.AsString(), itf.AsString()
+		request.Delete("next_field")
+		request.Delete("items_field")
+	case len(args) == 3:
+		for _, a := range args {
+			if a.Type() != types.TypeString {
+				return types.Null, types.NewTypeError(
+					fmt.Sprintf("http.get_paginated: arguments must be strings, got %s", a.Type()))
+			}
+		}
+		request = types.NewOrderedMap()
+		request.Set("url", args[0])
+		nextField, itemsField = args[1].AsString(), args[2].AsString()
+	default:
+		return types.Null, fmt.Errorf("http.get_paginated expects (url, next_field, items_field)")
+	}
+
+	var items []types.Value
+	for page := 0; ; page++ {
+		if page == MaxPaginatedPages {
+			return types.Null, types.NewResourceLimitError(
+				fmt.Sprintf("http.get_paginated: more than %d pages", MaxPaginatedPages))
+		}
+
+		resp, err := httpDoRequest(client, baseURL, "GET", []types.Value{types.NewMap(request)})
+		if err != nil {
+			return types.Null, err
+		}
+		body, _ := resp.AsMap().Get("body")
+		if body.Type() != types.TypeMap {
+			return types.Null, types.NewTypeError(
+				fmt.Sprintf("http.get_paginated: response body must be a map, got %s", body.Type()))
+		}
+
+		if list, ok := body.AsMap().Get(itemsField); ok && !list.IsNull() {
+			if list.Type() != types.TypeList {
+				return types.Null, types.NewTypeError(
+					fmt.Sprintf("http.get_paginated: %s must be a list, got %s", itemsField, list.Type()))
+			}
+			items = append(items, list.AsList()...)
+		}
+
+		next, ok := body.AsMap().Get(nextField)
+		if !ok || next.IsNull() || (next.Type() == types.TypeString && next.AsString() == "") {
+			break
+		}
+		if next.Type() != types.TypeString {
+			return types.Null, types.NewTypeError(
+				fmt.Sprintf("http.get_paginated: %s must be a string, got %s", nextField, next.Type()))
+		}
+
+		current, _ := request.Get("url")
+		nextURL := next.AsString()
+		if u, err := url.Parse(resolveBaseURL(baseURL, current.AsString())); err == nil {
+			if ref, err := url.Parse(nextURL); err == nil {
+				nextURL = u.ResolveReference(ref).String()
+			}
+		}
+		request.Set("url", types.NewString(nextURL))
+		// The next link carries its own query
+		request.Delete("query")
+	}
+
+	if items == nil {
+		items = []types.Value{}
+	}
+	return types.NewList(items), nil
+}
+
+func httpDoRequest(client *http.Client, baseURL, method string, args []types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Null, fmt.Errorf("http.%s requires arguments", strings.ToLower(method))
 	}
 
 	var (
 		requestURL string
-		body       io.Reader
+		body       []byte
 		headers    map[string]string
 		query      map[string]string
 		timeout    time.Duration
@@ -75,6 +179,7 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 	} else {
 		return types.Null, fmt.Errorf("http.%s: missing 'url' argument", strings.ToLower(method))
 	}
+	requestURL = resolveBaseURL(baseURL, requestURL)
 
 	// Headers
 	if h, ok := m.Get("headers"); ok && h.Type() == types.TypeMap {
@@ -98,13 +203,13 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 	if b, ok := m.Get("body"); ok {
 		switch b.Type() {
 		case types.TypeString:
-			body = strings.NewReader(b.AsString())
+			body = []byte(b.AsString())
 		case types.TypeMap, types.TypeList:
 			jsonBytes, err := b.MarshalJSON()
 			if err != nil {
 				return types.Null, fmt.Errorf("http.%s: failed to marshal body: %v", strings.ToLower(method), err)
 			}
-			body = bytes.NewReader(jsonBytes)
+			body = jsonBytes
 			if headers == nil {
 				headers = make(map[string]string)
 			}
@@ -112,8 +217,21 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 				headers["Content-Type"] = "application/json"
 			}
 		default:
-			body = strings.NewReader(b.String())
+			body = []byte(b.String())
+		}
+	}
+
+	// Compression
+	if c, ok := m.Get("compress"); ok && c.Truthy() && body != nil {
+		compressed, err := gzipBytes(body)
+		if err != nil {
+			return types.Null, fmt.Errorf("http.%s: failed to compress body: %v", strings.ToLower(method), err)
+		}
+		body = compressed
+		if headers == nil {
+			headers = make(map[string]string)
 		}
+		headers["Content-Encoding"] = "gzip"
 	}
 
 	// Timeout
@@ -142,7 +260,11 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bodyReader)
 	if err != nil {
 		return types.Null, types.NewConnectionError(
 			fmt.Sprintf("failed to create request: %v", err))
@@ -153,6 +275,15 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 		req.Header.Set(k, v)
 	}
 
+	// Request signing. Other auth types (OIDC, OAuth2) are accepted but not enforced.
+	if a, ok := m.Get("auth"); ok && a.Type() == types.TypeMap {
+		if t, ok := a.AsMap().Get("type"); ok && strings.EqualFold(t.AsString(), "hmac") {
+			if err := signHMAC(req, body, a.AsMap()); err != nil {
+				return types.Null, err
+			}
+		}
+	}
+
 	// Execute request
 	resp, err := client.Do(req)
 	if err != nil {
@@ -165,8 +296,22 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 	}
 	defer resp.Body.Close()
 
-	// Read response body (with size limit)
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, MaxHTTPResponseSize+1))
+	// Read response body (with size limit). Gzip bodies the transport did not
+	// decode itself, e.g. because the request set Accept-Encoding, are
+	// decoded here; the limit applies to the decoded size.
+	var respReader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return types.Null, types.NewConnectionError(
+				fmt.Sprintf("failed to decode gzip response: %v", err))
+		}
+		defer gz.Close()
+		respReader = gz
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+	}
+	respBody, err := io.ReadAll(io.LimitReader(respReader, MaxHTTPResponseSize+1))
 	if err != nil {
 		return types.Null, types.NewConnectionError(
 			fmt.Sprintf("failed to read response: %v", err))
@@ -208,14 +353,103 @@ func httpDoRequest(client *http.Client, method string, args []types.Value) (type
 	return types.NewMap(result), nil
 }
 
-// parseResponseBody tries to parse the response body as JSON, falling back to string.
+// gzipBytes returns data gzip-compressed.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DefaultHMACHeader is the header that carries the signature for
+// auth type "hmac" when no headerName is given.
+const DefaultHMACHeader = "X-Signature"
+
+// signHMAC signs req for auth type "hmac". The signature is the lowercase hex
+// HMAC (algorithm defaults to SHA256) of the canonical request:
+//
+//	METHOD + "\n" + PATH + "\n" + BODY
+//
+// where METHOD is the upper-case HTTP method, PATH is the escaped URL path
+// followed by "?" and the raw query string when a query is present, and BODY
+// is the exact request body bytes (empty when there is no body).
+func signHMAC(req *http.Request, body []byte, auth *types.OrderedMap) error {
+	keyVal, ok := auth.Get("key")
+	if !ok || keyVal.IsNull() {
+		return types.NewValueError("hmac auth requires a 'key'")
+	}
+
+	algorithm := "SHA256"
+	if v, ok := auth.Get("algorithm"); ok && v.Type() == types.TypeString {
+		algorithm = strings.ToUpper(v.AsString())
+	}
+	hashFunc, err := hashFactory(algorithm)
+	if err != nil {
+		return err
+	}
+
+	headerName := DefaultHMACHeader
+	if v, ok := auth.Get("headerName"); ok && v.Type() == types.TypeString && v.AsString() != "" {
+		headerName = v.AsString()
+	}
+
+	mac := hmac.New(hashFunc, toBytes(keyVal))
+	mac.Write([]byte(canonicalRequest(req.Method, req.URL, body)))
+	req.Header.Set(headerName, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// canonicalRequest builds the string signed by signHMAC.
+func canonicalRequest(method string, u *url.URL, body []byte) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return strings.ToUpper(method) + "\n" + path + "\n" + string(body)
+}
+
+// resolveBaseURL prefixes a relative request URL with baseURL. URLs that carry
+// a scheme or host are returned as-is, as is everything when baseURL is empty.
+func resolveBaseURL(baseURL, requestURL string) string {
+	if baseURL == "" {
+		return requestURL
+	}
+	if u, err := url.Parse(requestURL); err != nil || u.IsAbs() || u.Host != "" {
+		return requestURL
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(requestURL, "/")
+}
+
+// parseResponseBody converts a response body to a value based on its content
+// type: JSON is parsed, text is returned as a string, and any other content
+// type (e.g. image/png, application/octet-stream) is returned as bytes. Text
+// and untyped bodies that look like JSON are still parsed as JSON.
 func parseResponseBody(body []byte, contentType string) types.Value {
 	if len(body) == 0 {
 		return types.Null
 	}
 
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	isJSON := strings.Contains(mediaType, "json")
+	isText := mediaType == "" || strings.HasPrefix(mediaType, "text/")
+
+	if !isJSON && !isText {
+		return types.NewBytes(body)
+	}
+
 	// Try JSON parsing if content type suggests it or body looks like JSON
-	if strings.Contains(contentType, "json") || isJSONLike(body) {
+	if isJSON || isJSONLike(body) {
 		var raw interface{}
 		if err := json.Unmarshal(body, &raw); err == nil {
 			return types.ValueFromJSON(raw)
@@ -0,0 +1,162 @@
+package stdlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPMock is a canned response for http.* requests matching a method and URL
+// pattern.
+type HTTPMock struct {
+	// Method is the HTTP method to match, e.g. GET. Empty matches any method.
+	Method string `yaml:"method"`
+
+	// URL is the request URL to match. Each * matches any run of characters,
+	// including slashes. The query string is ignored unless the pattern has one.
+	URL string `yaml:"url"`
+
+	// Response is returned for matching requests.
+	Response HTTPMockResponse `yaml:"response"`
+}
+
+// HTTPMockResponse is the response served for a matched HTTPMock.
+type HTTPMockResponse struct {
+	// Status is the HTTP status code. Zero means 200.
+	Status int `yaml:"status"`
+
+	// Headers are the response headers.
+	Headers map[string]string `yaml:"headers"`
+
+	// Body is the response body. Strings are sent as-is; any other value is
+	// encoded as JSON, with Content-Type application/json unless set in
+	// Headers.
+	Body interface{} `yaml:"body"`
+}
+
+// HTTPMocks is an ordered list of mocks; the first match wins.
+type HTTPMocks []HTTPMock
+
+// LoadHTTPMocks reads HTTP mocks from a YAML (or JSON) file holding a list of
+// mocks:
+//
+//   - method: GET
+//     url: https://api.example.com/users/*
+//     response:
+//     status: 200
+//     body: {"name": "Alice"}
+func LoadHTTPMocks(path string) (HTTPMocks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading HTTP mocks: %w", err)
+	}
+	var mocks HTTPMocks
+	if err := yaml.Unmarshal(data, &mocks); err != nil {
+		return nil, fmt.Errorf("parsing HTTP mocks %s: %w", path, err)
+	}
+	for i, m := range mocks {
+		if m.URL == "" {
+			return nil, fmt.Errorf("HTTP mocks %s: mock %d has no url", path, i+1)
+		}
+	}
+	return mocks, nil
+}
+
+// Transport returns a RoundTripper that answers requests matching a mock
+// without touching the network and passes all other requests to next.
+func (m HTTPMocks) Transport(next http.RoundTripper) http.RoundTripper {
+	return &mockTransport{mocks: m, next: next}
+}
+
+type mockTransport struct {
+	mocks HTTPMocks
+	next  http.RoundTripper
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, m := range t.mocks {
+		if m.matches(req) {
+			return m.Response.toHTTP(req)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// matches reports whether req matches the mock's method and URL pattern.
+func (m HTTPMock) matches(req *http.Request) bool {
+	if m.Method != "" && !strings.EqualFold(m.Method, req.Method) {
+		return false
+	}
+	u := *req.URL
+	if !strings.Contains(m.URL, "?") {
+		u.RawQuery = ""
+	}
+	u.Fragment = ""
+	return matchWildcard(m.URL, u.String())
+}
+
+// matchWildcard reports whether s matches pattern, where each * in pattern
+// matches any (possibly empty) run of characters.
+func matchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// toHTTP builds the *http.Response served for req.
+func (r HTTPMockResponse) toHTTP(req *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+
+	var body []byte
+	switch b := r.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(b)
+	default:
+		var err error
+		if body, err = json.Marshal(b); err != nil {
+			return nil, fmt.Errorf("encoding mock response body: %w", err)
+		}
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package stdlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// httpRecording is one recorded exchange, stored as <key>.json in the
+// recording directory.
+type httpRecording struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Status     int                 `json:"status"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       string              `json:"body"`
+	BodyBase64 bool                `json:"bodyBase64,omitempty"` // Body is base64 (not valid UTF-8)
+}
+
+// RecordingTransport returns a RoundTripper that sends requests through next
+// and saves each response to dir, keyed by method, URL and request body, so
+// ReplayTransport can serve it later.
+func RecordingTransport(dir string, next http.RoundTripper) http.RoundTripper {
+	return &recordTransport{dir: dir, next: next}
+}
+
+// ReplayTransport returns a RoundTripper that answers requests from the
+// responses RecordingTransport saved to dir, without touching the network.
+// Requests that were never recorded fail.
+func ReplayTransport(dir string) http.RoundTripper {
+	return &replayTransport{dir: dir}
+}
+
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, err := recordingPath(t.dir, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := httpRecording{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Status:  resp.StatusCode,
+		Headers: resp.Header,
+		Body:    string(body),
+	}
+	if !utf8.Valid(body) {
+		rec.Body = base64.StdEncoding.EncodeToString(body)
+		rec.BodyBase64 = true
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("recording %s %s: %w", req.Method, req.URL, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("recording %s %s: %w", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, err := recordingPath(t.dir, req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recording for %s %s", req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec httpRecording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("reading recording %s: %w", path, err)
+	}
+	body := []byte(rec.Body)
+	if rec.BodyBase64 {
+		if body, err = base64.StdEncoding.DecodeString(rec.Body); err != nil {
+			return nil, fmt.Errorf("reading recording %s: %w", path, err)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(rec.Headers),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// recordingPath returns the file in dir holding the recording for req. The
+// name is the SHA-256 of the method, URL and request body. req.Body is read
+// and replaced so it can still be sent.
+func recordingPath(dir string, req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return "", err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", req.Method, req.URL)
+	h.Write(body)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".json"), nil
+}
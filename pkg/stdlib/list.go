@@ -10,6 +10,13 @@ import (
 func (r *Registry) registerList() {
 	r.Register("list.concat", listConcat)
 	r.Register("list.prepend", listPrepend)
+	r.Register("list.index_of", listIndexOf)
+	r.Register("list.contains", listContains)
+	r.Register("list.range", listRange)
+	r.Register("list.repeat", listRepeat)
+
+	// Namespaced alias for the bare len() helper
+	r.Register("list.length", stdLen)
 }
 
 func listConcat(args []types.Value) (types.Value, error) {
@@ -93,3 +100,136 @@ func listPrepend(args []types.Value) (types.Value, error) {
 	result = append(result, list.AsList()...)
 	return types.NewList(result), nil
 }
+
+// MaxGeneratedListLength bounds the lists built by list.range and
+// list.repeat, so a mistyped bound cannot exhaust memory.
+const MaxGeneratedListLength = 100000
+
+// listRange implements list.range(start, end): the ints from start to end,
+// both inclusive, as with a for loop's range. It is empty when end < start.
+func listRange(args []types.Value) (types.Value, error) {
+	var start, end types.Value
+	if len(args) == 1 && args[0].Type() == types.TypeMap {
+		m := args[0].AsMap()
+		start, _ = m.Get("start")
+		end, _ = m.Get("end")
+	} else if len(args) >= 2 {
+		start, end = args[0], args[1]
+	} else {
+		return types.Null, fmt.Errorf("list.range requires start and end arguments")
+	}
+	if start.Type() != types.TypeInt || end.Type() != types.TypeInt {
+		return types.Null, types.NewTypeError("list.range: start and end must be ints")
+	}
+
+	lo, hi := start.AsInt(), end.AsInt()
+	if hi < lo {
+		return types.NewList(nil), nil
+	}
+	// hi-lo overflows int64 for bounds of opposite sign; as a uint64 it is
+	// exact, since hi >= lo
+	span := uint64(hi) - uint64(lo)
+	if span >= MaxGeneratedListLength {
+		return types.Null, types.NewResourceLimitError(
+			fmt.Sprintf("list.range: at most %d elements can be generated", MaxGeneratedListLength))
+	}
+	// Count rather than compare against hi, which may be math.MaxInt64
+	result := make([]types.Value, 0, span+1)
+	for i := uint64(0); i <= span; i++ {
+		result = append(result, types.NewInt(lo+int64(i)))
+	}
+	return types.NewList(result), nil
+}
+
+// listRepeat implements list.repeat(value, n): a list of n copies of value.
+// Maps and lists are deep-copied, so the elements can be modified
+// independently.
+func listRepeat(args []types.Value) (types.Value, error) {
+	var value, count types.Value
+	if len(args) == 1 && args[0].Type() == types.TypeMap {
+		m := args[0].AsMap()
+		v, ok := m.Get("value")
+		if !ok {
+			return types.Null, fmt.Errorf("list.repeat: missing 'value' argument")
+		}
+		value = v
+		count, _ = m.Get("n")
+	} else if len(args) >= 2 {
+		value, count = args[0], args[1]
+	} else {
+		return types.Null, fmt.Errorf("list.repeat requires value and n arguments")
+	}
+	if count.Type() != types.TypeInt {
+		return types.Null, types.NewTypeError("list.repeat: n must be an int")
+	}
+
+	n := count.AsInt()
+	if n < 0 {
+		return types.Null, types.NewValueError(
+			fmt.Sprintf("list.repeat: n must not be negative, got %d", n))
+	}
+	if n > MaxGeneratedListLength {
+		return types.Null, types.NewResourceLimitError(
+			fmt.Sprintf("list.repeat: at most %d elements can be generated", MaxGeneratedListLength))
+	}
+	result := make([]types.Value, n)
+	for i := range result {
+		result[i] = value.Clone()
+	}
+	return types.NewList(result), nil
+}
+
+func listIndexOf(args []types.Value) (types.Value, error) {
+	list, value, err := listSearchArgs("list.index_of", args)
+	if err != nil {
+		return types.Null, err
+	}
+	return types.NewInt(int64(indexOf(list, value))), nil
+}
+
+func listContains(args []types.Value) (types.Value, error) {
+	list, value, err := listSearchArgs("list.contains", args)
+	if err != nil {
+		return types.Null, err
+	}
+	return types.NewBool(indexOf(list, value) >= 0), nil
+}
+
+// indexOf returns the index of the first element of list equal to value, or
+// -1. Ints and doubles compare by numeric value, as with the == operator.
+func indexOf(list []types.Value, value types.Value) int {
+	for i, v := range list {
+		if v.Equal(value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// listSearchArgs extracts the list and value arguments of a list search
+// function, given either positionally or as a {list, value} map.
+func listSearchArgs(name string, args []types.Value) ([]types.Value, types.Value, error) {
+	var list, value types.Value
+	switch {
+	case len(args) == 1 && args[0].Type() == types.TypeMap:
+		m := args[0].AsMap()
+		l, ok := m.Get("list")
+		if !ok {
+			return nil, types.Null, fmt.Errorf("%s: missing 'list' argument", name)
+		}
+		v, ok := m.Get("value")
+		if !ok {
+			return nil, types.Null, fmt.Errorf("%s: missing 'value' argument", name)
+		}
+		list, value = l, v
+	case len(args) >= 2:
+		list, value = args[0], args[1]
+	default:
+		return nil, types.Null, fmt.Errorf("%s requires list and value arguments", name)
+	}
+
+	if list.Type() != types.TypeList {
+		return nil, types.Null, types.NewTypeError(name + ": first argument must be a list")
+	}
+	return list.AsList(), value, nil
+}
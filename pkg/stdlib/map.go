@@ -12,6 +12,10 @@ func (r *Registry) registerMapFuncs() {
 	r.Register("map.delete", mapDelete)
 	r.Register("map.merge", mapMerge)
 	r.Register("map.merge_nested", mapMergeNested)
+
+	// Namespaced aliases for the bare expression helpers
+	r.Register("map.keys", stdKeys)
+	r.Register("map.length", stdLen)
 }
 
 func mapGet(args []types.Value) (types.Value, error) {
@@ -3,6 +3,7 @@ package stdlib
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
@@ -13,6 +14,7 @@ type StdlibFunc func(args []types.Value) (types.Value, error)
 // Registry holds all standard library functions and serves as a FunctionRegistry.
 type Registry struct {
 	funcs map[string]StdlibFunc
+	clock Clock // behind sys.now, sys.sleep and sys.sleep_until
 }
 
 // NewRegistry creates a new stdlib registry with all built-in functions registered.
@@ -35,10 +37,40 @@ func NewRegistry() *Registry {
 	return r
 }
 
+// extensions are the functions the emulator provides beyond the Cloud
+// Workflows standard library.
+var extensions = map[string]bool{
+	"clone":              true,
+	"get":                true,
+	"http.get_paginated": true,
+	"if":                 true,
+	"list.contains":      true,
+	"list.index_of":      true,
+	"list.length":        true,
+	"list.range":         true,
+	"list.repeat":        true,
+	"map.keys":           true,
+	"map.length":         true,
+	"text.format":        true,
+	"text.from_hex":      true,
+	"text.join":          true,
+	"text.split_n":       true,
+	"text.to_hex":        true,
+}
+
+// IsExtension reports whether the function called name is an emulator
+// extension that Cloud Workflows does not provide.
+func IsExtension(name string) bool {
+	return extensions[name]
+}
+
 // CallFunction implements FunctionRegistry.
 func (r *Registry) CallFunction(name string, args []types.Value) (types.Value, error) {
 	fn, ok := r.funcs[name]
 	if !ok {
+		if strings.HasPrefix(name, ConnectorPrefix) {
+			return types.Null, fmt.Errorf("connector '%s' is not mocked; add a response for it to the --connector-mock file", name)
+		}
 		return types.Null, fmt.Errorf("unknown function '%s'", name)
 	}
 	return fn(args)
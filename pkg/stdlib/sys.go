@@ -3,7 +3,9 @@ package stdlib
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
@@ -11,32 +13,75 @@ import (
 
 // registerSys registers sys.* functions.
 func (r *Registry) registerSys() {
-	r.Register("sys.get_env", sysGetEnv)
+	r.Register("sys.get_env", sysGetEnv(nil))
 	r.Register("sys.log", sysLog)
-	r.Register("sys.now", sysNow)
-	r.Register("sys.sleep", sysSleep)
-	r.Register("sys.sleep_until", sysSleepUntil)
+	r.RegisterClock(emulatorClock{})
 }
 
-func sysGetEnv(args []types.Value) (types.Value, error) {
-	if len(args) == 0 {
-		return types.Null, fmt.Errorf("sys.get_env requires a name argument")
+// RegisterExecutionEnv makes sys.get_env resolve the GCW built-in variables
+// present in env (typically from ExecutionEnv) to the running execution's
+// values. Variables missing from env keep their emulator defaults.
+func (r *Registry) RegisterExecutionEnv(env map[string]string) {
+	r.Register("sys.get_env", sysGetEnv(env))
+}
+
+// ExecutionEnv returns the GCW built-in environment variables describing the
+// execution named execName, of the form
+// projects/{project}/locations/{location}/workflows/{workflow}/executions/{id}.
+// Segments that cannot be found in the name are left out.
+func ExecutionEnv(execName, revisionID string) map[string]string {
+	env := make(map[string]string)
+	parts := strings.Split(execName, "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		switch parts[i] {
+		case "projects":
+			env["GOOGLE_CLOUD_PROJECT_ID"] = parts[i+1]
+		case "locations":
+			env["GOOGLE_CLOUD_LOCATION"] = parts[i+1]
+		case "workflows":
+			env["GOOGLE_CLOUD_WORKFLOW_ID"] = parts[i+1]
+		case "executions":
+			env["GOOGLE_CLOUD_WORKFLOW_EXECUTION_ID"] = parts[i+1]
+		}
+	}
+	if revisionID != "" {
+		env["GOOGLE_CLOUD_WORKFLOW_REVISION_ID"] = revisionID
 	}
+	return env
+}
 
-	// Can be called with positional arg or map arg
-	var name string
-	if args[0].Type() == types.TypeString {
-		name = args[0].AsString()
-	} else if args[0].Type() == types.TypeMap {
-		nameVal, ok := args[0].AsMap().Get("name")
-		if !ok {
-			return types.Null, fmt.Errorf("sys.get_env requires 'name' argument")
+// sysGetEnv returns sys.get_env, resolving built-in variables from env before
+// falling back to the process environment and emulator defaults.
+func sysGetEnv(env map[string]string) StdlibFunc {
+	return func(args []types.Value) (types.Value, error) {
+		if len(args) == 0 {
+			return types.Null, fmt.Errorf("sys.get_env requires a name argument")
 		}
-		name = nameVal.AsString()
-	} else {
-		return types.Null, types.NewTypeError("sys.get_env: name must be a string")
+
+		// Can be called with positional arg or map arg
+		var name string
+		if args[0].Type() == types.TypeString {
+			name = args[0].AsString()
+		} else if args[0].Type() == types.TypeMap {
+			nameVal, ok := args[0].AsMap().Get("name")
+			if !ok {
+				return types.Null, fmt.Errorf("sys.get_env requires 'name' argument")
+			}
+			name = nameVal.AsString()
+		} else {
+			return types.Null, types.NewTypeError("sys.get_env: name must be a string")
+		}
+
+		if v, ok := env[name]; ok {
+			return types.NewString(v), nil
+		}
+		return builtinEnv(name)
 	}
+}
 
+// builtinEnv resolves name from the process environment, falling back to
+// emulator defaults for the GCW built-in variables.
+func builtinEnv(name string) (types.Value, error) {
 	// GCW built-in environment variables with emulator defaults
 	switch name {
 	case "GOOGLE_CLOUD_PROJECT_ID":
@@ -102,44 +147,87 @@ func sysLog(args []types.Value) (types.Value, error) {
 	return types.Null, nil
 }
 
-func sysNow(args []types.Value) (types.Value, error) {
-	return types.NewDouble(float64(time.Now().Unix())), nil
+// sysNow returns sys.now, reading the time from clock.
+func sysNow(clock Clock) StdlibFunc {
+	return func(args []types.Value) (types.Value, error) {
+		return types.NewDouble(float64(clock.Now().Unix())), nil
+	}
 }
 
-func sysSleep(args []types.Value) (types.Value, error) {
-	if len(args) == 0 {
-		return types.Null, nil
-	}
+// MaxSleepSeconds is the longest sys.sleep accepted, matching GCW's maximum
+// execution duration of one year. Longer sleeps raise ResourceLimitError.
+//
+// The cap is deliberately not the emulator's --execution-timeout: the
+// emulator pauses for at most MaxRealSleep per sleep, or not at all on a
+// VirtualClock, so a sleep uses little of that wall-clock budget. Capping
+// at the timeout would reject workflows that GCW accepts and that finish
+// well within the timeout here.
+const MaxSleepSeconds = 365 * 24 * 60 * 60
+
+// sysSleep returns sys.sleep, pausing on clock.
+func sysSleep(clock Clock) StdlibFunc {
+	return func(args []types.Value) (types.Value, error) {
+		if len(args) == 0 {
+			return types.Null, nil
+		}
 
-	var seconds float64
-	if args[0].Type() == types.TypeMap {
-		if s, ok := args[0].AsMap().Get("seconds"); ok {
-			n, ok := s.AsNumber()
+		secondsVal := args[0]
+		if args[0].Type() == types.TypeMap {
+			s, ok := args[0].AsMap().Get("seconds")
 			if !ok {
-				return types.Null, types.NewTypeError("sys.sleep: seconds must be a number")
+				return types.Null, nil
 			}
-			seconds = n
+			secondsVal = s
 		}
-	} else {
-		n, ok := args[0].AsNumber()
-		if !ok {
-			return types.Null, types.NewTypeError("sys.sleep: seconds must be a number")
+
+		seconds, ok := secondsVal.AsNumber()
+		if !ok || math.IsNaN(seconds) {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("sys.sleep: seconds must be a number, got %s", secondsVal.Type()))
+		}
+		if seconds < 0 {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("sys.sleep: seconds must not be negative, got %v", seconds))
+		}
+		if seconds > MaxSleepSeconds {
+			return types.Null, types.NewResourceLimitError(
+				fmt.Sprintf("sys.sleep: %v seconds exceeds the maximum execution duration of %d seconds",
+					seconds, MaxSleepSeconds))
 		}
-		seconds = n
-	}
 
-	// In emulator mode, we use a shorter sleep to speed up tests
-	// but still sleep for at least a token amount
-	duration := time.Duration(seconds * float64(time.Second))
-	if duration > time.Second {
-		duration = time.Second // cap at 1s in emulator
+		clock.Sleep(time.Duration(seconds * float64(time.Second)))
+		return types.Null, nil
 	}
-	time.Sleep(duration)
-
-	return types.Null, nil
 }
 
-func sysSleepUntil(args []types.Value) (types.Value, error) {
-	// In emulator mode, this is effectively a no-op or very short sleep
-	return types.Null, nil
+// sysSleepUntil returns sys.sleep_until, which pauses on clock until the
+// RFC 3339 timestamp in its time argument. A time in the past returns at once.
+func sysSleepUntil(clock Clock) StdlibFunc {
+	return func(args []types.Value) (types.Value, error) {
+		if len(args) == 0 {
+			return types.Null, nil
+		}
+
+		timeVal := args[0]
+		if args[0].Type() == types.TypeMap {
+			t, ok := args[0].AsMap().Get("time")
+			if !ok {
+				return types.Null, nil
+			}
+			timeVal = t
+		}
+
+		if timeVal.Type() != types.TypeString {
+			return types.Null, types.NewTypeError(
+				fmt.Sprintf("sys.sleep_until: time must be a string, got %s", timeVal.Type()))
+		}
+		until, err := time.Parse(time.RFC3339Nano, timeVal.AsString())
+		if err != nil {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("sys.sleep_until: invalid timestamp %q", timeVal.AsString()))
+		}
+
+		clock.Sleep(until.Sub(clock.Now()))
+		return types.Null, nil
+	}
 }
@@ -1,10 +1,13 @@
 package stdlib
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
@@ -14,12 +17,17 @@ func (r *Registry) registerText() {
 	r.Register("text.decode", textDecode)
 	r.Register("text.encode", textEncode)
 	r.Register("text.find_all", textFindAll)
+	r.Register("text.format", textFormat)
 	r.Register("text.find_all_regex", textFindAllRegex)
+	r.Register("text.from_hex", textFromHex)
+	r.Register("text.join", textJoin)
 	r.Register("text.match_regex", textMatchRegex)
 	r.Register("text.replace_all", textReplaceAll)
 	r.Register("text.replace_all_regex", textReplaceAllRegex)
 	r.Register("text.split", textSplit)
+	r.Register("text.split_n", textSplitN)
 	r.Register("text.substring", textSubstring)
+	r.Register("text.to_hex", textToHex)
 	r.Register("text.to_lower", textToLower)
 	r.Register("text.to_upper", textToUpper)
 	r.Register("text.url_decode", textURLDecode)
@@ -32,18 +40,35 @@ func textDecode(args []types.Value) (types.Value, error) {
 		return types.Null, fmt.Errorf("text.decode requires an argument")
 	}
 	var data []byte
+	charset := types.Null
 	if args[0].Type() == types.TypeMap {
-		if v, ok := args[0].AsMap().Get("data"); ok && v.Type() == types.TypeBytes {
+		m := args[0].AsMap()
+		if v, ok := m.Get("data"); ok && v.Type() == types.TypeBytes {
 			data = v.AsBytes()
 		} else {
 			return types.Null, types.NewTypeError("text.decode: data must be bytes")
 		}
+		if v, ok := m.Get("charset"); ok {
+			charset = v
+		}
 	} else if args[0].Type() == types.TypeBytes {
 		data = args[0].AsBytes()
+		if len(args) > 1 {
+			charset = args[1]
+		}
 	} else {
 		return types.Null, types.NewTypeError("text.decode requires bytes argument")
 	}
-	return types.NewString(string(data)), nil
+
+	cs, err := parseCharset("text.decode", charset)
+	if err != nil {
+		return types.Null, err
+	}
+	s, err := cs.decode(data)
+	if err != nil {
+		return types.Null, types.NewValueError(fmt.Sprintf("text.decode: %v", err))
+	}
+	return types.NewString(s), nil
 }
 
 func textEncode(args []types.Value) (types.Value, error) {
@@ -51,18 +76,99 @@ func textEncode(args []types.Value) (types.Value, error) {
 		return types.Null, fmt.Errorf("text.encode requires an argument")
 	}
 	var s string
+	charset := types.Null
 	if args[0].Type() == types.TypeMap {
-		if v, ok := args[0].AsMap().Get("data"); ok && v.Type() == types.TypeString {
+		m := args[0].AsMap()
+		if v, ok := m.Get("data"); ok && v.Type() == types.TypeString {
 			s = v.AsString()
 		} else {
 			return types.Null, types.NewTypeError("text.encode: data must be a string")
 		}
+		if v, ok := m.Get("charset"); ok {
+			charset = v
+		}
 	} else if args[0].Type() == types.TypeString {
 		s = args[0].AsString()
+		if len(args) > 1 {
+			charset = args[1]
+		}
 	} else {
 		return types.Null, types.NewTypeError("text.encode requires string argument")
 	}
-	return types.NewBytes([]byte(s)), nil
+
+	cs, err := parseCharset("text.encode", charset)
+	if err != nil {
+		return types.Null, err
+	}
+	data, err := cs.encode(s)
+	if err != nil {
+		return types.Null, types.NewValueError(fmt.Sprintf("text.encode: %v", err))
+	}
+	return types.NewBytes(data), nil
+}
+
+// charset converts between strings and bytes in one character encoding.
+type charset struct {
+	name string
+	// maxRune is the highest code point the charset can represent; every
+	// code point up to it maps to the byte of the same value. Zero means UTF-8.
+	maxRune rune
+}
+
+// charsets maps upper-cased charset names and aliases to their encodings.
+var charsets = map[string]charset{
+	"UTF-8":      {name: "UTF-8"},
+	"UTF8":       {name: "UTF-8"},
+	"US-ASCII":   {name: "US-ASCII", maxRune: 0x7F},
+	"ASCII":      {name: "US-ASCII", maxRune: 0x7F},
+	"ISO-8859-1": {name: "ISO-8859-1", maxRune: 0xFF},
+	"LATIN1":     {name: "ISO-8859-1", maxRune: 0xFF},
+}
+
+// parseCharset resolves an optional charset argument, defaulting to UTF-8.
+func parseCharset(fn string, v types.Value) (charset, error) {
+	if v.IsNull() {
+		return charsets["UTF-8"], nil
+	}
+	if v.Type() != types.TypeString {
+		return charset{}, types.NewTypeError(fn + ": charset must be a string")
+	}
+	cs, ok := charsets[strings.ToUpper(v.AsString())]
+	if !ok {
+		return charset{}, types.NewValueError(fmt.Sprintf("%s: unsupported charset %q", fn, v.AsString()))
+	}
+	return cs, nil
+}
+
+func (cs charset) encode(s string) ([]byte, error) {
+	if cs.maxRune == 0 {
+		return []byte(s), nil
+	}
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > cs.maxRune {
+			return nil, fmt.Errorf("character %q cannot be encoded as %s", r, cs.name)
+		}
+		out = append(out, byte(r))
+	}
+	return out, nil
+}
+
+func (cs charset) decode(data []byte) (string, error) {
+	if cs.maxRune == 0 {
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("invalid %s byte sequence", cs.name)
+		}
+		return string(data), nil
+	}
+	var b strings.Builder
+	for _, c := range data {
+		if rune(c) > cs.maxRune {
+			return "", fmt.Errorf("invalid %s byte 0x%02x", cs.name, c)
+		}
+		b.WriteRune(rune(c))
+	}
+	return b.String(), nil
 }
 
 func textFindAll(args []types.Value) (types.Value, error) {
@@ -133,6 +239,165 @@ func textFindAllRegex(args []types.Value) (types.Value, error) {
 	return types.NewList(result), nil
 }
 
+// textFromHex decodes a hexadecimal string, in either case, into bytes.
+func textFromHex(args []types.Value) (types.Value, error) {
+	if len(args) == 0 {
+		return types.Null, fmt.Errorf("text.from_hex requires an argument")
+	}
+	v := args[0]
+	if v.Type() == types.TypeMap {
+		v, _ = v.AsMap().Get("data")
+	}
+	if v.Type() != types.TypeString {
+		return types.Null, types.NewTypeError("text.from_hex: data must be a string")
+	}
+	data, err := hex.DecodeString(v.AsString())
+	if err != nil {
+		return types.Null, types.NewValueError(fmt.Sprintf("text.from_hex: invalid hex: %v", err))
+	}
+	return types.NewBytes(data), nil
+}
+
+func textJoin(args []types.Value) (types.Value, error) {
+	var list, separator types.Value
+	if len(args) > 0 && args[0].Type() == types.TypeMap {
+		m := args[0].AsMap()
+		list, _ = m.Get("list")
+		separator, _ = m.Get("separator")
+	} else if len(args) >= 2 {
+		list, separator = args[0], args[1]
+	} else {
+		return types.Null, fmt.Errorf("text.join requires list and separator")
+	}
+	if list.Type() != types.TypeList {
+		return types.Null, types.NewTypeError("text.join: list must be a list")
+	}
+	if separator.Type() != types.TypeString {
+		return types.Null, types.NewTypeError("text.join: separator must be a string")
+	}
+
+	elems := list.AsList()
+	parts := make([]string, len(elems))
+	for i, e := range elems {
+		if e.Type() != types.TypeString {
+			return types.Null, types.NewTypeError(
+				fmt.Sprintf("text.join: element %d is %s, not string", i, e.Type()))
+		}
+		parts[i] = e.AsString()
+	}
+	return types.NewString(strings.Join(parts, separator.AsString())), nil
+}
+
+// textFormat implements text.format(template, values...), a printf-style
+// formatter supporting %d (int), %f and %.Nf (int or double), %s (string),
+// %v (any value, as string() would render it) and %% (a literal %). The
+// values may also be passed as a map of template and a values list.
+func textFormat(args []types.Value) (types.Value, error) {
+	var template types.Value
+	var values []types.Value
+	if len(args) == 1 && args[0].Type() == types.TypeMap {
+		m := args[0].AsMap()
+		template, _ = m.Get("template")
+		if v, ok := m.Get("values"); ok {
+			if v.Type() != types.TypeList {
+				return types.Null, types.NewTypeError("text.format: values must be a list")
+			}
+			values = v.AsList()
+		}
+	} else if len(args) >= 1 {
+		template, values = args[0], args[1:]
+	} else {
+		return types.Null, fmt.Errorf("text.format requires a template")
+	}
+	if template.Type() != types.TypeString {
+		return types.Null, types.NewTypeError("text.format: template must be a string")
+	}
+
+	var b strings.Builder
+	tmpl := template.AsString()
+	next := 0
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' {
+			b.WriteByte(tmpl[i])
+			continue
+		}
+		i++
+		if i < len(tmpl) && tmpl[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+
+		precision := -1
+		if i < len(tmpl) && tmpl[i] == '.' {
+			start := i + 1
+			i = start
+			for i < len(tmpl) && tmpl[i] >= '0' && tmpl[i] <= '9' {
+				i++
+			}
+			// At most two digits, which also keeps the Atoi in range
+			if i == start || i-start > 2 {
+				return types.Null, types.NewValueError("text.format: invalid precision in template")
+			}
+			precision, _ = strconv.Atoi(tmpl[start:i])
+		}
+		if i >= len(tmpl) {
+			return types.Null, types.NewValueError("text.format: template ends with an incomplete verb")
+		}
+		verb := tmpl[i]
+		if precision >= 0 && verb != 'f' {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("text.format: precision is only allowed with %%f, not %%%c", verb))
+		}
+		if verb != 'd' && verb != 'f' && verb != 's' && verb != 'v' {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("text.format: unsupported verb %%%c", verb))
+		}
+		if next >= len(values) {
+			return types.Null, types.NewValueError(
+				fmt.Sprintf("text.format: missing value for verb %d", next+1))
+		}
+		v := values[next]
+		next++
+
+		switch verb {
+		case 'd':
+			if v.Type() != types.TypeInt {
+				return types.Null, types.NewTypeError(
+					fmt.Sprintf("text.format: %%d requires an int, got %s", v.Type()))
+			}
+			fmt.Fprintf(&b, "%d", v.AsInt())
+		case 'f':
+			var f float64
+			switch v.Type() {
+			case types.TypeInt:
+				f = float64(v.AsInt())
+			case types.TypeDouble:
+				f = v.AsDouble()
+			default:
+				return types.Null, types.NewTypeError(
+					fmt.Sprintf("text.format: %%f requires a number, got %s", v.Type()))
+			}
+			if precision < 0 {
+				precision = 6
+			}
+			b.WriteString(strconv.FormatFloat(f, 'f', precision, 64))
+		case 's':
+			if v.Type() != types.TypeString {
+				return types.Null, types.NewTypeError(
+					fmt.Sprintf("text.format: %%s requires a string, got %s", v.Type()))
+			}
+			b.WriteString(v.AsString())
+		case 'v':
+			b.WriteString(v.String())
+		}
+	}
+	if next < len(values) {
+		return types.Null, types.NewValueError(
+			fmt.Sprintf("text.format: %d values given but the template uses %d", len(values), next))
+	}
+	return types.NewString(b.String()), nil
+}
+
 func textMatchRegex(args []types.Value) (types.Value, error) {
 	var source, pattern string
 	if len(args) > 0 && args[0].Type() == types.TypeMap {
@@ -232,6 +497,37 @@ func textSplit(args []types.Value) (types.Value, error) {
 	return types.NewList(result), nil
 }
 
+func textSplitN(args []types.Value) (types.Value, error) {
+	var source, separator, limit types.Value
+	if len(args) > 0 && args[0].Type() == types.TypeMap {
+		m := args[0].AsMap()
+		source, _ = m.Get("source")
+		separator, _ = m.Get("separator")
+		limit, _ = m.Get("limit")
+	} else if len(args) >= 3 {
+		source, separator, limit = args[0], args[1], args[2]
+	} else {
+		return types.Null, fmt.Errorf("text.split_n requires source, separator and limit")
+	}
+	if source.Type() != types.TypeString || separator.Type() != types.TypeString {
+		return types.Null, types.NewTypeError("text.split_n: source and separator must be strings")
+	}
+	if limit.Type() != types.TypeInt {
+		return types.Null, types.NewTypeError("text.split_n: limit must be an int")
+	}
+	if limit.AsInt() < 1 {
+		return types.Null, types.NewValueError(
+			fmt.Sprintf("text.split_n: limit must be at least 1, got %d", limit.AsInt()))
+	}
+
+	parts := strings.SplitN(source.AsString(), separator.AsString(), int(limit.AsInt()))
+	result := make([]types.Value, len(parts))
+	for i, p := range parts {
+		result[i] = types.NewString(p)
+	}
+	return types.NewList(result), nil
+}
+
 func textSubstring(args []types.Value) (types.Value, error) {
 	var source string
 	var start, end int64
@@ -272,6 +568,21 @@ func textSubstring(args []types.Value) (types.Value, error) {
 	return types.NewString(source[start:end]), nil
 }
 
+// textToHex encodes bytes as a lowercase hexadecimal string.
+func textToHex(args []types.Value) (types.Value, error) {
+	if len(args) == 0 {
+		return types.Null, fmt.Errorf("text.to_hex requires an argument")
+	}
+	v := args[0]
+	if v.Type() == types.TypeMap {
+		v, _ = v.AsMap().Get("data")
+	}
+	if v.Type() != types.TypeBytes {
+		return types.Null, types.NewTypeError("text.to_hex: data must be bytes")
+	}
+	return types.NewString(hex.EncodeToString(v.AsBytes())), nil
+}
+
 func textToLower(args []types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Null, fmt.Errorf("text.to_lower requires an argument")
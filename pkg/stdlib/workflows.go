@@ -1,11 +1,11 @@
 package stdlib
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/lemonberrylabs/gcw-emulator/pkg/ast"
-	"github.com/lemonberrylabs/gcw-emulator/pkg/parser"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
 
@@ -20,29 +20,38 @@ type WorkflowInfo struct {
 	SourceCode string
 }
 
+// WorkflowParser returns the parsed form of the named workflow, given its
+// source. It is provided by the API layer, which caches parsed workflows.
+type WorkflowParser func(name, source string) (*ast.Workflow, error)
+
 // ChildExecutor runs a child workflow synchronously and returns the result.
 // It is provided by the API layer which has access to the runtime engine.
-type ChildExecutor func(wfAST *ast.Workflow, args types.Value) (types.Value, error)
+// The child must stop when ctx, its parent execution's context, ends.
+type ChildExecutor func(ctx context.Context, wfAST *ast.Workflow, args types.Value) (types.Value, error)
 
 // RegisterWorkflowExecution registers the googleapis.workflowexecutions.v1
-// connector function for child workflow execution.
+// connector function for child workflow execution. ctx is the context of the
+// execution calling it: child executions run on it, so they time out and are
+// cancelled together with their parent.
 func (r *Registry) RegisterWorkflowExecution(
+	ctx context.Context,
 	store WorkflowStore,
-	parsedCache map[string]*ast.Workflow,
+	parse WorkflowParser,
 	executor ChildExecutor,
 ) {
 	r.Register(
 		"googleapis.workflowexecutions.v1.projects.locations.workflows.executions.run",
 		func(args []types.Value) (types.Value, error) {
-			return workflowExecutionsRun(args, store, parsedCache, executor)
+			return workflowExecutionsRun(ctx, args, store, parse, executor)
 		},
 	)
 }
 
 func workflowExecutionsRun(
+	ctx context.Context,
 	args []types.Value,
 	store WorkflowStore,
-	parsedCache map[string]*ast.Workflow,
+	parse WorkflowParser,
 	executor ChildExecutor,
 ) (types.Value, error) {
 	if len(args) == 0 {
@@ -77,20 +86,14 @@ func workflowExecutionsRun(
 		}
 	}
 
-	// Get or parse the workflow AST
-	wfAST, ok := parsedCache[wfInfo.Name]
-	if !ok {
-		parsed, err := parser.Parse([]byte(wfInfo.SourceCode))
-		if err != nil {
-			return types.Null, fmt.Errorf("failed to parse child workflow '%s': %v", workflowID, err)
-		}
-		wfAST = parsed
-		parsedCache[wfInfo.Name] = wfAST
+	wfAST, err := parse(wfInfo.Name, wfInfo.SourceCode)
+	if err != nil {
+		return types.Null, fmt.Errorf("failed to parse child workflow '%s': %v", workflowID, err)
 	}
 
 	// Execute the child workflow synchronously
 	startTime := time.Now()
-	result, err := executor(wfAST, childArgs)
+	result, err := executor(ctx, wfAST, childArgs)
 	endTime := time.Now()
 
 	// Build the execution response object matching the GCW Execution resource
@@ -2,7 +2,14 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,10 +23,34 @@ const (
 	WorkflowActive WorkflowState = "ACTIVE"
 )
 
+// WorkflowView selects which workflow fields a Get returns, mirroring the
+// GCW WorkflowView enum.
+type WorkflowView string
+
+const (
+	// WorkflowViewBasic omits the workflow source.
+	WorkflowViewBasic WorkflowView = "BASIC"
+	// WorkflowViewFull includes every field. It is the default.
+	WorkflowViewFull WorkflowView = "FULL"
+)
+
+// ParseWorkflowView parses a view name. Both the short form ("BASIC") and the
+// enum name ("WORKFLOW_VIEW_BASIC") are accepted; an empty name is FULL.
+func ParseWorkflowView(s string) (WorkflowView, error) {
+	switch strings.TrimPrefix(strings.ToUpper(s), "WORKFLOW_VIEW_") {
+	case "", "UNSPECIFIED", string(WorkflowViewFull):
+		return WorkflowViewFull, nil
+	case string(WorkflowViewBasic):
+		return WorkflowViewBasic, nil
+	}
+	return "", fmt.Errorf("invalid view %q: must be BASIC or FULL", s)
+}
+
 // ExecutionState represents the state of a workflow execution.
 type ExecutionState string
 
 const (
+	ExecutionQueued    ExecutionState = "QUEUED"
 	ExecutionActive    ExecutionState = "ACTIVE"
 	ExecutionSucceeded ExecutionState = "SUCCEEDED"
 	ExecutionFailed    ExecutionState = "FAILED"
@@ -38,6 +69,14 @@ type Workflow struct {
 	Labels      map[string]string `json:"labels,omitempty"`
 }
 
+// clone returns a copy of the workflow that callers can read without holding
+// the store's lock while the stored one is updated.
+func (wf *Workflow) clone() *Workflow {
+	c := *wf
+	c.Labels = maps.Clone(wf.Labels)
+	return &c
+}
+
 // Execution represents a stored workflow execution.
 type Execution struct {
 	Name       string         `json:"name"`
@@ -50,12 +89,38 @@ type Execution struct {
 	WorkflowRevisionID string `json:"workflowRevisionId"`
 }
 
+// clone returns a copy of the execution that callers can read, e.g. to
+// serialize it, while its run goroutine updates the stored one.
+func (e *Execution) clone() *Execution {
+	c := *e
+	if e.Error != nil {
+		errCopy := *e.Error
+		c.Error = &errCopy
+	}
+	return &c
+}
+
 // ExecutionError represents an error in a failed execution.
 type ExecutionError struct {
 	Payload string `json:"payload"`
 	Context string `json:"context,omitempty"`
 }
 
+// StepEvent records one run of a step in an execution. A step that runs more
+// than once, such as a step in a loop body, has an event per run.
+type StepEvent struct {
+	Name      string         `json:"name"`
+	State     ExecutionState `json:"state"` // ACTIVE while running, then SUCCEEDED or FAILED
+	StartTime time.Time      `json:"startTime"`
+	EndTime   time.Time      `json:"endTime,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// MaxStepEvents bounds the step events kept per execution, so long loops do
+// not grow memory without limit. Steps started after the limit is reached
+// are not recorded.
+const MaxStepEvents = 10000
+
 // Callback represents a callback endpoint for a waiting execution.
 type Callback struct {
 	Name         string    `json:"name"`
@@ -66,23 +131,60 @@ type Callback struct {
 }
 
 // Store is a thread-safe in-memory storage for workflows and executions.
+// The workflows and executions it returns are snapshots: later updates to the
+// store do not change them, and changing them does not update the store.
 type Store struct {
 	mu         sync.RWMutex
 	workflows  map[string]*Workflow
 	executions map[string]*Execution
 	callbacks  map[string]*Callback
+	steps      map[string][]*StepEvent // step events by execution name, in start order
+
+	// byWorkflow indexes executions by workflow name, in creation order,
+	// so listing one workflow's executions does not scan every execution.
+	byWorkflow map[string][]*Execution
 
 	// Counters for generating unique IDs
 	execCounter int64
 	revCounter  int64
 }
 
+var validWorkflowID = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ValidateWorkflowID checks id against the GCW workflow ID rules: a lowercase
+// letter followed by lowercase letters, digits, hyphens, or underscores, at
+// most 128 characters in total.
+func ValidateWorkflowID(id string) error {
+	if !validWorkflowID.MatchString(id) || len(id) > 128 {
+		return fmt.Errorf("invalid workflowId %q: must start with a lowercase letter, "+
+			"contain only lowercase letters, digits, hyphens, and underscores, "+
+			"and be at most 128 characters", id)
+	}
+	return nil
+}
+
+var validExecutionID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateExecutionID checks a client-supplied execution ID: letters, digits,
+// hyphens, and underscores, starting with a letter or digit, at most 128
+// characters in total. UUIDs qualify.
+func ValidateExecutionID(id string) error {
+	if !validExecutionID.MatchString(id) || len(id) > 128 {
+		return fmt.Errorf("invalid executionId %q: must start with a letter or digit, "+
+			"contain only letters, digits, hyphens, and underscores, "+
+			"and be at most 128 characters", id)
+	}
+	return nil
+}
+
 // New creates a new empty store.
 func New() *Store {
 	return &Store{
 		workflows:  make(map[string]*Workflow),
 		executions: make(map[string]*Execution),
 		callbacks:  make(map[string]*Callback),
+		steps:      make(map[string][]*StepEvent),
+		byWorkflow: make(map[string][]*Execution),
 	}
 }
 
@@ -108,7 +210,7 @@ func (s *Store) CreateWorkflow(parent, workflowID, sourceCode, description strin
 		SourceCode: sourceCode,
 	}
 	s.workflows[name] = wf
-	return wf, nil
+	return wf.clone(), nil
 }
 
 // GetWorkflow retrieves a workflow by its full name.
@@ -120,24 +222,42 @@ func (s *Store) GetWorkflow(name string) (*Workflow, error) {
 	if !ok {
 		return nil, fmt.Errorf("workflow '%s' not found", name)
 	}
-	return wf, nil
+	return wf.clone(), nil
 }
 
-// ListWorkflows returns all workflows under a parent.
+// ListWorkflows returns all workflows under a parent. As in GCP, the project
+// or location may be "-" to match any, e.g. projects/p/locations/- lists the
+// project's workflows across all locations.
 func (s *Store) ListWorkflows(parent string) []*Workflow {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var result []*Workflow
-	prefix := parent + "/workflows/"
 	for name, wf := range s.workflows {
-		if len(name) > len(prefix) && name[:len(prefix)] == prefix {
-			result = append(result, wf)
+		if inParent(name, parent) {
+			result = append(result, wf.clone())
 		}
 	}
 	return result
 }
 
+// inParent reports whether the workflow name lies directly under parent,
+// treating a "-" project or location in parent as a wildcard.
+func inParent(name, parent string) bool {
+	parentParts := strings.Split(parent, "/")
+	nameParts := strings.Split(name, "/")
+	if len(nameParts) != len(parentParts)+2 || nameParts[len(parentParts)] != "workflows" {
+		return false
+	}
+	for i, p := range parentParts {
+		// Odd positions hold IDs; even ones the literal collection names
+		if p != nameParts[i] && (p != "-" || i%2 == 0) {
+			return false
+		}
+	}
+	return true
+}
+
 // UpdateWorkflow updates a workflow's source code.
 func (s *Store) UpdateWorkflow(name, sourceCode, description string) (*Workflow, error) {
 	s.mu.Lock()
@@ -156,7 +276,7 @@ func (s *Store) UpdateWorkflow(name, sourceCode, description string) (*Workflow,
 	wf.RevisionID = fmt.Sprintf("%06d-000", s.revCounter)
 	wf.UpdateTime = time.Now()
 
-	return wf, nil
+	return wf.clone(), nil
 }
 
 // DeleteWorkflow removes a workflow.
@@ -181,10 +301,45 @@ func (s *Store) CreateExecution(workflowName string, argument types.Value) (*Exe
 		return nil, fmt.Errorf("workflow '%s' not found", workflowName)
 	}
 
-	s.execCounter++
-	execID := fmt.Sprintf("exec-%d", s.execCounter)
+	// Skip IDs a client has already chosen with CreateExecutionWithID
+	var name string
+	for {
+		s.execCounter++
+		name = fmt.Sprintf("%s/executions/exec-%d", workflowName, s.execCounter)
+		if _, taken := s.executions[name]; !taken {
+			break
+		}
+	}
+	return s.addExecution(wf, name, argument).clone(), nil
+}
+
+// CreateExecutionWithID creates an execution with the client-chosen ID
+// execID, which must pass ValidateExecutionID. If the workflow already has an
+// execution with that ID, it is returned with created false and argument is
+// ignored, so a client can safely retry a create whose response it lost.
+func (s *Store) CreateExecutionWithID(workflowName, execID string, argument types.Value) (exec *Execution, created bool, err error) {
+	if err := ValidateExecutionID(execID); err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wf, ok := s.workflows[workflowName]
+	if !ok {
+		return nil, false, fmt.Errorf("workflow '%s' not found", workflowName)
+	}
+
 	name := fmt.Sprintf("%s/executions/%s", workflowName, execID)
+	if existing, ok := s.executions[name]; ok {
+		return existing.clone(), false, nil
+	}
+	return s.addExecution(wf, name, argument).clone(), true, nil
+}
 
+// addExecution records a new active execution of wf. The caller must hold
+// s.mu.
+func (s *Store) addExecution(wf *Workflow, name string, argument types.Value) *Execution {
 	var argStr string
 	if !argument.IsNull() {
 		b, _ := argument.MarshalJSON()
@@ -199,7 +354,8 @@ func (s *Store) CreateExecution(workflowName string, argument types.Value) (*Exe
 		WorkflowRevisionID: wf.RevisionID,
 	}
 	s.executions[name] = exec
-	return exec, nil
+	s.byWorkflow[wf.Name] = append(s.byWorkflow[wf.Name], exec)
+	return exec
 }
 
 // GetExecution retrieves an execution by name.
@@ -211,7 +367,7 @@ func (s *Store) GetExecution(name string) (*Execution, error) {
 	if !ok {
 		return nil, fmt.Errorf("execution '%s' not found", name)
 	}
-	return exec, nil
+	return exec.clone(), nil
 }
 
 // ListExecutions returns all executions for a workflow.
@@ -219,17 +375,144 @@ func (s *Store) ListExecutions(workflowName string) []*Execution {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var result []*Execution
-	prefix := workflowName + "/executions/"
-	for name, exec := range s.executions {
-		if len(name) > len(prefix) && name[:len(prefix)] == prefix {
-			result = append(result, exec)
-		}
+	execs := s.byWorkflow[workflowName]
+	if len(execs) == 0 {
+		return nil
+	}
+	result := make([]*Execution, len(execs))
+	for i, exec := range execs {
+		result[i] = exec.clone()
 	}
 	return result
 }
 
-// CompleteExecution marks an execution as succeeded with a result.
+// LatestExecution returns a workflow's most recently created execution.
+func (s *Store) LatestExecution(workflowName string) (*Execution, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.workflows[workflowName]; !ok {
+		return nil, fmt.Errorf("workflow '%s' not found", workflowName)
+	}
+	execs := s.byWorkflow[workflowName]
+	if len(execs) == 0 {
+		return nil, fmt.Errorf("workflow '%s' has no executions", workflowName)
+	}
+	return execs[len(execs)-1].clone(), nil
+}
+
+// ListExecutionsPage returns one page of a workflow's executions, newest
+// first, ordered by (StartTime, Name) descending. pageToken is the cursor
+// returned by the previous call ("" for the first page); a pageSize of 0 or
+// less returns all remaining executions. The returned token is "" once the
+// last page has been reached.
+//
+// Because the cursor records the position of the last returned execution
+// rather than an offset, executions created between calls sort ahead of the
+// cursor and never shift, skip, or repeat entries on later pages.
+func (s *Store) ListExecutionsPage(workflowName string, pageSize int, pageToken string) ([]*Execution, string, error) {
+	var after *pageCursor
+	if pageToken != "" {
+		c, err := decodePageCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	execs := s.ListExecutions(workflowName)
+	sort.Slice(execs, func(i, j int) bool {
+		return cursorOf(execs[j]).before(cursorOf(execs[i]))
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(execs), func(i int) bool {
+			return cursorOf(execs[i]).before(*after)
+		})
+	}
+	execs = execs[start:]
+
+	if pageSize <= 0 || len(execs) <= pageSize {
+		return execs, "", nil
+	}
+	page := execs[:pageSize]
+	return page, cursorOf(page[len(page)-1]).encode(), nil
+}
+
+// pageCursor identifies a position in an execution listing.
+type pageCursor struct {
+	createTime time.Time
+	name       string
+}
+
+func cursorOf(e *Execution) pageCursor {
+	return pageCursor{createTime: e.StartTime, name: e.Name}
+}
+
+// before reports whether c sorts before o in ascending (createTime, name) order.
+func (c pageCursor) before(o pageCursor) bool {
+	if !c.createTime.Equal(o.createTime) {
+		return c.createTime.Before(o.createTime)
+	}
+	return c.name < o.name
+}
+
+func (c pageCursor) encode() string {
+	raw := fmt.Sprintf("%d|%s", c.createTime.UnixNano(), c.name)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageCursor(token string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid page token")
+	}
+	nanos, name, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return pageCursor{}, fmt.Errorf("invalid page token")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid page token")
+	}
+	return pageCursor{createTime: time.Unix(0, n), name: name}, nil
+}
+
+// QueueExecution marks a newly created execution as waiting for a free
+// execution slot.
+func (s *Store) QueueExecution(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exec, ok := s.executions[name]
+	if !ok {
+		return fmt.Errorf("execution '%s' not found", name)
+	}
+	exec.State = ExecutionQueued
+	return nil
+}
+
+// StartQueuedExecution moves a queued execution to ACTIVE. It fails if the
+// execution left the queue some other way, e.g. it was cancelled.
+func (s *Store) StartQueuedExecution(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exec, ok := s.executions[name]
+	if !ok {
+		return fmt.Errorf("execution '%s' not found", name)
+	}
+	if exec.State != ExecutionQueued {
+		return fmt.Errorf("execution '%s' is not queued (state: %s)", name, exec.State)
+	}
+	exec.State = ExecutionActive
+	return nil
+}
+
+// CompleteExecution marks an active execution as succeeded with a result.
+// An execution that has already ended, e.g. because it was cancelled, keeps
+// its state.
 func (s *Store) CompleteExecution(name string, result types.Value) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -238,6 +521,9 @@ func (s *Store) CompleteExecution(name string, result types.Value) error {
 	if !ok {
 		return fmt.Errorf("execution '%s' not found", name)
 	}
+	if exec.State != ExecutionActive {
+		return fmt.Errorf("execution '%s' is not active (state: %s)", name, exec.State)
+	}
 
 	exec.State = ExecutionSucceeded
 	exec.EndTime = time.Now()
@@ -248,7 +534,9 @@ func (s *Store) CompleteExecution(name string, result types.Value) error {
 	return nil
 }
 
-// FailExecution marks an execution as failed with an error.
+// FailExecution marks an active execution as failed with an error. An
+// execution that has already ended, e.g. because it was cancelled, keeps its
+// state.
 func (s *Store) FailExecution(name string, err error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -257,16 +545,25 @@ func (s *Store) FailExecution(name string, err error) error {
 	if !ok {
 		return fmt.Errorf("execution '%s' not found", name)
 	}
+	if exec.State != ExecutionActive {
+		return fmt.Errorf("execution '%s' is not active (state: %s)", name, exec.State)
+	}
 
 	exec.State = ExecutionFailed
 	exec.EndTime = time.Now()
 
-	payload := err.Error()
-	if we, ok := err.(*types.WorkflowError); ok {
-		b, _ := we.ToValue().MarshalJSON()
-		payload = string(b)
+	// The payload is always the JSON error map ({message, code, tags, ...}),
+	// matching GCW. Errors that did not originate as a WorkflowError are
+	// reported with just their message.
+	var we *types.WorkflowError
+	if !errors.As(err, &we) {
+		we = &types.WorkflowError{Message: err.Error()}
+	}
+	b, _ := we.ToValue().MarshalJSON()
+	exec.Error = &ExecutionError{
+		Payload: string(b),
+		Context: strings.Join(we.StepPath, " -> "),
 	}
-	exec.Error = &ExecutionError{Payload: payload}
 
 	return nil
 }
@@ -281,7 +578,7 @@ func (s *Store) CancelExecution(name string) error {
 		return fmt.Errorf("execution '%s' not found", name)
 	}
 
-	if exec.State != ExecutionActive {
+	if exec.State != ExecutionActive && exec.State != ExecutionQueued {
 		return fmt.Errorf("execution '%s' is not active (state: %s)", name, exec.State)
 	}
 
@@ -290,6 +587,62 @@ func (s *Store) CancelExecution(name string) error {
 	return nil
 }
 
+// StartStep records that a step of an execution has started and returns the
+// index to pass to FinishStep, or -1 if the execution already has
+// MaxStepEvents events.
+func (s *Store) StartStep(execName, step string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.steps[execName]
+	if len(events) >= MaxStepEvents {
+		return -1
+	}
+	s.steps[execName] = append(events, &StepEvent{
+		Name:      step,
+		State:     ExecutionActive,
+		StartTime: time.Now(),
+	})
+	return len(events)
+}
+
+// FinishStep records that the step event at index has finished, failing with
+// err if it is non-nil.
+func (s *Store) FinishStep(execName string, index int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.steps[execName]
+	if index < 0 || index >= len(events) {
+		return
+	}
+	ev := events[index]
+	ev.EndTime = time.Now()
+	ev.State = ExecutionSucceeded
+	if err != nil {
+		ev.State = ExecutionFailed
+		ev.Error = err.Error()
+		var we *types.WorkflowError
+		if errors.As(err, &we) {
+			ev.Error = we.Message
+		}
+	}
+}
+
+// ListSteps returns copies of an execution's step events in the order the
+// steps started.
+func (s *Store) ListSteps(execName string) []StepEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.steps[execName]
+	result := make([]StepEvent, len(events))
+	for i, ev := range events {
+		result[i] = *ev
+	}
+	return result
+}
+
 // CreateCallback stores a callback endpoint.
 func (s *Store) CreateCallback(executionID, method, callbackURL string) *Callback {
 	s.mu.Lock()
@@ -327,7 +680,7 @@ func (s *Store) FindWorkflowByID(workflowID string) (*Workflow, error) {
 	suffix := "/workflows/" + workflowID
 	for name, wf := range s.workflows {
 		if len(name) >= len(suffix) && name[len(name)-len(suffix):] == suffix {
-			return wf, nil
+			return wf.clone(), nil
 		}
 	}
 	return nil, fmt.Errorf("workflow with id '%s' not found", workflowID)
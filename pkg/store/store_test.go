@@ -0,0 +1,316 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
+)
+
+const testWorkflow = "projects/p/locations/l/workflows/wf"
+
+func newStoreWithExecutions(t *testing.T, n int) (*Store, []string) {
+	t.Helper()
+	s := New()
+	if _, err := s.CreateWorkflow("projects/p/locations/l", "wf", "main: {}", ""); err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	var names []string
+	for i := 0; i < n; i++ {
+		e, err := s.CreateExecution(testWorkflow, types.Null)
+		if err != nil {
+			t.Fatalf("create execution: %v", err)
+		}
+		names = append(names, e.Name)
+	}
+	return s, names
+}
+
+func TestListExecutionsPageNewestFirst(t *testing.T) {
+	s, names := newStoreWithExecutions(t, 5)
+
+	page, next, err := s.ListExecutionsPage(testWorkflow, 0, "")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if next != "" {
+		t.Errorf("expected no next page token, got %q", next)
+	}
+	if len(page) != len(names) {
+		t.Fatalf("got %d executions, want %d", len(page), len(names))
+	}
+	for i, e := range page {
+		if want := names[len(names)-1-i]; e.Name != want {
+			t.Errorf("page[%d] = %s, want %s", i, e.Name, want)
+		}
+	}
+}
+
+func TestListExecutionsPageStableUnderInserts(t *testing.T) {
+	s, original := newStoreWithExecutions(t, 10)
+
+	seen := make(map[string]int)
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, next, err := s.ListExecutionsPage(testWorkflow, 3, token)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, e := range page {
+			seen[e.Name]++
+		}
+		if next == "" {
+			break
+		}
+		token = next
+
+		// New executions arriving mid-listing must not disturb later pages
+		if _, err := s.CreateExecution(testWorkflow, types.Null); err != nil {
+			t.Fatalf("create execution: %v", err)
+		}
+	}
+
+	for _, name := range original {
+		switch seen[name] {
+		case 0:
+			t.Errorf("execution %s was skipped", name)
+		case 1:
+		default:
+			t.Errorf("execution %s was returned %d times", name, seen[name])
+		}
+	}
+}
+
+func TestListExecutionsPageInvalidToken(t *testing.T) {
+	s, _ := newStoreWithExecutions(t, 1)
+
+	if _, _, err := s.ListExecutionsPage(testWorkflow, 1, "not-a-token"); err == nil {
+		t.Error("expected error for invalid page token")
+	}
+}
+
+func TestListExecutionsOnlyReturnsWorkflow(t *testing.T) {
+	s, names := newStoreWithExecutions(t, 3)
+	if _, err := s.CreateWorkflow("projects/p/locations/l", "wf2", "main: {}", ""); err != nil {
+		t.Fatalf("create workflow: %v", err)
+	}
+	if _, err := s.CreateExecution("projects/p/locations/l/workflows/wf2", types.Null); err != nil {
+		t.Fatalf("create execution: %v", err)
+	}
+
+	got := s.ListExecutions(testWorkflow)
+	if len(got) != len(names) {
+		t.Fatalf("got %d executions, want %d", len(got), len(names))
+	}
+	for i, e := range got {
+		if e.Name != names[i] {
+			t.Errorf("execution[%d] = %s, want %s", i, e.Name, names[i])
+		}
+	}
+	if got := s.ListExecutions("projects/p/locations/l/workflows/missing"); len(got) != 0 {
+		t.Errorf("got %d executions for a missing workflow, want 0", len(got))
+	}
+}
+
+// TestListExecutionsScansOnlyWorkflow checks that listing reads a per-workflow
+// index holding just that workflow's executions, so its cost does not grow
+// with the executions of other workflows.
+func TestListExecutionsScansOnlyWorkflow(t *testing.T) {
+	const workflows, perWorkflow = 50, 4
+
+	s := New()
+	for w := 0; w < workflows; w++ {
+		id := fmt.Sprintf("wf%d", w)
+		if _, err := s.CreateWorkflow("projects/p/locations/l", id, "main: {}", ""); err != nil {
+			t.Fatalf("create workflow: %v", err)
+		}
+		for i := 0; i < perWorkflow; i++ {
+			if _, err := s.CreateExecution("projects/p/locations/l/workflows/"+id, types.Null); err != nil {
+				t.Fatalf("create execution: %v", err)
+			}
+		}
+	}
+
+	if len(s.byWorkflow) != workflows {
+		t.Fatalf("index has %d workflows, want %d", len(s.byWorkflow), workflows)
+	}
+	for name, execs := range s.byWorkflow {
+		if len(execs) != perWorkflow {
+			t.Errorf("index for %s holds %d executions, want %d", name, len(execs), perWorkflow)
+		}
+		for _, e := range execs {
+			if !strings.HasPrefix(e.Name, name+"/executions/") {
+				t.Errorf("index for %s holds %s", name, e.Name)
+			}
+		}
+		if got := s.ListExecutions(name); len(got) != perWorkflow {
+			t.Errorf("ListExecutions(%s) = %d executions, want %d", name, len(got), perWorkflow)
+		}
+	}
+}
+
+// BenchmarkListExecutions lists one workflow's executions in a store holding
+// 10k executions across 100 workflows. Its cost should track the 100 results,
+// not the 10k stored executions.
+func BenchmarkListExecutions(b *testing.B) {
+	const workflows, perWorkflow = 100, 100
+
+	s := New()
+	for w := 0; w < workflows; w++ {
+		id := fmt.Sprintf("wf%d", w)
+		if _, err := s.CreateWorkflow("projects/p/locations/l", id, "main: {}", ""); err != nil {
+			b.Fatalf("create workflow: %v", err)
+		}
+		for i := 0; i < perWorkflow; i++ {
+			if _, err := s.CreateExecution("projects/p/locations/l/workflows/"+id, types.Null); err != nil {
+				b.Fatalf("create execution: %v", err)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := s.ListExecutions("projects/p/locations/l/workflows/wf42"); len(got) != perWorkflow {
+			b.Fatalf("got %d executions, want %d", len(got), perWorkflow)
+		}
+	}
+}
+
+func TestStepEvents(t *testing.T) {
+	s := New()
+	const exec = testWorkflow + "/executions/exec-1"
+
+	ok := s.StartStep(exec, "ok")
+	bad := s.StartStep(exec, "bad")
+	running := s.StartStep(exec, "running")
+	s.FinishStep(exec, ok, nil)
+	s.FinishStep(exec, bad, types.NewValueError("boom"))
+
+	steps := s.ListSteps(exec)
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	if steps[0].State != ExecutionSucceeded || steps[0].EndTime.IsZero() {
+		t.Errorf("ok step = %+v", steps[0])
+	}
+	if steps[1].State != ExecutionFailed || steps[1].Error != "boom" {
+		t.Errorf("bad step = %+v", steps[1])
+	}
+	if steps[2].State != ExecutionActive || !steps[2].EndTime.IsZero() || running != 2 {
+		t.Errorf("running step = %+v (index %d)", steps[2], running)
+	}
+}
+
+func TestStepEventsAreBounded(t *testing.T) {
+	s := New()
+	const exec = testWorkflow + "/executions/exec-1"
+
+	for i := 0; i < MaxStepEvents; i++ {
+		s.StartStep(exec, fmt.Sprintf("s%d", i))
+	}
+	i := s.StartStep(exec, "overflow")
+	if i != -1 {
+		t.Errorf("StartStep past the limit = %d, want -1", i)
+	}
+	s.FinishStep(exec, i, nil)
+	if n := len(s.ListSteps(exec)); n != MaxStepEvents {
+		t.Errorf("got %d steps, want %d", n, MaxStepEvents)
+	}
+}
+
+func TestCancelledExecutionKeepsState(t *testing.T) {
+	s, names := newStoreWithExecutions(t, 2)
+
+	for i, finish := range []func(string) error{
+		func(name string) error { return s.FailExecution(name, types.NewValueError("late")) },
+		func(name string) error { return s.CompleteExecution(name, types.NewInt(1)) },
+	} {
+		if err := s.CancelExecution(names[i]); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+		if err := finish(names[i]); err == nil {
+			t.Errorf("execution %d: finishing a cancelled execution succeeded", i)
+		}
+		exec, _ := s.GetExecution(names[i])
+		if exec.State != ExecutionCancelled || exec.Error != nil || exec.Result != "" {
+			t.Errorf("execution %d = %+v, want it left CANCELLED", i, exec)
+		}
+	}
+}
+
+func TestCreateExecutionWithID(t *testing.T) {
+	s, _ := newStoreWithExecutions(t, 0)
+
+	first, created, err := s.CreateExecutionWithID(testWorkflow, "exec-1", types.NewInt(1))
+	if err != nil || !created {
+		t.Fatalf("first create: created=%v err=%v", created, err)
+	}
+	again, created, err := s.CreateExecutionWithID(testWorkflow, "exec-1", types.NewInt(2))
+	if err != nil || created || again.Name != first.Name || again.Argument != first.Argument {
+		t.Fatalf("retry: got %+v created=%v err=%v, want the first execution", again, created, err)
+	}
+
+	// Generated names must not collide with the client-chosen one
+	generated, err := s.CreateExecution(testWorkflow, types.Null)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if generated.Name == first.Name {
+		t.Errorf("generated execution reused client-chosen name %s", first.Name)
+	}
+	if n := len(s.ListExecutions(testWorkflow)); n != 2 {
+		t.Errorf("got %d executions, want 2", n)
+	}
+
+	if _, _, err := s.CreateExecutionWithID(testWorkflow, "bad/id", types.Null); err == nil {
+		t.Error("expected an error for an invalid execution ID")
+	}
+}
+
+func TestListWorkflowsWildcard(t *testing.T) {
+	s := New()
+	for _, parent := range []string{
+		"projects/p/locations/us-central1",
+		"projects/p/locations/europe-west1",
+		"projects/other/locations/us-central1",
+	} {
+		if _, err := s.CreateWorkflow(parent, "wf", "main: {}", ""); err != nil {
+			t.Fatalf("create workflow: %v", err)
+		}
+	}
+
+	for parent, want := range map[string]int{
+		"projects/p/locations/us-central1": 1,
+		"projects/p/locations/-":           2,
+		"projects/-/locations/us-central1": 2,
+		"projects/-/locations/-":           3,
+		"projects/-/-/-":                   0,
+		"projects/p":                       0,
+	} {
+		if got := len(s.ListWorkflows(parent)); got != want {
+			t.Errorf("ListWorkflows(%q) returned %d workflows, want %d", parent, got, want)
+		}
+	}
+}
+
+func TestExecutionsAreSnapshots(t *testing.T) {
+	s, names := newStoreWithExecutions(t, 1)
+
+	before, _ := s.GetExecution(names[0])
+	listed := s.ListExecutions(testWorkflow)[0]
+	if err := s.CompleteExecution(names[0], types.NewInt(1)); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if before.State != ExecutionActive || listed.State != ExecutionActive {
+		t.Errorf("returned executions changed with the store: %s, %s", before.State, listed.State)
+	}
+
+	before.State = ExecutionFailed
+	if after, _ := s.GetExecution(names[0]); after.State != ExecutionSucceeded {
+		t.Errorf("state = %s after modifying a returned execution, want SUCCEEDED", after.State)
+	}
+}
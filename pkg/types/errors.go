@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -27,6 +28,11 @@ const (
 	TagParallelNestingError         = "ParallelNestingError"
 	TagUnhandledBranchError         = "UnhandledBranchError"
 	TagConnectionFailedError        = "ConnectionFailedError"
+
+	// TagCancelledError marks the error an execution ends with when it is
+	// cancelled. It is an emulator addition: cancellation cannot be caught,
+	// so workflow code never sees it.
+	TagCancelledError = "CancelledError"
 )
 
 // WorkflowError represents a GCW runtime error with message, code, and tags.
@@ -35,6 +41,11 @@ type WorkflowError struct {
 	Code    int64
 	Tags    []string
 	Extra   map[string]Value // additional fields (e.g., headers, body for HttpError)
+
+	// StepPath is the chain of workflow and step names leading to the step
+	// that raised the error (e.g. main, loop, call_api). It is reported as the
+	// execution error context and is not part of the error map.
+	StepPath []string
 }
 
 // Error implements the error interface.
@@ -54,9 +65,14 @@ func (e *WorkflowError) ToValue() Value {
 	}
 	m.Set("tags", NewList(tags))
 
-	// Include extra fields (e.g., headers, body for HttpError)
-	for k, v := range e.Extra {
-		m.Set(k, v)
+	// Include extra fields (e.g., headers, body for HttpError) in a stable order
+	extraKeys := make([]string, 0, len(e.Extra))
+	for k := range e.Extra {
+		extraKeys = append(extraKeys, k)
+	}
+	sort.Strings(extraKeys)
+	for _, k := range extraKeys {
+		m.Set(k, e.Extra[k])
 	}
 
 	return NewMap(m)
@@ -91,6 +107,19 @@ func ErrorFromValue(v Value) *WorkflowError {
 		}
 	}
 
+	// Keep any other fields so custom error maps round-trip intact
+	for _, k := range m.Keys() {
+		switch k {
+		case "message", "code", "tags":
+			continue
+		}
+		if e.Extra == nil {
+			e.Extra = make(map[string]Value)
+		}
+		v, _ := m.Get(k)
+		e.Extra[k] = v
+	}
+
 	return e
 }
 
@@ -132,9 +161,9 @@ func NewZeroDivisionError() *WorkflowError {
 }
 
 // NewRecursionError creates a RecursionError for call stack overflow.
-func NewRecursionError() *WorkflowError {
+func NewRecursionError(msg string) *WorkflowError {
 	return &WorkflowError{
-		Message: "call stack depth limit exceeded (max 20)",
+		Message: msg,
 		Code:    0,
 		Tags:    []string{TagRecursionError, TagResourceLimitError},
 	}
@@ -177,6 +206,11 @@ func NewParallelNestingError(msg string) *WorkflowError {
 	return &WorkflowError{Message: msg, Code: 0, Tags: []string{TagParallelNestingError, TagResourceLimitError}}
 }
 
+// NewCancelledError creates the error a cancelled execution ends with.
+func NewCancelledError(msg string) *WorkflowError {
+	return &WorkflowError{Message: msg, Code: 0, Tags: []string{TagCancelledError}}
+}
+
 // NewUnhandledBranchError creates an UnhandledBranchError for parallel continueAll.
 func NewUnhandledBranchError(msg string) *WorkflowError {
 	return &WorkflowError{Message: msg, Code: 0, Tags: []string{TagUnhandledBranchError}}
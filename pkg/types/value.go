@@ -3,8 +3,11 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"sort"
 	"strings"
@@ -61,15 +64,25 @@ type Value struct {
 }
 
 // OrderedMap maintains insertion order for map keys, matching GCW map behavior.
+// Get, Set, and Delete are O(1) amortized: Delete leaves a tombstone in the
+// key order, which is compacted once tombstones outnumber live keys.
 type OrderedMap struct {
-	keys   []string
-	values map[string]Value
+	order   []orderedKey     // keys in insertion order, including tombstones
+	index   map[string]int   // position of each live key in order
+	values  map[string]Value // values of live keys
+	deleted int              // number of tombstones in order
+}
+
+// orderedKey is one slot of an OrderedMap's key order.
+type orderedKey struct {
+	key     string
+	deleted bool
 }
 
 // NewOrderedMap creates a new empty ordered map.
 func NewOrderedMap() *OrderedMap {
 	return &OrderedMap{
-		keys:   make([]string, 0),
+		index:  make(map[string]int),
 		values: make(map[string]Value),
 	}
 }
@@ -99,43 +112,65 @@ func (m *OrderedMap) Get(key string) (Value, bool) {
 
 // Set adds or updates a key-value pair, preserving insertion order.
 func (m *OrderedMap) Set(key string, val Value) {
-	if _, exists := m.values[key]; !exists {
-		m.keys = append(m.keys, key)
+	if _, exists := m.index[key]; !exists {
+		m.index[key] = len(m.order)
+		m.order = append(m.order, orderedKey{key: key})
 	}
 	m.values[key] = val
 }
 
 // Delete removes a key from the map.
 func (m *OrderedMap) Delete(key string) {
-	if _, exists := m.values[key]; !exists {
+	i, exists := m.index[key]
+	if !exists {
 		return
 	}
 	delete(m.values, key)
-	for i, k := range m.keys {
-		if k == key {
-			m.keys = append(m.keys[:i], m.keys[i+1:]...)
-			break
+	delete(m.index, key)
+	m.order[i].deleted = true
+	m.deleted++
+	if m.deleted > len(m.order)/2 {
+		m.compact()
+	}
+}
+
+// compact drops tombstones from the key order.
+func (m *OrderedMap) compact() {
+	live := m.order[:0]
+	for _, k := range m.order {
+		if !k.deleted {
+			m.index[k.key] = len(live)
+			live = append(live, k)
 		}
 	}
+	clear(m.order[len(live):])
+	m.order = live
+	m.deleted = 0
 }
 
 // Keys returns the keys in insertion order.
 func (m *OrderedMap) Keys() []string {
-	result := make([]string, len(m.keys))
-	copy(result, m.keys)
+	result := make([]string, 0, len(m.values))
+	for _, k := range m.order {
+		if !k.deleted {
+			result = append(result, k.key)
+		}
+	}
 	return result
 }
 
 // Len returns the number of entries.
 func (m *OrderedMap) Len() int {
-	return len(m.keys)
+	return len(m.values)
 }
 
 // Clone creates a deep copy of the ordered map.
 func (m *OrderedMap) Clone() *OrderedMap {
 	c := NewOrderedMap()
-	for _, k := range m.keys {
-		c.Set(k, m.values[k].Clone())
+	for _, k := range m.order {
+		if !k.deleted {
+			c.Set(k.key, m.values[k.key].Clone())
+		}
 	}
 	return c
 }
@@ -415,7 +450,15 @@ func (v Value) MarshalJSON() ([]byte, error) {
 	case TypeInt:
 		return json.Marshal(v.intVal)
 	case TypeDouble:
-		return json.Marshal(v.doubleVal)
+		b, err := json.Marshal(v.doubleVal)
+		if err != nil {
+			return nil, err
+		}
+		// GCW keeps integral doubles distinct from ints: 1.0, not 1
+		if !bytes.ContainsAny(b, ".eE") {
+			b = append(b, ".0"...)
+		}
+		return b, nil
 	case TypeString:
 		return json.Marshal(v.stringVal)
 	case TypeBytes:
@@ -472,6 +515,7 @@ func ValueFromJSON(v interface{}) Value {
 		}
 		return NewDouble(val)
 	case json.Number:
+		// A decimal point or exponent makes a double, even if integral
 		if i, err := val.Int64(); err == nil {
 			return NewInt(i)
 		}
@@ -504,6 +548,68 @@ func ValueFromJSON(v interface{}) Value {
 	}
 }
 
+// ParseJSON decodes a JSON document into a Value. Unlike json.Unmarshal
+// followed by ValueFromJSON, map keys keep the order in which they appear in
+// the document, as they do in GCW, and numbers keep their type: 5 is an int
+// while 5.0 and 5e0 are doubles.
+func ParseJSON(data []byte) (Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return Null, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return Null, errors.New("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// decodeJSONValue reads the next complete value from dec.
+func decodeJSONValue(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Null, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := NewOrderedMap()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return Null, err
+			}
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return Null, err
+			}
+			m.Set(key.(string), val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return Null, err
+		}
+		return NewMap(m), nil
+	case json.Delim('['):
+		items := []Value{}
+		for dec.More() {
+			val, err := decodeJSONValue(dec)
+			if err != nil {
+				return Null, err
+			}
+			items = append(items, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return Null, err
+		}
+		return NewList(items), nil
+	}
+	return ValueFromJSON(tok), nil
+}
+
 // ToGoValue converts a Value to a plain Go interface{} suitable for JSON marshaling.
 func (v Value) ToGoValue() interface{} {
 	switch v.typ {
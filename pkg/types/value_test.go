@@ -0,0 +1,123 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestOrderedMapDeletePreservesOrder(t *testing.T) {
+	m := NewOrderedMap()
+	for i := 0; i < 10; i++ {
+		m.Set(fmt.Sprintf("k%d", i), NewInt(int64(i)))
+	}
+	// Enough deletes to trigger compaction
+	for _, i := range []int{0, 2, 3, 5, 7, 9} {
+		m.Delete(fmt.Sprintf("k%d", i))
+	}
+	m.Set("k2", NewInt(2))
+	m.Set("k4", NewInt(40))
+
+	want := []string{"k1", "k4", "k6", "k8", "k2"}
+	if got := m.Keys(); !slices.Equal(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if m.Len() != len(want) {
+		t.Errorf("Len() = %d, want %d", m.Len(), len(want))
+	}
+	if v, _ := m.Get("k4"); v.AsInt() != 40 {
+		t.Errorf("k4 = %v, want 40", v)
+	}
+	if got := m.Clone().Keys(); !slices.Equal(got, want) {
+		t.Errorf("Clone().Keys() = %v, want %v", got, want)
+	}
+}
+
+func TestMarshalJSONDouble(t *testing.T) {
+	tests := []struct {
+		v    Value
+		want string
+	}{
+		{NewDouble(1.0), "1.0"},
+		{NewDouble(-3), "-3.0"},
+		{NewDouble(0), "0.0"},
+		{NewDouble(2.5), "2.5"},
+		{NewDouble(1e21), "1e+21"},
+		{NewInt(1), "1"},
+		{NewList([]Value{NewDouble(5), NewInt(5)}), "[5.0,5]"},
+	}
+	for _, tt := range tests {
+		got, err := tt.v.MarshalJSON()
+		if err != nil {
+			t.Errorf("MarshalJSON(%v): %v", tt.v, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("MarshalJSON(%v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONKeepsNumberTypes(t *testing.T) {
+	v, err := ParseJSON([]byte(`{"i": 5, "d": 5.0, "e": 5e0, "big": 99999999999999999999, "f": 2.5}`))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+	want := map[string]Value{
+		"i":   NewInt(5),
+		"d":   NewDouble(5),
+		"e":   NewDouble(5),
+		"big": NewDouble(1e20),
+		"f":   NewDouble(2.5),
+	}
+	for k, w := range want {
+		got, _ := v.AsMap().Get(k)
+		if got.Type() != w.Type() || !got.Equal(w) {
+			t.Errorf("%s = %v (%s), want %v (%s)", k, got, got.Type(), w, w.Type())
+		}
+	}
+
+	// Marshaling and parsing again keeps a double a double
+	b, _ := NewDouble(5).MarshalJSON()
+	if back, err := ParseJSON(b); err != nil || back.Type() != TypeDouble {
+		t.Errorf("round trip of 5.0 = %v (%s), err %v", back, back.Type(), err)
+	}
+}
+
+// BenchmarkOrderedMapSet builds a 10k-entry map with repeated Set. Cost per
+// entry should stay constant as the map grows.
+func BenchmarkOrderedMapSet(b *testing.B) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := NewOrderedMap()
+		for _, k := range keys {
+			m.Set(k, NewInt(1))
+		}
+	}
+}
+
+// BenchmarkOrderedMapDelete deletes every entry of a 10k-entry map in
+// insertion order, the worst case for a slice-scanning Delete.
+func BenchmarkOrderedMapDelete(b *testing.B) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		m := NewOrderedMap()
+		for _, k := range keys {
+			m.Set(k, NewInt(1))
+		}
+		b.StartTimer()
+		for _, k := range keys {
+			m.Delete(k)
+		}
+	}
+}
@@ -148,6 +148,61 @@ main:
 	}
 }
 
+// TestAPIExecutions_CreateWithExecutionID verifies that re-issuing a create
+// with the same executionId returns the existing execution instead of
+// starting another.
+func TestAPIExecutions_CreateWithExecutionID(t *testing.T) {
+	wfID := uniqueID("exec-idempotent")
+	yaml := `
+main:
+  steps:
+    - done:
+        return: "once"
+`
+	name := createWorkflow(t, wfID, yaml)
+	url := apiURL(name + "/executions?executionId=order-42")
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(url, "application/json", bytes.NewReader([]byte("{}")))
+		if err != nil {
+			t.Fatalf("HTTP error: %v", err)
+		}
+		var exec map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&exec)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("create %d: expected 200, got %d: %v", i, resp.StatusCode, exec)
+		}
+		execName, _ := exec["name"].(string)
+		names = append(names, execName)
+	}
+
+	if want := name + "/executions/order-42"; names[0] != want || names[1] != want {
+		t.Errorf("execution names = %v, want both %s", names, want)
+	}
+
+	resp, err := http.Get(apiURL(name + "/executions"))
+	if err != nil {
+		t.Fatalf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if executions, _ := result["executions"].([]interface{}); len(executions) != 1 {
+		t.Errorf("expected 1 execution, got %d", len(executions))
+	}
+
+	bad, err := http.Post(apiURL(name+"/executions?executionId=no.dots"), "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatalf("HTTP error: %v", err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid executionId: expected 400, got %d", bad.StatusCode)
+	}
+}
+
 // TestAPIExecutions_WithArgument verifies execution with argument parameter.
 func TestAPIExecutions_WithArgument(t *testing.T) {
 	wfID := uniqueID("exec-args")
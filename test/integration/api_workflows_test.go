@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -107,6 +108,57 @@ main:
 	}
 }
 
+// TestAPIWorkflows_ListAllLocations verifies that a "-" location lists
+// workflows across every location in the project.
+func TestAPIWorkflows_ListAllLocations(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - done:
+        return: "test"
+`
+	local := createWorkflow(t, uniqueID("api-list-here"), yaml)
+
+	otherParent := "projects/" + defaultProject + "/locations/europe-west1"
+	otherID := uniqueID("api-list-there")
+	data, _ := json.Marshal(map[string]interface{}{"sourceContents": yaml})
+	resp, err := http.Post(apiURL(otherParent+"/workflows")+"?workflowId="+otherID, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("HTTP error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create in europe-west1: expected 200, got %d", resp.StatusCode)
+	}
+	remote := otherParent + "/workflows/" + otherID
+
+	resp, err = http.Get(apiURL("projects/" + defaultProject + "/locations/-/workflows"))
+	if err != nil {
+		t.Fatalf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	workflows, _ := result["workflows"].([]interface{})
+
+	found := map[string]bool{}
+	for _, wf := range workflows {
+		m, _ := wf.(map[string]interface{})
+		name, _ := m["name"].(string)
+		found[name] = true
+	}
+	for _, name := range []string{local, remote} {
+		if !found[name] {
+			t.Errorf("workflow %s missing from locations/- listing", name)
+		}
+	}
+}
+
 // TestAPIWorkflows_Update verifies updating a workflow via PATCH.
 func TestAPIWorkflows_Update(t *testing.T) {
 	wfID := uniqueID("api-update")
@@ -224,3 +276,172 @@ main:
 		t.Errorf("expected error for duplicate workflow, got %d", resp.StatusCode)
 	}
 }
+
+// TestAPIWorkflows_CreateInvalidID verifies that workflow IDs violating the
+// GCW naming rules are rejected with INVALID_ARGUMENT.
+func TestAPIWorkflows_CreateInvalidID(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"sourceContents": `
+main:
+  steps:
+    - done:
+        return: "test"
+`,
+	})
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"uppercase", "MyWorkflow"},
+		{"leading digit", "1-workflow"},
+		{"too long", "a" + strings.Repeat("b", 128)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := apiURL(parentPath+"/workflows") + "?workflowId=" + tt.id
+			resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("HTTP error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", resp.StatusCode)
+			}
+			var result map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&result)
+			errMap, _ := result["error"].(map[string]interface{})
+			if errMap["status"] != "INVALID_ARGUMENT" {
+				t.Errorf("expected INVALID_ARGUMENT, got %v", errMap["status"])
+			}
+		})
+	}
+}
+
+// validateWorkflowSource posts source to the workflows:validate endpoint and
+// returns the status code and decoded response body.
+func validateWorkflowSource(t *testing.T, source string) (int, map[string]interface{}) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"sourceContents": source,
+	})
+
+	resp, err := http.Post(apiURL(parentPath+"/workflows:validate"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// validateErrorDetail returns the first entry of error.details from a
+// validate response.
+func validateErrorDetail(t *testing.T, result map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	errMap, ok := result["error"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected error object in response, got: %v", result)
+	}
+	details, ok := errMap["details"].([]interface{})
+	if !ok || len(details) == 0 {
+		t.Fatalf("expected error.details in response, got: %v", errMap)
+	}
+	detail, _ := details[0].(map[string]interface{})
+	return detail
+}
+
+// TestAPIWorkflows_ValidateValid verifies that a valid source is accepted
+// and nothing is deployed.
+func TestAPIWorkflows_ValidateValid(t *testing.T) {
+	status, result := validateWorkflowSource(t, `
+main:
+  steps:
+    - done:
+        return: "ok"
+`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %v", status, result)
+	}
+	if result["valid"] != true {
+		t.Errorf("expected valid=true, got %v", result["valid"])
+	}
+}
+
+// TestAPIWorkflows_ValidateSyntaxError verifies that a malformed step is
+// rejected with the parse error location.
+func TestAPIWorkflows_ValidateSyntaxError(t *testing.T) {
+	status, result := validateWorkflowSource(t, `
+main:
+  steps:
+    - bad:
+        bogus: 1
+`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %v", status, result)
+	}
+	if result["valid"] != false {
+		t.Errorf("expected valid=false, got %v", result["valid"])
+	}
+
+	detail := validateErrorDetail(t, result)
+	if loc, _ := detail["location"].(string); loc != "step 'bad' in main" {
+		t.Errorf("expected location %q, got %q", "step 'bad' in main", loc)
+	}
+	if msg, _ := detail["message"].(string); !strings.Contains(msg, "bogus") {
+		t.Errorf("expected message to mention 'bogus', got %q", msg)
+	}
+}
+
+// TestAPIWorkflows_ValidateMissingMain verifies that a source without a main
+// workflow is rejected.
+func TestAPIWorkflows_ValidateMissingMain(t *testing.T) {
+	status, result := validateWorkflowSource(t, `
+helper:
+  steps:
+    - done:
+        return: 1
+`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %v", status, result)
+	}
+
+	detail := validateErrorDetail(t, result)
+	if loc, _ := detail["location"].(string); loc != "top level" {
+		t.Errorf("expected location %q, got %q", "top level", loc)
+	}
+	if msg, _ := detail["message"].(string); !strings.Contains(msg, "main") {
+		t.Errorf("expected message to mention 'main', got %q", msg)
+	}
+}
+
+// TestAPIWorkflows_ValidateInvalidYAML verifies that source that is not
+// valid YAML is rejected with the line of the syntax error.
+func TestAPIWorkflows_ValidateInvalidYAML(t *testing.T) {
+	status, result := validateWorkflowSource(t, `
+main:
+  steps:
+    - done:
+        return: x: y
+`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %v", status, result)
+	}
+	if result["valid"] != false {
+		t.Errorf("expected valid=false, got %v", result["valid"])
+	}
+
+	detail := validateErrorDetail(t, result)
+	if loc, _ := detail["location"].(string); loc != "line 5" {
+		t.Errorf("expected location %q, got %q", "line 5", loc)
+	}
+	if msg, _ := detail["message"].(string); !strings.Contains(msg, "invalid YAML") {
+		t.Errorf("expected message to mention invalid YAML, got %q", msg)
+	}
+}
@@ -52,6 +52,56 @@ main:
 	assertResultEquals(t, er, []interface{}{float64(10), float64(2), float64(30)})
 }
 
+// TestAssign_ListElementByIndex verifies that assigning to an index
+// overwrites that element, and that out-of-range and negative indices, literal
+// or computed, raise IndexError and leave the list unchanged.
+func TestAssign_ListElementByIndex(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - items: ["a", "b", "c"]
+          - items[1]: "x"
+          - errors: []
+          - neg: -1
+    - bad_indexes:
+        for:
+          value: target
+          in: ["past_end", "negative", "computed_negative"]
+          steps:
+            - try_assign:
+                try:
+                  switch:
+                    - condition: ${target == "past_end"}
+                      assign:
+                        - items[3]: "d"
+                    - condition: ${target == "negative"}
+                      assign:
+                        - items[-1]: "z"
+                    - condition: ${target == "computed_negative"}
+                      assign:
+                        - items[neg]: "z"
+                except:
+                  as: e
+                  steps:
+                    - record:
+                        assign:
+                          - errors: ${list.concat(errors, e.message)}
+    - done:
+        return:
+          items: ${items}
+          errors: ${errors}
+`
+	er := deployAndRun(t, uniqueID("assign-list-index"), yaml, nil)
+	assertResultContains(t, er, "items", []interface{}{"a", "x", "c"})
+	assertResultContains(t, er, "errors", []interface{}{
+		"list index 3 out of range (length 3)",
+		"list index -1 out of range (length 3)",
+		"list index -1 out of range (length 3)",
+	})
+}
+
 // TestAssign_MapOperations verifies map creation and key assignment.
 func TestAssign_MapOperations(t *testing.T) {
 	yaml := `
@@ -94,6 +144,119 @@ main:
 	})
 }
 
+// TestAssign_NestedPathCreatesMaps verifies that assigning through missing
+// map keys creates the intermediate maps.
+func TestAssign_NestedPathCreatesMaps(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - config:
+              name: "app"
+          - config.db.primary.host: "localhost"
+          - config["db"].primary["port"]: 5432
+    - done:
+        return: ${config}
+`
+	er := deployAndRun(t, uniqueID("assign-vivify"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"name": "app",
+		"db": map[string]interface{}{
+			"primary": map[string]interface{}{
+				"host": "localhost",
+				"port": float64(5432),
+			},
+		},
+	})
+}
+
+// TestAssign_ListElementInPath verifies assigning to a list element by index,
+// including a new key in a map held by the list.
+func TestAssign_ListElementInPath(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - data:
+              items: [1, {"name": "b"}, 3]
+          - data.items[0]: "first"
+          - data.items[1].tags.primary: true
+    - done:
+        return: ${data.items}
+`
+	er := deployAndRun(t, uniqueID("assign-list-path"), yaml, nil)
+	assertResultEquals(t, er, []interface{}{
+		"first",
+		map[string]interface{}{"name": "b", "tags": map[string]interface{}{"primary": true}},
+		float64(3),
+	})
+}
+
+// TestAssign_ListIndexOutOfRange verifies that assigning past the end of a
+// list raises IndexError instead of growing the list, that a missing map
+// key cannot be indexed as a list, and that a failed assignment leaves no
+// partially created maps behind.
+func TestAssign_ListIndexOutOfRange(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - data:
+              items: [1, 2]
+          - past_end_tags: null
+          - missing_list_tags: null
+          - nested_missing_list_tags: null
+    - past_end:
+        try:
+          assign:
+            - data.items[2]: 3
+        except:
+          as: e
+          steps:
+            - record:
+                assign:
+                  - past_end_tags: ${e.tags}
+    - missing_list:
+        try:
+          assign:
+            - data.other[0]: 1
+        except:
+          as: e
+          steps:
+            - record:
+                assign:
+                  - missing_list_tags: ${e.tags}
+    - nested_missing_list:
+        try:
+          assign:
+            - data.new.inner[0]: 1
+        except:
+          as: e
+          steps:
+            - record:
+                assign:
+                  - nested_missing_list_tags: ${e.tags}
+    - done:
+        return:
+          items: ${data.items}
+          past_end: ${past_end_tags}
+          missing_list: ${missing_list_tags}
+          nested_missing_list: ${nested_missing_list_tags}
+          has_other: ${"other" in data}
+          has_new: ${"new" in data}
+`
+	er := deployAndRun(t, uniqueID("assign-list-oob"), yaml, nil)
+	assertResultContains(t, er, "items", []interface{}{float64(1), float64(2)})
+	assertResultContains(t, er, "past_end", []interface{}{"IndexError"})
+	assertResultContains(t, er, "missing_list", []interface{}{"KeyError"})
+	assertResultContains(t, er, "nested_missing_list", []interface{}{"KeyError"})
+	assertResultContains(t, er, "has_other", false)
+	assertResultContains(t, er, "has_new", false)
+}
+
 // TestAssign_ExpressionValues verifies that assignments can use expressions.
 func TestAssign_ExpressionValues(t *testing.T) {
 	yaml := `
@@ -1,6 +1,11 @@
 package integration
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -62,6 +67,9 @@ func TestError_NestedTryExcept(t *testing.T) {
 	yaml := `
 main:
   steps:
+    - init:
+        assign:
+          - inner_caught: false
     - outer:
         try:
           steps:
@@ -387,3 +395,169 @@ main:
 	assertResultContains(t, er, "has_client", true)
 	assertResultContains(t, er, "has_server", false)
 }
+
+// TestError_UnhandledMapPayload verifies that an unhandled map error is
+// reported as a structured JSON payload carrying its code, message, tags, and
+// any custom fields.
+func TestError_UnhandledMapPayload(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - fail:
+        raise:
+          code: 55
+          message: "x"
+          reason: "custom"
+`
+	er := deployAndRun(t, uniqueID("err-map-payload"), yaml, nil)
+	assertFailed(t, er)
+
+	payload, _ := er.Error["payload"].(string)
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &parsed); err != nil {
+		t.Fatalf("error payload is not JSON: %q", payload)
+	}
+	if parsed["code"] != float64(55) {
+		t.Errorf("expected code 55, got %v", parsed["code"])
+	}
+	if parsed["message"] != "x" {
+		t.Errorf("expected message %q, got %v", "x", parsed["message"])
+	}
+	if _, ok := parsed["tags"].([]interface{}); !ok {
+		t.Errorf("expected tags list in payload, got %v", parsed["tags"])
+	}
+	if parsed["reason"] != "custom" {
+		t.Errorf("expected custom field to be kept, got %v", parsed["reason"])
+	}
+}
+
+func TestError_ContextNamesFailingStep(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - outer:
+        steps:
+          - call_api:
+              assign:
+                - x: ${1 / 0}
+`
+	er := deployAndRun(t, uniqueID("err-context"), yaml, nil)
+	assertFailed(t, er)
+
+	errCtx, _ := er.Error["context"].(string)
+	if !strings.Contains(errCtx, "outer -> call_api") {
+		t.Errorf("expected error context to name the failing step, got %q", errCtx)
+	}
+}
+
+// TestError_ExceptVariablesAreLocal verifies that the except error variable and
+// variables first created in an except block are not visible after the
+// try/except, while variables declared beforehand keep their new values.
+func TestError_ExceptVariablesAreLocal(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - message: null
+          - missing: []
+    - guarded:
+        try:
+          steps:
+            - fail:
+                raise: "boom"
+        except:
+          as: e
+          steps:
+            - save:
+                assign:
+                  - message: ${e.message}
+                  - local_only: true
+    - read_e:
+        try:
+          steps:
+            - use:
+                assign:
+                  - x: ${e}
+        except:
+          as: err
+          steps:
+            - note:
+                assign:
+                  - missing: ${list.concat(missing, "e")}
+    - read_local:
+        try:
+          steps:
+            - use:
+                assign:
+                  - x: ${local_only}
+        except:
+          as: err
+          steps:
+            - note:
+                assign:
+                  - missing: ${list.concat(missing, "local_only")}
+    - done:
+        return:
+          message: ${message}
+          missing: ${missing}
+`
+	er := deployAndRun(t, uniqueID("err-except-scope"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "message", "boom")
+	assertResultContains(t, er, "missing", []interface{}{"e", "local_only"})
+}
+
+// TestError_ReraisePreservesError verifies that `raise: ${e}` in an inner
+// except re-raises an error the outer handler cannot tell from the original:
+// message, code, tags and HttpError fields all survive the round-trip.
+func TestError_ReraisePreservesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"reason": "no such order"}`))
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - init:
+        assign:
+          - inner_seen: null
+    - outer:
+        try:
+          steps:
+            - inner:
+                try:
+                  call: http.get
+                  args:
+                    url: %s
+                except:
+                  as: e
+                  steps:
+                    - remember:
+                        assign:
+                          - inner_seen: ${e}
+                    - reraise:
+                        raise: ${e}
+        except:
+          as: e
+          steps:
+            - inspect:
+                return:
+                  code: ${e.code}
+                  tags: ${e.tags}
+                  message: ${e.message}
+                  reason: ${e.body.reason}
+                  identical: ${e == inner_seen}
+`, server.URL)
+
+	er := deployAndRun(t, uniqueID("err-reraise"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "code", float64(404))
+	assertResultContains(t, er, "tags", []interface{}{"HttpError"})
+	assertResultContains(t, er, "message", "HTTP 404: Not Found")
+	assertResultContains(t, er, "reason", "no such order")
+	assertResultContains(t, er, "identical", true)
+}
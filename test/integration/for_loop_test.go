@@ -1,6 +1,10 @@
 package integration
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 )
 
@@ -246,3 +250,77 @@ main:
 		float64(31), float64(32),
 	})
 }
+
+// TestFor_NextEndStopsWorkflow verifies that `next: end` inside a loop body
+// ends the whole execution at once: no further iterations run and the steps
+// after the loop are skipped.
+func TestFor_NextEndStopsWorkflow(t *testing.T) {
+	var iterations, after atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/iteration":
+			iterations.Add(1)
+		case "/after":
+			after.Add(1)
+		}
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - loop:
+        for:
+          value: i
+          range: [1, 5]
+          steps:
+            - record:
+                call: http.get
+                args:
+                  url: %[1]s/iteration
+            - check:
+                switch:
+                  - condition: ${i == 3}
+                    next: end
+    - after_loop:
+        call: http.get
+        args:
+          url: %[1]s/after
+    - done:
+        return: "loop finished"
+`, server.URL)
+
+	er := deployAndRun(t, uniqueID("for-next-end"), yaml, nil)
+	assertResultEquals(t, er, nil)
+	if got := iterations.Load(); got != 3 {
+		t.Errorf("ran %d iterations, want 3", got)
+	}
+	if got := after.Load(); got != 0 {
+		t.Errorf("steps after the loop ran %d times, want 0", got)
+	}
+}
+
+// TestFor_EmptyExceptDoesNotEndWorkflow verifies that an empty steps block is
+// not mistaken for `next: end`.
+func TestFor_EmptyExceptDoesNotEndWorkflow(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - loop:
+        for:
+          value: i
+          in: [1, 2]
+          steps:
+            - attempt:
+                try:
+                  steps:
+                    - fail:
+                        raise: "ignored"
+                except:
+                  steps: []
+    - done:
+        return: "after loop"
+`
+	er := deployAndRun(t, uniqueID("for-empty-except"), yaml, nil)
+	assertResultEquals(t, er, "after loop")
+}
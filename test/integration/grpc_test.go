@@ -412,6 +412,60 @@ func TestGRPC_ListExecutions(t *testing.T) {
 	}
 }
 
+// TestGRPC_CreateExecutionWithID verifies that a client-chosen execution
+// name makes CreateExecution idempotent.
+func TestGRPC_CreateExecutionWithID(t *testing.T) {
+	wfClient := newWorkflowsClient(t)
+	exClient := newExecutionsClient(t)
+	ctx := context.Background()
+
+	wfID := uniqueID("grpc-exec-id")
+	wfName := fmt.Sprintf("%s/workflows/%s", parentPath, wfID)
+
+	op, err := wfClient.CreateWorkflow(ctx, &workflowspb.CreateWorkflowRequest{
+		Parent:     parentPath,
+		WorkflowId: wfID,
+		Workflow: &workflowspb.Workflow{
+			SourceCode: &workflowspb.Workflow_SourceContents{
+				SourceContents: "main:\n  steps:\n    - ret:\n        return: 1",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateWorkflow: %v", err)
+	}
+	if _, err := op.Wait(ctx); err != nil {
+		t.Fatalf("CreateWorkflow Wait: %v", err)
+	}
+
+	// The ID may be given bare or as a full execution name
+	want := wfName + "/executions/retry-safe"
+	for i, name := range []string{"retry-safe", want} {
+		exec, err := exClient.CreateExecution(ctx, &executionspb.CreateExecutionRequest{
+			Parent:    wfName,
+			Execution: &executionspb.Execution{Name: name},
+		})
+		if err != nil {
+			t.Fatalf("CreateExecution %d: %v", i, err)
+		}
+		if exec.GetName() != want {
+			t.Errorf("CreateExecution %d: name = %s, want %s", i, exec.GetName(), want)
+		}
+	}
+
+	it := exClient.ListExecutions(ctx, &executionspb.ListExecutionsRequest{Parent: wfName})
+	count := 0
+	for {
+		if _, err := it.Next(); err != nil {
+			break
+		}
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 execution, got %d", count)
+	}
+}
+
 func TestGRPC_CancelExecution(t *testing.T) {
 	wfClient := newWorkflowsClient(t)
 	exClient := newExecutionsClient(t)
@@ -1,8 +1,13 @@
 package integration
 
 import (
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
@@ -600,3 +605,200 @@ main:
 	// the counter increment step)
 	assertResultContains(t, er, "attempts", float64(3))
 }
+
+// TestHTTP_HMACAuthSignsRequest verifies that auth type "hmac" signs the
+// canonical request (METHOD, path with query, body) and that the receiving
+// server can recompute the same signature.
+func TestHTTP_HMACAuthSignsRequest(t *testing.T) {
+	const key = "partner-secret"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		canonical := r.Method + "\n" + r.URL.EscapedPath() + "?" + r.URL.RawQuery + "\n" + string(body)
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(canonical))
+		want := hex.EncodeToString(mac.Sum(nil))
+
+		if got := r.Header.Get("X-Partner-Signature"); got != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "bad signature %q, want %q", got, want)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"verified": true})
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - call_partner:
+        call: http.post
+        args:
+          url: %s/orders
+          query:
+            region: eu
+          body:
+            order_id: 42
+          auth:
+            type: hmac
+            key: %s
+            algorithm: SHA256
+            headerName: X-Partner-Signature
+        result: response
+    - done:
+        return:
+          verified: ${response.body.verified}
+`, server.URL, key)
+
+	er := deployAndRun(t, uniqueID("http-hmac"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "verified", true)
+}
+
+// TestHTTP_BinaryResponseBody verifies non-JSON, non-text responses are returned as bytes.
+func TestHTTP_BinaryResponseBody(t *testing.T) {
+	payload := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10, '{'}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - call_api:
+        call: http.get
+        args:
+          url: %s
+        result: response
+    - done:
+        return:
+          type: ${type(response.body)}
+          length: ${len(response.body)}
+`, server.URL)
+
+	er := deployAndRun(t, uniqueID("http-bytes"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "type", "bytes")
+	assertResultContains(t, er, "length", float64(len(payload)))
+}
+
+// TestHTTP_GetPaginated verifies http.get_paginated follows next links and
+// concatenates the items of every page in order.
+func TestHTTP_GetPaginated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("page") {
+		case "":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"items": []string{"a", "b"},
+				"next":  "/things?page=2",
+			})
+		case "2":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"items": []string{"c"},
+				"next":  nil,
+			})
+		default:
+			t.Errorf("unexpected page %q", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - fetch_all:
+        call: http.get_paginated
+        args:
+          url: %s/things
+          next_field: next
+          items_field: items
+        result: from_call
+    - done:
+        return:
+          call: ${from_call}
+          expr: ${http.get_paginated("%s/things", "next", "items")}
+`, server.URL, server.URL)
+
+	er := deployAndRun(t, uniqueID("http-paginated"), yaml, nil)
+	assertSucceeded(t, er)
+	want := []interface{}{"a", "b", "c"}
+	assertResultContains(t, er, "call", want)
+	assertResultContains(t, er, "expr", want)
+}
+
+// TestHTTP_GzipResponseDecoded verifies a gzip-encoded response body is
+// decoded before it is parsed into response.body.
+func TestHTTP_GzipResponseDecoded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		json.NewEncoder(gz).Encode(map[string]interface{}{"message": "compressed"})
+		gz.Close()
+	}))
+	defer server.Close()
+
+	// Asking for gzip explicitly stops the transport from decoding it
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - call_api:
+        call: http.get
+        args:
+          url: %s
+          headers:
+            Accept-Encoding: gzip
+        result: response
+    - done:
+        return:
+          message: ${response.body.message}
+          encoded: ${"content-encoding" in response.headers}
+`, server.URL)
+
+	er := deployAndRun(t, uniqueID("http-gzip-resp"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "message", "compressed")
+	assertResultContains(t, er, "encoded", false)
+}
+
+// TestHTTP_CompressedRequest verifies compress: true gzips the request body
+// and sets Content-Encoding.
+func TestHTTP_CompressedRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received map[string]interface{}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Content-Encoding = %q, want gzip", r.Header.Get("Content-Encoding"))
+		} else if gz, err := gzip.NewReader(r.Body); err != nil {
+			t.Errorf("request body is not gzip: %v", err)
+		} else if err := json.NewDecoder(gz).Decode(&received); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"received": received})
+	}))
+	defer server.Close()
+
+	yaml := fmt.Sprintf(`
+main:
+  steps:
+    - call_api:
+        call: http.post
+        args:
+          url: %s
+          compress: true
+          body:
+            name: "test"
+        result: response
+    - done:
+        return:
+          name: ${response.body.received.name}
+`, server.URL)
+
+	er := deployAndRun(t, uniqueID("http-gzip-req"), yaml, nil)
+	assertSucceeded(t, er)
+	assertResultContains(t, er, "name", "test")
+}
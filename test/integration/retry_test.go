@@ -1,6 +1,11 @@
 package integration
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
 )
 
@@ -159,3 +164,63 @@ main:
 	// retry.never means no retries, only 1 attempt
 	assertResultEquals(t, er, float64(1))
 }
+
+// TestRetry_CustomPredicateSelectsStatus verifies that a predicate subworkflow
+// decides which errors are retried: 429 is retried, 500 is not.
+func TestRetry_CustomPredicateSelectsStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantCalls int32
+	}{
+		{http.StatusTooManyRequests, 3},
+		{http.StatusInternalServerError, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			yaml := fmt.Sprintf(`
+main:
+  steps:
+    - try_call:
+        try:
+          call: http.get
+          args:
+            url: %s
+        retry:
+          predicate: ${only_rate_limits}
+          max_retries: 2
+          backoff:
+            initial_delay: 0.1
+            max_delay: 1
+            multiplier: 2
+        except:
+          as: e
+          steps:
+            - handle:
+                return:
+                  code: ${e.code}
+
+only_rate_limits:
+  params: [e]
+  steps:
+    - check:
+        return: ${e.code == 429}
+`, server.URL)
+
+			er := deployAndRun(t, uniqueID("retry-predicate-status"), yaml, nil)
+			assertSucceeded(t, er)
+			assertResultContains(t, er, "code", float64(tt.status))
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
@@ -96,6 +96,292 @@ main:
 	assertResultEquals(t, er, "hi world hi")
 }
 
+// TestStdlib_TextEncodeDecodeRoundTrip verifies that text.encode and
+// text.decode round-trip strings, with UTF-8 as the default charset.
+func TestStdlib_TextEncodeDecodeRoundTrip(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - utf8: ${text.decode(text.encode("héllo, 世界"))}
+          - explicit: ${text.decode(text.encode("héllo", "UTF-8"), "utf-8")}
+          - latin1: ${text.decode(text.encode("héllo", "ISO-8859-1"), "ISO-8859-1")}
+          - utf8Len: ${len(text.encode("é"))}
+          - latin1Len: ${len(text.encode("é", "ISO-8859-1"))}
+    - done:
+        return:
+          utf8: ${utf8}
+          explicit: ${explicit}
+          latin1: ${latin1}
+          utf8Len: ${utf8Len}
+          latin1Len: ${latin1Len}
+`
+	er := deployAndRun(t, uniqueID("stdlib-text-encode"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"utf8":      "héllo, 世界",
+		"explicit":  "héllo",
+		"latin1":    "héllo",
+		"utf8Len":   float64(2),
+		"latin1Len": float64(1),
+	})
+}
+
+// TestStdlib_TextDecodeErrors verifies that invalid bytes and unsupported
+// charsets raise ValueError.
+func TestStdlib_TextDecodeErrors(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - invalidTags: []
+          - charsetTags: []
+    - invalid_bytes:
+        try:
+          steps:
+            - decode:
+                assign:
+                  - s: ${text.decode(base64.decode("/w=="))}
+        except:
+          as: e
+          steps:
+            - save_invalid:
+                assign:
+                  - invalidTags: ${e.tags}
+    - bad_charset:
+        try:
+          steps:
+            - encode:
+                assign:
+                  - b: ${text.encode("x", "EBCDIC")}
+        except:
+          as: e
+          steps:
+            - save_charset:
+                assign:
+                  - charsetTags: ${e.tags}
+    - done:
+        return:
+          invalid: ${"ValueError" in invalidTags}
+          charset: ${"ValueError" in charsetTags}
+`
+	er := deployAndRun(t, uniqueID("stdlib-text-decode-err"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"invalid": true,
+		"charset": true,
+	})
+}
+
+// TestStdlib_TextHexRoundTrip verifies that text.to_hex and text.from_hex
+// round-trip bytes, and that from_hex produces a bytes value.
+func TestStdlib_TextHexRoundTrip(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - hex: ${text.to_hex(text.encode("héllo"))}
+          - decoded: ${text.from_hex("68C3A96C6C6F")}
+          - empty: ${text.to_hex(text.from_hex(""))}
+          - binary: ${text.to_hex(base64.decode("AP8Qfw=="))}
+    - done:
+        return:
+          hex: ${hex}
+          text: ${text.decode(decoded)}
+          type: ${type(decoded)}
+          len: ${len(decoded)}
+          empty: ${empty}
+          binary: ${binary}
+`
+	er := deployAndRun(t, uniqueID("stdlib-text-hex"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"hex":    "68c3a96c6c6f",
+		"text":   "héllo",
+		"type":   "bytes",
+		"len":    float64(6),
+		"empty":  "",
+		"binary": "00ff107f",
+	})
+}
+
+// TestStdlib_TextHexErrors verifies that invalid hex raises ValueError and
+// that text.to_hex rejects strings with TypeError.
+func TestStdlib_TextHexErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		tag  string
+		msg  string
+	}{
+		{"odd length", `text.from_hex("abc")`, "ValueError", "invalid hex"},
+		{"not hex", `text.from_hex("zz")`, "ValueError", "invalid hex"},
+		{"string to hex", `text.to_hex("abc")`, "TypeError", "data must be bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+main:
+  steps:
+    - compute:
+        return: ${` + tt.expr + `}
+`
+			er := deployAndRun(t, uniqueID("stdlib-text-hex-err"), yaml, nil)
+			assertErrorHasTag(t, er, tt.tag)
+			assertErrorContains(t, er, tt.msg)
+		})
+	}
+}
+
+// TestStdlib_TextJoinAndSplitN verifies text.join and text.split_n.
+func TestStdlib_TextJoinAndSplitN(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - joined: ${text.join(["a", "b"], ",")}
+          - empty: ${text.join([], ",")}
+          - split: ${text.split_n("a,b,c", ",", 2)}
+          - whole: ${text.split_n("a,b,c", ",", 1)}
+    - done:
+        return:
+          joined: ${joined}
+          empty: ${empty}
+          split: ${split}
+          whole: ${whole}
+`
+	er := deployAndRun(t, uniqueID("stdlib-text-join"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"joined": "a,b",
+		"empty":  "",
+		"split":  []interface{}{"a", "b,c"},
+		"whole":  []interface{}{"a,b,c"},
+	})
+}
+
+// TestStdlib_TextJoinErrors verifies that text.join rejects non-string
+// elements with TypeError and that text.split_n rejects a limit below 1 with
+// ValueError.
+func TestStdlib_TextJoinErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		tag  string
+		msg  string
+	}{
+		{"join non-string", `text.join(["a", 1], ",")`, "TypeError", "element 1 is int, not string"},
+		{"split_n zero limit", `text.split_n("a,b", ",", 0)`, "ValueError", "limit must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+main:
+  steps:
+    - compute:
+        return: ${` + tt.expr + `}
+`
+			er := deployAndRun(t, uniqueID("stdlib-text-join-err"), yaml, nil)
+			assertErrorHasTag(t, er, tt.tag)
+			assertErrorContains(t, er, tt.msg)
+		})
+	}
+}
+
+// TestStdlib_TextFormat verifies each text.format verb.
+func TestStdlib_TextFormat(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - count: ${text.format("%d items", 3)}
+          - name: ${text.format("hello %s", "Ada")}
+          - price: ${text.format("%.2f / %f", 1.5, 2)}
+          - any: ${text.format("%v and %v", [1, "a"], null)}
+          - percent: ${text.format("100%%")}
+    - done:
+        return:
+          count: ${count}
+          name: ${name}
+          price: ${price}
+          any: ${any}
+          percent: ${percent}
+`
+	er := deployAndRun(t, uniqueID("stdlib-text-format"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"count":   "3 items",
+		"name":    "hello Ada",
+		"price":   "1.50 / 2.000000",
+		"any":     "[1, a] and null",
+		"percent": "100%",
+	})
+}
+
+// TestStdlib_TextFormatErrors verifies that text.format raises TypeError
+// for a value that does not match its verb and ValueError when the values
+// and verbs do not line up.
+func TestStdlib_TextFormatErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		tag  string
+		msg  string
+	}{
+		{"int for %s", `text.format("%s", 1)`, "TypeError", "%s requires a string, got int"},
+		{"string for %d", `text.format("%d", "1")`, "TypeError", "%d requires an int, got string"},
+		{"too few values", `text.format("%d and %d", 1)`, "ValueError", "missing value for verb 2"},
+		{"too many values", `text.format("%d", 1, 2)`, "ValueError", "2 values given but the template uses 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := `
+main:
+  steps:
+    - compute:
+        return: ${` + tt.expr + `}
+`
+			er := deployAndRun(t, uniqueID("stdlib-text-format-err"), yaml, nil)
+			assertErrorHasTag(t, er, tt.tag)
+			assertErrorContains(t, er, tt.msg)
+		})
+	}
+}
+
+// TestStdlib_Clone verifies that clone() returns a deep copy: changing the
+// copy, including nested values, leaves the original untouched.
+func TestStdlib_Clone(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - original:
+              name: "Ada"
+              tags: ["a"]
+          - copy: ${clone(original)}
+    - edit:
+        assign:
+          - copy.name: "Grace"
+          - copy.tags[0]: "b"
+          - n: ${clone(5)}
+    - done:
+        return:
+          original: ${original}
+          copy: ${copy}
+          n: ${n}
+`
+	er := deployAndRun(t, uniqueID("stdlib-clone"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"original": map[string]interface{}{"name": "Ada", "tags": []interface{}{"a"}},
+		"copy":     map[string]interface{}{"name": "Grace", "tags": []interface{}{"b"}},
+		"n":        float64(5),
+	})
+}
+
 // TestStdlib_TextMatchRegex verifies text.match_regex.
 func TestStdlib_TextMatchRegex(t *testing.T) {
 	yaml := `
@@ -267,6 +553,126 @@ main:
 	assertResultEquals(t, er, []interface{}{float64(1), float64(2), float64(3)})
 }
 
+// TestStdlib_ListIndexOf verifies list.index_of, including numeric equality
+// across int and double and -1 for a missing value.
+func TestStdlib_ListIndexOf(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - items: ["a", "b", "a"]
+          - first: ${list.index_of(items, "a")}
+          - second: ${list.index_of(items, "b")}
+          - numeric: ${list.index_of([1, 2], 2.0)}
+          - missing: ${list.index_of(items, "z")}
+    - done:
+        return:
+          first: ${first}
+          second: ${second}
+          numeric: ${numeric}
+          missing: ${missing}
+`
+	er := deployAndRun(t, uniqueID("stdlib-list-index-of"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"first":   float64(0),
+		"second":  float64(1),
+		"numeric": float64(1),
+		"missing": float64(-1),
+	})
+}
+
+// TestStdlib_ListContains verifies list.contains.
+func TestStdlib_ListContains(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - items: [1, "two", [3]]
+          - hasInt: ${list.contains(items, 1.0)}
+          - hasList: ${list.contains(items, [3])}
+          - hasMissing: ${list.contains(items, "three")}
+    - done:
+        return:
+          hasInt: ${hasInt}
+          hasList: ${hasList}
+          hasMissing: ${hasMissing}
+`
+	er := deployAndRun(t, uniqueID("stdlib-list-contains"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"hasInt":     true,
+		"hasList":    true,
+		"hasMissing": false,
+	})
+}
+
+// TestStdlib_ListRange verifies list.range includes both bounds.
+func TestStdlib_ListRange(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - upTo: ${list.range(0, 3)}
+          - single: ${list.range(5, 5)}
+          - empty: ${list.range(3, 0)}
+    - done:
+        return:
+          upTo: ${upTo}
+          single: ${single}
+          empty: ${empty}
+`
+	er := deployAndRun(t, uniqueID("stdlib-list-range"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"upTo":   []interface{}{float64(0), float64(1), float64(2), float64(3)},
+		"single": []interface{}{float64(5)},
+		"empty":  []interface{}{},
+	})
+}
+
+// TestStdlib_ListRepeat verifies list.repeat, and that repeated maps are
+// independent copies.
+func TestStdlib_ListRepeat(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        assign:
+          - letters: ${list.repeat("x", 3)}
+          - none: ${list.repeat("x", 0)}
+          - rows: '${list.repeat({"n": 0}, 2)}'
+          - rows[0].n: 1
+    - done:
+        return:
+          letters: ${letters}
+          none: ${none}
+          rows: ${rows}
+`
+	er := deployAndRun(t, uniqueID("stdlib-list-repeat"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"letters": []interface{}{"x", "x", "x"},
+		"none":    []interface{}{},
+		"rows": []interface{}{
+			map[string]interface{}{"n": float64(1)},
+			map[string]interface{}{"n": float64(0)},
+		},
+	})
+}
+
+// TestStdlib_ListRepeatNegative verifies list.repeat rejects a negative count.
+func TestStdlib_ListRepeatNegative(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - compute:
+        return: ${list.repeat("x", -1)}
+`
+	er := deployAndRun(t, uniqueID("stdlib-list-repeat-neg"), yaml, nil)
+	assertFailed(t, er)
+	assertErrorContains(t, er, "must not be negative")
+}
+
 // --- map.* functions ---
 
 // TestStdlib_MapGet verifies map.get with default value.
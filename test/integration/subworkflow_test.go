@@ -36,6 +36,177 @@ greet:
 	assertResultEquals(t, er, "Hello Ada Lovelace")
 }
 
+// TestSubworkflow_DefaultFromCallerScope verifies that a param default that
+// is an expression is evaluated in the caller's scope at call time, and is
+// not evaluated at all when the argument is passed.
+func TestSubworkflow_DefaultFromCallerScope(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - default_timeout: 30
+    - with_default:
+        call: fetch
+        args:
+          url: "/a"
+        result: first
+    - change:
+        assign:
+          - default_timeout: 60
+    - with_new_default:
+        call: fetch
+        args:
+          url: "/b"
+        result: second
+    - explicit:
+        call: fetch_strict
+        args:
+          url: "/c"
+          timeout: 5
+        result: third
+    - done:
+        return: ${[first, second, third]}
+
+fetch:
+  params:
+    - url
+    - timeout: ${default_timeout}
+  steps:
+    - build:
+        return: ${url + "@" + string(timeout)}
+
+fetch_strict:
+  params:
+    - url
+    - timeout: ${undefined_in_caller}
+  steps:
+    - build:
+        return: ${url + "@" + string(timeout)}
+`
+	er := deployAndRun(t, uniqueID("sub-default-expr"), yaml, nil)
+	assertResultEquals(t, er, []interface{}{"/a@30", "/b@60", "/c@5"})
+}
+
+// TestSubworkflow_MissingRequiredArgIsValueError verifies that calling a
+// subworkflow without a required argument raises a ValueError that names the
+// subworkflow and the parameter, and that it can be caught.
+func TestSubworkflow_MissingRequiredArgIsValueError(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - caught: null
+    - attempt:
+        try:
+          call: greet
+          args:
+            last_name: "Lovelace"
+          result: message
+        except:
+          as: e
+          steps:
+            - save:
+                assign:
+                  - caught: ${e}
+    - done:
+        return:
+          tags: ${caught.tags}
+          message: ${caught.message}
+
+greet:
+  params: [first_name, last_name]
+  steps:
+    - build:
+        return: ${"Hello " + first_name + " " + last_name}
+`
+	er := deployAndRun(t, uniqueID("sub-missing-arg"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"tags":    []interface{}{"ValueError"},
+		"message": "missing required argument 'first_name' for subworkflow 'greet'",
+	})
+}
+
+// TestSubworkflow_UnexpectedArgIsValueError verifies that an args key that
+// does not name a param of the subworkflow is rejected rather than ignored.
+func TestSubworkflow_UnexpectedArgIsValueError(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - caught: null
+    - attempt:
+        try:
+          call: greet
+          args:
+            first_name: "Ada"
+            lastname: "Lovelace"
+          result: message
+        except:
+          as: e
+          steps:
+            - save:
+                assign:
+                  - caught: ${e}
+    - done:
+        return:
+          tags: ${caught.tags}
+          message: ${caught.message}
+
+greet:
+  params: [first_name, last_name: "Unknown"]
+  steps:
+    - build:
+        return: ${"Hello " + first_name + " " + last_name}
+`
+	er := deployAndRun(t, uniqueID("sub-unexpected-arg"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"tags":    []interface{}{"ValueError"},
+		"message": "unexpected argument 'lastname' for subworkflow 'greet'",
+	})
+}
+
+// TestSubworkflow_ArgsAreCopied verifies that a subworkflow mutating a map
+// or list it was passed does not change the caller's value.
+func TestSubworkflow_ArgsAreCopied(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - init:
+        assign:
+          - original:
+              name: "Ada"
+              tags: ["a"]
+    - mutate:
+        call: mutate
+        args:
+          m: ${original}
+        result: changed
+    - done:
+        return:
+          original: ${original}
+          changed: ${changed}
+
+mutate:
+  params: [m]
+  steps:
+    - edit:
+        assign:
+          - m.name: "Grace"
+          - m.tags[0]: "b"
+          - m.extra: true
+    - done:
+        return: ${m}
+`
+	er := deployAndRun(t, uniqueID("sub-args-copied"), yaml, nil)
+	assertResultEquals(t, er, map[string]interface{}{
+		"original": map[string]interface{}{"name": "Ada", "tags": []interface{}{"a"}},
+		"changed":  map[string]interface{}{"name": "Grace", "tags": []interface{}{"b"}, "extra": true},
+	})
+}
+
 // TestSubworkflow_Nested verifies nested subworkflow calls.
 func TestSubworkflow_Nested(t *testing.T) {
 	yaml := loadWorkflow(t, "subworkflow_nested.yaml")
@@ -204,3 +375,76 @@ count_down:
 	er := deployAndRun(t, uniqueID("sub-depth20"), yaml, nil)
 	assertResultEquals(t, er, float64(20))
 }
+
+// TestSubworkflow_ReturnFromLoop verifies that a return inside a loop in a
+// subworkflow surfaces its value to the caller.
+func TestSubworkflow_ReturnFromLoop(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - call_find:
+        call: find_first_even
+        args:
+          items: [3, 5, 8, 9, 10]
+        result: found
+    - done:
+        return: ${found}
+
+find_first_even:
+  params: [items]
+  steps:
+    - scan:
+        for:
+          value: item
+          in: ${items}
+          steps:
+            - check:
+                switch:
+                  - condition: ${item % 2 == 0}
+                    return: ${item}
+    - none:
+        return: -1
+`
+	er := deployAndRun(t, uniqueID("sub-ret-loop"), yaml, nil)
+	assertResultEquals(t, er, float64(8))
+}
+
+// TestSubworkflow_NextEndYieldsNull verifies that a subworkflow ending with
+// next: end (or by running off its last step) returns null, and that only the
+// subworkflow ends: the caller carries on with its next step.
+func TestSubworkflow_NextEndYieldsNull(t *testing.T) {
+	yaml := `
+main:
+  steps:
+    - call_ended:
+        call: compute_then_end
+        result: ended
+    - call_fell_through:
+        call: compute_only
+        result: fell_through
+    - done:
+        return:
+          ended: ${ended}
+          fell_through: ${fell_through}
+          continued: true
+
+compute_then_end:
+  steps:
+    - compute:
+        assign:
+          - x: 42
+        next: end
+    - unreachable:
+        return: ${x}
+
+compute_only:
+  steps:
+    - compute:
+        assign:
+          - x: 42
+`
+	er := deployAndRun(t, uniqueID("sub-next-end"), yaml, nil)
+	assertResultContains(t, er, "ended", nil)
+	assertResultContains(t, er, "fell_through", nil)
+	assertResultContains(t, er, "continued", true)
+}
@@ -12,17 +12,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/lemonberrylabs/gcw-emulator/pkg/store"
+	"github.com/lemonberrylabs/gcw-emulator/pkg/types"
 )
 
 //go:embed templates/*.html
 var templateFS embed.FS
 
+// ExecutionStarter creates and starts an execution of the named workflow.
+type ExecutionStarter func(workflowName string, args types.Value) (*store.Execution, error)
+
 // Handler serves the web UI pages.
 type Handler struct {
 	store    *store.Store
 	project  string
 	location string
 	funcMap  template.FuncMap
+	starter  ExecutionStarter
 }
 
 // pageData wraps all page-specific data with common fields.
@@ -55,6 +60,12 @@ func New(s *store.Store, project, location string) *Handler {
 	}
 }
 
+// SetExecutionStarter sets how executions triggered from the UI are started.
+// Without one, executions are only recorded in the store and never run.
+func (h *Handler) SetExecutionStarter(fn ExecutionStarter) {
+	h.starter = fn
+}
+
 func (h *Handler) render(c *fiber.Ctx, page string, navActive string, data interface{}) error {
 	// Parse templates fresh each time for the page-specific template
 	// This avoids the Go template issue where define blocks conflict across pages
@@ -84,6 +95,7 @@ func (h *Handler) Register(app *fiber.App) {
 	app.Get("/ui/workflows", h.workflowList)
 	app.Get("/ui/workflows/:id", h.workflowDetail)
 	app.Get("/ui/workflows/:id/executions", h.executionList)
+	app.Post("/ui/workflows/:id/executions", h.createExecution)
 	app.Get("/ui/executions", h.allExecutionsList)
 	app.Get("/ui/executions/:workflow/:execution", h.executionDetail)
 
@@ -125,6 +137,9 @@ type workflowDetailContent struct {
 	Workflow   *store.Workflow
 	ID        string
 	Executions []*executionView
+
+	Argument  string // trigger form input, kept when re-rendering with an error
+	FormError string
 }
 
 type executionListContent struct {
@@ -227,7 +242,10 @@ func (h *Handler) workflowList(c *fiber.Ctx) error {
 }
 
 func (h *Handler) workflowDetail(c *fiber.Ctx) error {
-	wfID := c.Params("id")
+	return h.renderWorkflowDetail(c, c.Params("id"), "", "")
+}
+
+func (h *Handler) renderWorkflowDetail(c *fiber.Ctx, wfID, argument, formError string) error {
 	name := fmt.Sprintf("projects/%s/locations/%s/workflows/%s", h.project, h.location, wfID)
 
 	wf, err := h.store.GetWorkflow(name)
@@ -255,9 +273,41 @@ func (h *Handler) workflowDetail(c *fiber.Ctx) error {
 		Workflow:   wf,
 		ID:        wfID,
 		Executions: execViews,
+		Argument:   argument,
+		FormError:  formError,
 	})
 }
 
+// createExecution handles the trigger form on the workflow detail page. On
+// success it redirects to the new execution; invalid input re-renders the form.
+func (h *Handler) createExecution(c *fiber.Ctx) error {
+	wfID := c.Params("id")
+	name := fmt.Sprintf("projects/%s/locations/%s/workflows/%s", h.project, h.location, wfID)
+	argument := strings.TrimSpace(c.FormValue("argument"))
+
+	var args types.Value = types.Null
+	if argument != "" {
+		parsed, err := types.ParseJSON([]byte(argument))
+		if err != nil {
+			c.Status(fiber.StatusBadRequest)
+			return h.renderWorkflowDetail(c, wfID, argument, fmt.Sprintf("Invalid JSON: %v", err))
+		}
+		args = parsed
+	}
+
+	start := h.starter
+	if start == nil {
+		start = h.store.CreateExecution
+	}
+	exec, err := start(name, args)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return h.renderWorkflowDetail(c, wfID, argument, err.Error())
+	}
+
+	return c.Redirect(fmt.Sprintf("/ui/executions/%s/%s", wfID, executionID(exec.Name)), fiber.StatusSeeOther)
+}
+
 func (h *Handler) allExecutionsList(c *fiber.Ctx) error {
 	parent := fmt.Sprintf("projects/%s/locations/%s", h.project, h.location)
 	workflows := h.store.ListWorkflows(parent)
@@ -3,6 +3,8 @@ package web
 import (
 	"io"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
@@ -131,6 +133,76 @@ func TestWorkflowDetail(t *testing.T) {
 	}
 }
 
+func TestTriggerExecutionForm(t *testing.T) {
+	app, s := setupTestApp(t)
+
+	source := "main:\n  params: [args]\n  steps:\n    - done:\n        return: ${args}"
+	s.CreateWorkflow("projects/test-project/locations/us-central1", "my-wf", source, "")
+
+	form := url.Values{"argument": {`{"name": "Alice"}`}}
+	req := httptest.NewRequest("POST", "/ui/workflows/my-wf/executions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != 303 {
+		t.Fatalf("expected 303 redirect, got %d", resp.StatusCode)
+	}
+
+	execs := s.ListExecutions("projects/test-project/locations/us-central1/workflows/my-wf")
+	if len(execs) != 1 {
+		t.Fatalf("expected 1 execution, got %d", len(execs))
+	}
+	if !containsStr(execs[0].Argument, "Alice") {
+		t.Errorf("expected argument to be stored, got %q", execs[0].Argument)
+	}
+
+	loc := resp.Header.Get("Location")
+	if want := "/ui/executions/my-wf/" + executionID(execs[0].Name); loc != want {
+		t.Fatalf("expected redirect to %s, got %s", want, loc)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", loc, nil), -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !containsStr(string(body), executionID(execs[0].Name)) {
+		t.Error("expected new execution on the detail page")
+	}
+}
+
+func TestTriggerExecutionFormInvalidJSON(t *testing.T) {
+	app, s := setupTestApp(t)
+
+	source := "main:\n  steps:\n    - done:\n        return: 1"
+	s.CreateWorkflow("projects/test-project/locations/us-central1", "my-wf", source, "")
+
+	form := url.Values{"argument": {`{not json`}}
+	req := httptest.NewRequest("POST", "/ui/workflows/my-wf/executions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	html := string(body)
+	if !containsStr(html, "Invalid JSON") {
+		t.Error("expected invalid JSON error in response")
+	}
+	if !containsStr(html, "{not json") {
+		t.Error("expected submitted argument to be kept in the form")
+	}
+	if n := len(s.ListExecutions("projects/test-project/locations/us-central1/workflows/my-wf")); n != 0 {
+		t.Errorf("expected no execution to be created, got %d", n)
+	}
+}
+
 func TestWorkflowNotFound(t *testing.T) {
 	app, _ := setupTestApp(t)
 